@@ -4,21 +4,30 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server        ServerConfig    `mapstructure:"server"`
-	Database      DatabaseConfig  `mapstructure:"database"`
-	Redis         RedisConfig     `mapstructure:"redis"`
-	Log           LogConfig       `mapstructure:"log"`
-	EnableFrontend bool           `mapstructure:"enable_frontend"`
+	Server         ServerConfig    `mapstructure:"server"`
+	Database       DatabaseConfig  `mapstructure:"database"`
+	Redis          RedisConfig     `mapstructure:"redis"`
+	Cache          CacheConfig     `mapstructure:"cache"`
+	Proxy          ProxyConfig     `mapstructure:"proxy"`
+	Log            LogConfig       `mapstructure:"log"`
+	Tracing        TracingConfig   `mapstructure:"tracing"`
+	Analytics      AnalyticsConfig `mapstructure:"analytics"`
+	SLO            SLOConfig       `mapstructure:"slo"`
+	Alerting       AlertingConfig  `mapstructure:"alerting"`
+	Health         HealthConfig    `mapstructure:"health"`
+	EnableFrontend bool            `mapstructure:"enable_frontend"`
 }
 
 type ServerConfig struct {
-	Port int `mapstructure:"port"`
+	Port int  `mapstructure:"port"`
+	H2C  bool `mapstructure:"h2c"` // Accept HTTP/2 without TLS (prior knowledge), as used by gRPC clients
 }
 
 type DatabaseConfig struct {
@@ -31,17 +40,193 @@ type DatabaseConfig struct {
 	DSN      string `mapstructure:"dsn"` // For SQLite, this is the file path
 }
 
+// RedisConfig selects a standalone server (host and port), a Sentinel-managed master
+// (sentinel.master_name) or a Cluster (cluster_addrs)
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"` // Redis database number (default 0)
+	Host         string              `mapstructure:"host"`
+	Port         int                 `mapstructure:"port"`
+	Username     string              `mapstructure:"username"` // ACL user (Redis 6+), empty for the default user
+	Password     string              `mapstructure:"password"`
+	DB           int                 `mapstructure:"db"`            // Redis database number (default 0), not supported by Cluster
+	ClusterAddrs []string            `mapstructure:"cluster_addrs"` // host:port of Cluster nodes; enables Cluster mode
+	Sentinel     RedisSentinelConfig `mapstructure:"sentinel"`
+	TLS          RedisTLSConfig      `mapstructure:"tls"`
+	PoolSize     int                 `mapstructure:"pool_size"`      // Connections per node, 0 uses 10 per CPU
+	MinIdleConns int                 `mapstructure:"min_idle_conns"` // Idle connections kept open per node
+	DialTimeout  time.Duration       `mapstructure:"dial_timeout"`   // 0 uses 5s
+	ReadTimeout  time.Duration       `mapstructure:"read_timeout"`   // 0 uses 3s
+	WriteTimeout time.Duration       `mapstructure:"write_timeout"`  // 0 uses the read timeout
+	PoolTimeout  time.Duration       `mapstructure:"pool_timeout"`   // How long to wait for a free connection, 0 uses the read timeout + 1s
+}
+
+// RedisSentinelConfig locates a master through Redis Sentinel
+type RedisSentinelConfig struct {
+	MasterName string   `mapstructure:"master_name"` // Enables Sentinel mode
+	Addrs      []string `mapstructure:"addrs"`       // host:port of the sentinels
+	Username   string   `mapstructure:"username"`    // Sentinel ACL user, if different from the master's
+	Password   string   `mapstructure:"password"`    // Sentinel password, if different from the master's
+}
+
+// RedisTLSConfig enables TLS for Redis connections
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`              // PEM CA bundle, empty uses the system roots
+	CertFile           string `mapstructure:"cert_file"`            // PEM client certificate for mutual TLS
+	KeyFile            string `mapstructure:"key_file"`             // PEM client key for mutual TLS
+	ServerName         string `mapstructure:"server_name"`          // Overrides the name verified in the server certificate
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip certificate verification; development only
+}
+
+// CacheConfig controls response caching shared by all collections
+type CacheConfig struct {
+	Backend         string        `mapstructure:"backend"`           // "auto", "redis", "memory", "tiered" or "none"
+	MaxEntries      int           `mapstructure:"max_entries"`       // In-process cache: maximum number of cached resources
+	MaxBytes        int64         `mapstructure:"max_bytes"`         // In-process cache: maximum total size of cached responses
+	LocalTTL        time.Duration `mapstructure:"local_ttl"`         // Tiered cache: how long entries are kept in the in-process tier
+	DistributedLock bool          `mapstructure:"distributed_lock"`  // Coalesce upstream fetches across instances with a Redis lock
+	LockTimeout     time.Duration `mapstructure:"lock_timeout"`      // How long a fetch lock is held and waiting requests wait for it
+	TagHeader       string        `mapstructure:"tag_header"`        // Upstream response header listing surrogate keys for tag purges
+	ConsumerHeaders []string      `mapstructure:"consumer_headers"`  // Request headers identifying the consumer for per-consumer cache rules
+	CompressMinSize int           `mapstructure:"compress_min_size"` // Redis: compress bodies at least this large in bytes, 0 disables compression
+}
+
+// ProxyConfig controls how request and response bodies and WebSocket connections pass through the proxy
+type ProxyConfig struct {
+	MaxRequestBodySize   int64         `mapstructure:"max_request_body_size"`  // Larger requests are rejected with 413; collections can override it, 0 disables the limit
+	RequestBufferSize    int           `mapstructure:"request_buffer_size"`    // Bytes of a request body buffered for logging and cache keys; the rest is streamed
+	WebSocketIdleTimeout time.Duration `mapstructure:"websocket_idle_timeout"` // Close WebSocket connections without traffic in either direction for this long, 0 = never
+	WebSocketMaxDuration time.Duration `mapstructure:"websocket_max_duration"` // Close WebSocket connections open for longer, 0 = unlimited
 }
 
 type LogConfig struct {
-	Level      string `mapstructure:"level"`
-	MaxEntries int    `mapstructure:"max_entries"`
-	Rolling    bool   `mapstructure:"rolling"`
+	Level      string          `mapstructure:"level"`
+	MaxEntries int             `mapstructure:"max_entries"`
+	Rolling    bool            `mapstructure:"rolling"`
+	Redact     RedactConfig    `mapstructure:"redact"`
+	Retention  RetentionConfig `mapstructure:"retention"`
+}
+
+// RedactConfig controls which parts of a request log are masked before storage
+type RedactConfig struct {
+	Headers     []string `mapstructure:"headers"`       // Header names to mask (case-insensitive)
+	BodyPaths   []string `mapstructure:"body_paths"`    // JSON paths to mask in bodies, e.g. $.password, $.card.number
+	QueryParams []string `mapstructure:"query_params"`  // Regular expressions matched against query parameter names
+	MaxBodySize int      `mapstructure:"max_body_size"` // Maximum stored body size in bytes (0 = unlimited)
+	Mask        string   `mapstructure:"mask"`          // Replacement value for masked data
+}
+
+// RetentionConfig controls age-based and global retention of request logs
+type RetentionConfig struct {
+	MaxAgeDays int           `mapstructure:"max_age_days"` // Delete logs older than this many days (0 = keep forever)
+	MaxTotal   int           `mapstructure:"max_total"`    // Global cap on stored logs across all collections (0 = unlimited)
+	Archive    bool          `mapstructure:"archive"`      // Archive expired logs to compressed NDJSON before deletion
+	ArchiveDir string        `mapstructure:"archive_dir"`  // Directory for archive files
+	Interval   time.Duration `mapstructure:"interval"`     // How often the retention job runs, e.g. 1h
+	BatchSize  int           `mapstructure:"batch_size"`   // Rows archived and deleted per batch
+}
+
+// TracingConfig controls distributed tracing and OTLP span export
+type TracingConfig struct {
+	Enabled       bool              `mapstructure:"enabled"`
+	Endpoint      string            `mapstructure:"endpoint"` // OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	ServiceName   string            `mapstructure:"service_name"`
+	SampleRatio   float64           `mapstructure:"sample_ratio"` // Fraction of new traces sampled (incoming sampled flags are honored)
+	Headers       map[string]string `mapstructure:"headers"`      // Extra headers sent to the collector, e.g. auth tokens
+	BatchSize     int               `mapstructure:"batch_size"`
+	QueueSize     int               `mapstructure:"queue_size"`
+	FlushInterval time.Duration     `mapstructure:"flush_interval"`
+}
+
+// AnalyticsConfig controls the background job that maintains request rollups
+type AnalyticsConfig struct {
+	Interval             time.Duration `mapstructure:"interval"`               // How often new logs are rolled up
+	BatchSize            int           `mapstructure:"batch_size"`             // Logs read per batch
+	MinuteRetentionHours int           `mapstructure:"minute_retention_hours"` // How long minute rollups are kept
+	HourRetentionDays    int           `mapstructure:"hour_retention_days"`    // How long hour rollups are kept
+}
+
+// SLOConfig controls SLO evaluation
+type SLOConfig struct {
+	EvaluationInterval time.Duration `mapstructure:"evaluation_interval"` // How often burn rates are evaluated
+}
+
+// AlertingConfig controls alert rules and notification channels
+type AlertingConfig struct {
+	Cooldown           time.Duration    `mapstructure:"cooldown"`            // Minimum time between notifications for the same alert
+	EvaluationInterval time.Duration    `mapstructure:"evaluation_interval"` // How often spike rules are evaluated
+	Webhooks           []WebhookConfig  `mapstructure:"webhooks"`
+	Slack              []SlackConfig    `mapstructure:"slack"`
+	SMTP               SMTPConfig       `mapstructure:"smtp"`
+	Rules              AlertRulesConfig `mapstructure:"rules"`
+}
+
+// WebhookConfig is a generic JSON webhook channel
+type WebhookConfig struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// SlackConfig is a Slack-compatible incoming webhook channel
+type SlackConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"`
+	Channel    string `mapstructure:"channel"`
+	Username   string `mapstructure:"username"`
+}
+
+// SMTPConfig is an email channel; it is enabled when Host is set
+type SMTPConfig struct {
+	Host        string   `mapstructure:"host"`
+	Port        int      `mapstructure:"port"`
+	Username    string   `mapstructure:"username"`
+	Password    string   `mapstructure:"password"`
+	From        string   `mapstructure:"from"`
+	To          []string `mapstructure:"to"`
+	ImplicitTLS bool     `mapstructure:"implicit_tls"` // Connect over TLS (SMTPS) instead of STARTTLS; always used on port 465
+}
+
+// AlertRulesConfig enables and tunes the built-in alert rules
+type AlertRulesConfig struct {
+	Health       bool            `mapstructure:"health"` // Alert when a collection's health check goes down and when it recovers
+	ErrorRate    SpikeRuleConfig `mapstructure:"error_rate"`
+	Latency      SpikeRuleConfig `mapstructure:"latency"`
+	CacheFailure CacheRuleConfig `mapstructure:"cache_failure"`
+}
+
+// SpikeRuleConfig fires when a collection's value over Window exceeds Threshold and
+// is at least Factor times its value over the Baseline period before the window
+type SpikeRuleConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Threshold   float64       `mapstructure:"threshold"` // Minimum value that alerts: error rate as a fraction (e.g. 0.05), or p95 latency in milliseconds
+	Factor      float64       `mapstructure:"factor"`    // How many times the baseline value counts as a spike
+	Window      time.Duration `mapstructure:"window"`
+	Baseline    time.Duration `mapstructure:"baseline"`     // Period before the window the baseline is measured over
+	MinRequests int64         `mapstructure:"min_requests"` // Ignore windows with less traffic than this; a baseline with less traffic is ignored too
+}
+
+// CacheRuleConfig fires when cache backend operations fail repeatedly
+type CacheRuleConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Threshold int           `mapstructure:"threshold"` // Failures within Window that raise the alert
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// HealthConfig controls collection health checking
+type HealthConfig struct {
+	HistoryRetentionDays int           `mapstructure:"history_retention_days"` // How long health check results are kept
+	FailOpen             bool          `mapstructure:"fail_open"`              // Route traffic to collections whose state is still unknown
+	RestoreMaxAge        time.Duration `mapstructure:"restore_max_age"`        // Restore state on startup from check results newer than this (0 = never)
+}
+
+// DefaultConsumerHeaders identify the consumer of a request for per-consumer caching
+var DefaultConsumerHeaders = []string{"Authorization", "X-Api-Key"}
+
+// DefaultRedactHeaders are the headers masked when no deny-list is configured
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
 }
 
 func LoadConfig() *Config {
@@ -58,19 +243,88 @@ func LoadConfig() *Config {
 
 	// Enable automatic environment variable reading
 	viper.AutomaticEnv()
-	
+
 	// Set environment variable prefix (optional, for better organization)
 	viper.SetEnvPrefix("")
-	
+
 	// Replace dots and dashes with underscores in env var names
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
-	
+
 	// Bind environment variables to config keys
 	bindEnvVars()
-	
+
 	// Set default for enable_frontend
 	viper.SetDefault("enable_frontend", true)
 
+	// Set default for cleartext HTTP/2
+	viper.SetDefault("server.h2c", false)
+
+	// Set defaults for the response cache
+	viper.SetDefault("cache.backend", "auto")
+	viper.SetDefault("cache.max_entries", 10000)
+	viper.SetDefault("cache.max_bytes", 64<<20)
+	viper.SetDefault("cache.local_ttl", "5s")
+	viper.SetDefault("cache.lock_timeout", "5s")
+	viper.SetDefault("cache.tag_header", "Surrogate-Key")
+	viper.SetDefault("cache.consumer_headers", DefaultConsumerHeaders)
+	viper.SetDefault("cache.compress_min_size", 1024)
+
+	// Set defaults for log redaction
+	viper.SetDefault("log.redact.headers", DefaultRedactHeaders)
+	viper.SetDefault("log.redact.max_body_size", 65536)
+	viper.SetDefault("log.redact.mask", "[REDACTED]")
+
+	// Set defaults for log retention
+	viper.SetDefault("log.retention.archive_dir", "archive")
+	viper.SetDefault("log.retention.interval", "1h")
+	viper.SetDefault("log.retention.batch_size", 1000)
+
+	// Set defaults for tracing
+	viper.SetDefault("tracing.service_name", "midgard-gateway")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("tracing.flush_interval", "5s")
+
+	// Set defaults for analytics rollups
+	viper.SetDefault("analytics.interval", "1m")
+	viper.SetDefault("analytics.batch_size", 5000)
+	viper.SetDefault("analytics.minute_retention_hours", 48)
+	viper.SetDefault("analytics.hour_retention_days", 90)
+
+	// Set default for SLO evaluation
+	viper.SetDefault("slo.evaluation_interval", "1m")
+
+	// Set defaults for alerting
+	viper.SetDefault("alerting.cooldown", "15m")
+	viper.SetDefault("alerting.evaluation_interval", "1m")
+	viper.SetDefault("alerting.smtp.port", 587)
+	viper.SetDefault("alerting.rules.health", true)
+	viper.SetDefault("alerting.rules.error_rate.enabled", true)
+	viper.SetDefault("alerting.rules.error_rate.threshold", 0.05)
+	viper.SetDefault("alerting.rules.error_rate.factor", 3)
+	viper.SetDefault("alerting.rules.error_rate.window", "5m")
+	viper.SetDefault("alerting.rules.error_rate.baseline", "1h")
+	viper.SetDefault("alerting.rules.error_rate.min_requests", 20)
+	viper.SetDefault("alerting.rules.latency.enabled", true)
+	viper.SetDefault("alerting.rules.latency.threshold", 2000)
+	viper.SetDefault("alerting.rules.latency.factor", 3)
+	viper.SetDefault("alerting.rules.latency.window", "5m")
+	viper.SetDefault("alerting.rules.latency.baseline", "1h")
+	viper.SetDefault("alerting.rules.latency.min_requests", 20)
+	viper.SetDefault("alerting.rules.cache_failure.enabled", true)
+	viper.SetDefault("alerting.rules.cache_failure.threshold", 5)
+	viper.SetDefault("alerting.rules.cache_failure.window", "5m")
+
+	// Set defaults for body streaming
+	viper.SetDefault("proxy.max_request_body_size", 0)
+	viper.SetDefault("proxy.request_buffer_size", 64<<10)
+	viper.SetDefault("proxy.websocket_idle_timeout", "5m")
+	viper.SetDefault("proxy.websocket_max_duration", 0)
+
+	// Set defaults for health checks
+	viper.SetDefault("health.history_retention_days", 7)
+	viper.SetDefault("health.fail_open", true)
+	viper.SetDefault("health.restore_max_age", "10m")
+
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("Warning: Failed to read config file: %v", err)
 		// Use default values
@@ -88,10 +342,64 @@ func LoadConfig() *Config {
 				Password: "",
 				DB:       0,
 			},
+			Cache: CacheConfig{
+				Backend:         "auto",
+				MaxEntries:      10000,
+				MaxBytes:        64 << 20,
+				LocalTTL:        5 * time.Second,
+				LockTimeout:     5 * time.Second,
+				TagHeader:       "Surrogate-Key",
+				ConsumerHeaders: DefaultConsumerHeaders,
+				CompressMinSize: 1024,
+			},
+			Proxy: ProxyConfig{
+				RequestBufferSize:    64 << 10,
+				WebSocketIdleTimeout: 5 * time.Minute,
+			},
 			Log: LogConfig{
 				Level:      "info",
 				MaxEntries: 1000,
 				Rolling:    true,
+				Redact: RedactConfig{
+					Headers:     DefaultRedactHeaders,
+					MaxBodySize: 65536,
+					Mask:        "[REDACTED]",
+				},
+				Retention: RetentionConfig{
+					ArchiveDir: "archive",
+					Interval:   time.Hour,
+					BatchSize:  1000,
+				},
+			},
+			Tracing: TracingConfig{
+				ServiceName:   "midgard-gateway",
+				SampleRatio:   1.0,
+				FlushInterval: 5 * time.Second,
+			},
+			Analytics: AnalyticsConfig{
+				Interval:             time.Minute,
+				BatchSize:            5000,
+				MinuteRetentionHours: 48,
+				HourRetentionDays:    90,
+			},
+			SLO: SLOConfig{
+				EvaluationInterval: time.Minute,
+			},
+			Alerting: AlertingConfig{
+				Cooldown:           15 * time.Minute,
+				EvaluationInterval: time.Minute,
+				SMTP:               SMTPConfig{Port: 587},
+				Rules: AlertRulesConfig{
+					Health:       true,
+					ErrorRate:    SpikeRuleConfig{Enabled: true, Threshold: 0.05, Factor: 3, Window: 5 * time.Minute, Baseline: time.Hour, MinRequests: 20},
+					Latency:      SpikeRuleConfig{Enabled: true, Threshold: 2000, Factor: 3, Window: 5 * time.Minute, Baseline: time.Hour, MinRequests: 20},
+					CacheFailure: CacheRuleConfig{Enabled: true, Threshold: 5, Window: 5 * time.Minute},
+				},
+			},
+			Health: HealthConfig{
+				HistoryRetentionDays: 7,
+				FailOpen:             true,
+				RestoreMaxAge:        10 * time.Minute,
 			},
 			EnableFrontend: true, // Default to true
 		}
@@ -109,7 +417,8 @@ func LoadConfig() *Config {
 func bindEnvVars() {
 	// Server config
 	viper.BindEnv("server.port", "PORT")
-	
+	viper.BindEnv("server.h2c", "SERVER_H2C")
+
 	// Database config
 	viper.BindEnv("database.type", "DATABASE_TYPE")
 	viper.BindEnv("database.host", "DATABASE_HOST")
@@ -118,21 +427,63 @@ func bindEnvVars() {
 	viper.BindEnv("database.password", "DATABASE_PASSWORD")
 	viper.BindEnv("database.dbname", "DATABASE_DBNAME")
 	viper.BindEnv("database.dsn", "DATABASE_DSN")
-	
+
 	// Redis config
 	viper.BindEnv("redis.host", "REDIS_HOST")
 	viper.BindEnv("redis.port", "REDIS_PORT")
 	viper.BindEnv("redis.password", "REDIS_PASSWORD")
 	viper.BindEnv("redis.db", "REDIS_DB")
-	
+	viper.BindEnv("redis.username", "REDIS_USERNAME")
+	viper.BindEnv("redis.cluster_addrs", "REDIS_CLUSTER_ADDRS")
+	viper.BindEnv("redis.sentinel.master_name", "REDIS_SENTINEL_MASTER_NAME")
+	viper.BindEnv("redis.sentinel.addrs", "REDIS_SENTINEL_ADDRS")
+	viper.BindEnv("redis.sentinel.password", "REDIS_SENTINEL_PASSWORD")
+	viper.BindEnv("redis.tls.enabled", "REDIS_TLS_ENABLED")
+	viper.BindEnv("redis.tls.ca_file", "REDIS_TLS_CA_FILE")
+	viper.BindEnv("redis.tls.cert_file", "REDIS_TLS_CERT_FILE")
+	viper.BindEnv("redis.tls.key_file", "REDIS_TLS_KEY_FILE")
+	viper.BindEnv("redis.tls.insecure_skip_verify", "REDIS_TLS_INSECURE_SKIP_VERIFY")
+
+	// Cache config
+	viper.BindEnv("cache.backend", "CACHE_BACKEND")
+	viper.BindEnv("cache.max_entries", "CACHE_MAX_ENTRIES")
+	viper.BindEnv("cache.max_bytes", "CACHE_MAX_BYTES")
+	viper.BindEnv("cache.local_ttl", "CACHE_LOCAL_TTL")
+	viper.BindEnv("cache.distributed_lock", "CACHE_DISTRIBUTED_LOCK")
+	viper.BindEnv("cache.lock_timeout", "CACHE_LOCK_TIMEOUT")
+	viper.BindEnv("cache.compress_min_size", "CACHE_COMPRESS_MIN_SIZE")
+
+	// Proxy config
+	viper.BindEnv("proxy.max_request_body_size", "PROXY_MAX_REQUEST_BODY_SIZE")
+	viper.BindEnv("proxy.request_buffer_size", "PROXY_REQUEST_BUFFER_SIZE")
+	viper.BindEnv("proxy.websocket_idle_timeout", "PROXY_WEBSOCKET_IDLE_TIMEOUT")
+	viper.BindEnv("proxy.websocket_max_duration", "PROXY_WEBSOCKET_MAX_DURATION")
+
 	// Log config
 	viper.BindEnv("log.level", "LOG_LEVEL")
 	viper.BindEnv("log.max_entries", "LOG_MAX_ENTRIES")
 	viper.BindEnv("log.rolling", "LOG_ROLLING")
-	
+	viper.BindEnv("log.redact.max_body_size", "LOG_REDACT_MAX_BODY_SIZE")
+	viper.BindEnv("log.retention.max_age_days", "LOG_RETENTION_MAX_AGE_DAYS")
+	viper.BindEnv("log.retention.max_total", "LOG_RETENTION_MAX_TOTAL")
+	viper.BindEnv("log.retention.archive", "LOG_RETENTION_ARCHIVE")
+	viper.BindEnv("log.retention.archive_dir", "LOG_RETENTION_ARCHIVE_DIR")
+	viper.BindEnv("log.retention.interval", "LOG_RETENTION_INTERVAL")
+
+	// Tracing config
+	viper.BindEnv("tracing.enabled", "TRACING_ENABLED")
+	viper.BindEnv("tracing.endpoint", "TRACING_ENDPOINT")
+	viper.BindEnv("tracing.service_name", "TRACING_SERVICE_NAME")
+	viper.BindEnv("tracing.sample_ratio", "TRACING_SAMPLE_RATIO")
+
+	// Alerting config
+	viper.BindEnv("alerting.smtp.host", "ALERTING_SMTP_HOST")
+	viper.BindEnv("alerting.smtp.username", "ALERTING_SMTP_USERNAME")
+	viper.BindEnv("alerting.smtp.password", "ALERTING_SMTP_PASSWORD")
+
 	// Frontend config
 	viper.BindEnv("enable_frontend", "ENABLE_FRONTEND")
-	
+
 	// Also support direct environment variable access
 	// This allows environment variables to override config file values
 	if port := os.Getenv("PORT"); port != "" {
@@ -0,0 +1,289 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// Severity levels
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Alert states
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// notifyTimeout bounds how long a single notifier may take to deliver an alert
+const notifyTimeout = 10 * time.Second
+
+// Alert is a condition raised by a rule
+type Alert struct {
+	Key         string            `json:"key"`  // Identifies the condition; repeated fires with the same key update one alert
+	Rule        string            `json:"rule"` // Rule that raised the alert, e.g. slo_burn_rate
+	Severity    string            `json:"severity"`
+	Status      string            `json:"status"`
+	Summary     string            `json:"summary"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Value       float64           `json:"value"`
+	StartsAt    time.Time         `json:"starts_at"`
+	EndsAt      *time.Time        `json:"ends_at,omitempty"`
+	Notified    bool              `json:"notified"` // False when the notification was suppressed by the cooldown
+}
+
+// Notifier delivers alerts to an external channel
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// LogNotifier writes alerts to the process log
+type LogNotifier struct{}
+
+// Name returns the notifier name
+func (LogNotifier) Name() string { return "log" }
+
+// Notify logs the alert
+func (LogNotifier) Notify(ctx context.Context, a Alert) error {
+	log.Printf("Alert %s [%s] %s: %s", a.Status, a.Severity, a.Key, a.Summary)
+	return nil
+}
+
+// Manager tracks active alerts, records them in the alert history and notifies on
+// firing and resolution. Repeated fires of an active alert are deduplicated, and an
+// alert that fires again within the cooldown of its last notification is recorded
+// without notifying.
+type Manager struct {
+	db           *gorm.DB
+	cooldown     time.Duration
+	mu           sync.Mutex
+	active       map[string]*activeAlert
+	lastNotified map[string]time.Time
+	notifiers    []Notifier
+}
+
+type activeAlert struct {
+	Alert
+	historyID uint
+}
+
+// NewManager creates an alert manager delivering to the given notifiers.
+// Alerts left firing in the history by a previous run are marked resolved;
+// rules raise them again if the condition persists.
+func NewManager(db *gorm.DB, cooldown time.Duration, notifiers ...Notifier) *Manager {
+	now := time.Now()
+	if err := db.Model(&database.AlertHistory{}).Where("status = ?", StatusFiring).
+		Updates(map[string]interface{}{"status": StatusResolved, "ends_at": now}).Error; err != nil {
+		log.Printf("Failed to close stale alerts: %v", err)
+	}
+
+	return &Manager{
+		db:           db,
+		cooldown:     cooldown,
+		active:       make(map[string]*activeAlert),
+		lastNotified: make(map[string]time.Time),
+		notifiers:    notifiers,
+	}
+}
+
+// AddNotifier registers an additional notifier
+func (m *Manager) AddNotifier(n Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifiers = append(m.notifiers, n)
+}
+
+// Notifiers returns the names of the registered notifiers
+func (m *Manager) Notifiers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.notifiers))
+	for _, n := range m.notifiers {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+// Fire raises an alert. An alert that is already active only has its value and
+// text updated; notifiers are called when it first fires, unless it is in cooldown.
+// The history is written outside the lock, since rules may fire from the request path.
+func (m *Manager) Fire(a Alert) {
+	m.mu.Lock()
+	if existing, ok := m.active[a.Key]; ok {
+		existing.Value = a.Value
+		existing.Summary = a.Summary
+		existing.Description = a.Description
+		m.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	a.Status = StatusFiring
+	if a.StartsAt.IsZero() {
+		a.StartsAt = now
+	}
+	a.EndsAt = nil
+	a.Notified = m.cooldown <= 0 || now.Sub(m.lastNotified[a.Key]) >= m.cooldown
+	if a.Notified {
+		m.lastNotified[a.Key] = now
+	}
+
+	stored := &activeAlert{Alert: a}
+	m.active[a.Key] = stored
+	notifiers := m.notifiers
+	m.mu.Unlock()
+
+	entry := historyEntry(a)
+	if err := m.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record alert %s: %v", a.Key, err)
+	} else {
+		m.setHistoryID(stored, entry.ID)
+	}
+
+	if a.Notified {
+		m.notify(notifiers, a)
+	} else {
+		log.Printf("Alert %s fired during cooldown, notification suppressed", a.Key)
+	}
+}
+
+// setHistoryID links an active alert to its history row. If the alert was resolved
+// while the row was being written, the resolution is recorded now.
+func (m *Manager) setHistoryID(stored *activeAlert, id uint) {
+	m.mu.Lock()
+	stored.historyID = id
+	resolved := m.active[stored.Key] != stored
+	endsAt, value := stored.EndsAt, stored.Value
+	m.mu.Unlock()
+
+	if resolved {
+		m.recordResolution(stored.Key, id, *endsAt, value)
+	}
+}
+
+// Resolve resolves an active alert and notifies if its firing was notified; unknown keys are ignored
+func (m *Manager) Resolve(key string) {
+	m.mu.Lock()
+	existing, ok := m.active[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.active, key)
+	now := time.Now()
+	existing.EndsAt = &now
+	a := existing.Alert
+	a.Status = StatusResolved
+	historyID := existing.historyID
+	notifiers := m.notifiers
+	m.mu.Unlock()
+
+	// A history ID of 0 means Fire is still writing the row; it records the resolution itself
+	if historyID != 0 {
+		m.recordResolution(key, historyID, now, a.Value)
+	}
+	if a.Notified {
+		m.notify(notifiers, a)
+	}
+}
+
+// recordResolution marks an alert's history row as resolved
+func (m *Manager) recordResolution(key string, historyID uint, endsAt time.Time, value float64) {
+	if err := m.db.Model(&database.AlertHistory{}).Where("id = ?", historyID).
+		Updates(map[string]interface{}{"status": StatusResolved, "ends_at": endsAt, "value": value}).Error; err != nil {
+		log.Printf("Failed to record resolution of alert %s: %v", key, err)
+	}
+}
+
+// Test sends a test alert through every notifier synchronously and returns
+// the delivery error of each notifier by name ("" on success)
+func (m *Manager) Test(ctx context.Context) map[string]string {
+	m.mu.Lock()
+	notifiers := m.notifiers
+	m.mu.Unlock()
+
+	a := Alert{
+		Key:      "test",
+		Rule:     "test",
+		Severity: SeverityInfo,
+		Status:   StatusFiring,
+		Summary:  "Test notification from Midgard Gateway",
+		StartsAt: time.Now(),
+		Notified: true,
+	}
+	results := make(map[string]string, len(notifiers))
+	for _, n := range notifiers {
+		ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		results[n.Name()] = ""
+		if err := n.Notify(ctx, a); err != nil {
+			results[n.Name()] = err.Error()
+		}
+		cancel()
+	}
+	return results
+}
+
+// IsActive reports whether an alert with the key is firing
+func (m *Manager) IsActive(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.active[key]
+	return ok
+}
+
+// Active returns the firing alerts, most recent first
+func (m *Manager) Active() []Alert {
+	m.mu.Lock()
+	alerts := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		alerts = append(alerts, a.Alert)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].StartsAt.After(alerts[j].StartsAt)
+	})
+	return alerts
+}
+
+// historyEntry converts an alert to its history row
+func historyEntry(a Alert) database.AlertHistory {
+	labels, _ := json.Marshal(a.Labels)
+	return database.AlertHistory{
+		Key:         a.Key,
+		Rule:        a.Rule,
+		Severity:    a.Severity,
+		Status:      a.Status,
+		Summary:     a.Summary,
+		Description: a.Description,
+		Labels:      string(labels),
+		Value:       a.Value,
+		Notified:    a.Notified,
+		StartsAt:    a.StartsAt,
+	}
+}
+
+// notify delivers an alert to every notifier in the background so rules never block on slow channels
+func (m *Manager) notify(notifiers []Notifier, a Alert) {
+	for _, n := range notifiers {
+		go func(n Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, a); err != nil {
+				log.Printf("Failed to deliver alert %s via %s: %v", a.Key, n.Name(), err)
+			}
+		}(n)
+	}
+}
@@ -0,0 +1,234 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/analytics"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "alert.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return db
+}
+
+// recorder is a notifier that hands delivered alerts to the test
+type recorder chan Alert
+
+func (recorder) Name() string { return "recorder" }
+
+func (r recorder) Notify(ctx context.Context, a Alert) error {
+	r <- a
+	return nil
+}
+
+func (r recorder) next(t *testing.T) Alert {
+	t.Helper()
+	select {
+	case a := <-r:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification")
+		return Alert{}
+	}
+}
+
+func (r recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case a := <-r:
+		t.Fatalf("unexpected notification %s %s", a.Key, a.Status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFireAndResolve(t *testing.T) {
+	db := newTestDB(t)
+	notes := make(recorder, 10)
+	m := NewManager(db, time.Hour, notes)
+
+	m.Fire(Alert{Key: "k", Rule: "r", Severity: SeverityWarning, Summary: "first", Value: 1})
+	if a := notes.next(t); a.Status != StatusFiring || a.Summary != "first" {
+		t.Fatalf("firing notification %+v", a)
+	}
+
+	// Repeated fires update the active alert without notifying again
+	m.Fire(Alert{Key: "k", Rule: "r", Summary: "second", Value: 2})
+	notes.none(t)
+	if active := m.Active(); len(active) != 1 || active[0].Summary != "second" || active[0].Value != 2 {
+		t.Fatalf("active alerts %+v", active)
+	}
+
+	m.Resolve("k")
+	if a := notes.next(t); a.Status != StatusResolved || a.EndsAt == nil {
+		t.Fatalf("resolved notification %+v", a)
+	}
+	var history []database.AlertHistory
+	db.Find(&history)
+	if len(history) != 1 || history[0].Status != StatusResolved || history[0].Value != 2 || history[0].EndsAt == nil {
+		t.Fatalf("history %+v", history)
+	}
+
+	// Firing again within the cooldown is recorded but not notified
+	m.Fire(Alert{Key: "k", Rule: "r", Summary: "again"})
+	notes.none(t)
+	m.Resolve("k")
+	notes.none(t)
+	history = nil
+	db.Order("id").Find(&history)
+	if len(history) != 2 || history[1].Notified || history[1].Status != StatusResolved {
+		t.Fatalf("history after cooldown %+v", history)
+	}
+}
+
+func TestConcurrentFireAndResolveKeepHistoryConsistent(t *testing.T) {
+	db := newTestDB(t)
+	m := NewManager(db, 0)
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 25; j++ {
+				m.Fire(Alert{Key: "k", Rule: "r"})
+				m.Resolve("k")
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	var firing int64
+	db.Model(&database.AlertHistory{}).Where("status = ?", StatusFiring).Count(&firing)
+	if firing != 0 || m.IsActive("k") {
+		t.Fatalf("%d history rows left firing, active %v", firing, m.IsActive("k"))
+	}
+}
+
+func TestEmailSubjectCannotInjectHeaders(t *testing.T) {
+	a := Alert{Status: StatusFiring, Severity: SeverityCritical, Summary: "Collection \"x\r\nBcc: victim@example.com\" is down ✗"}
+	msg, err := mail.ReadMessage(strings.NewReader(string(emailMessage("gw@example.com", []string{"ops@example.com"}, a))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Fatal("summary injected a Bcc header")
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[FIRING][critical] "+a.Summary {
+		t.Fatalf("subject %q", subject)
+	}
+}
+
+func TestSMTPImplicitTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	firstByte := make(chan byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := bufio.NewReader(conn).ReadByte()
+		firstByte <- b
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	n := &SMTPNotifier{cfg: config.SMTPConfig{Host: addr.IP.String(), Port: addr.Port, ImplicitTLS: true, From: "gw@example.com", To: []string{"ops@example.com"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go n.Notify(ctx, Alert{Summary: "x"})
+
+	// With implicit TLS the client speaks first, opening with a TLS handshake record
+	select {
+	case b := <-firstByte:
+		if b != 0x16 {
+			t.Fatalf("first byte %#x, want a TLS handshake", b)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client waited for a plain-text greeting")
+	}
+}
+
+func TestSpikeRulesCompareWithBaseline(t *testing.T) {
+	tests := []struct {
+		name             string
+		baselineRequests int64
+		baselineErrors   int64
+		errors           int64
+		firing           bool
+	}{
+		{"steady high error rate", 1000, 80, 10, false},
+		{"spike over a low baseline", 1000, 10, 10, true},
+		{"no baseline traffic", 0, 0, 10, true},
+		{"below the threshold", 1000, 0, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			db.Create(&database.Collection{ID: "c1", Name: "shop", Prefix: "shop", BaseURL: "http://upstream", Active: true})
+			now := time.Now()
+			addRollup(t, db, now.Add(-2*time.Minute), 100, tt.errors)
+			if tt.baselineRequests > 0 {
+				addRollup(t, db, now.Add(-30*time.Minute), tt.baselineRequests, tt.baselineErrors)
+			}
+
+			alerts := NewManager(db, 0)
+			m := NewMonitor(db, alerts, &config.AlertingConfig{Rules: config.AlertRulesConfig{
+				ErrorRate: config.SpikeRuleConfig{Enabled: true, Threshold: 0.05, MinRequests: 20},
+			}})
+			m.Evaluate()
+			if firing := alerts.IsActive(RuleErrorRate + ":c1"); firing != tt.firing {
+				t.Fatalf("firing = %v, want %v", firing, tt.firing)
+			}
+		})
+	}
+}
+
+// addRollup stores a minute rollup with the given traffic
+func addRollup(t *testing.T, db *gorm.DB, ts time.Time, requests, errors int64) {
+	t.Helper()
+	hist := make([]int64, len(analytics.LatencyBounds)+1)
+	hist[0] = requests
+	data, _ := json.Marshal(hist)
+	r := database.RequestRollup{
+		CollectionID: "c1",
+		Granularity:  analytics.Minute,
+		BucketStart:  ts.Truncate(time.Minute),
+		Path:         "/items",
+		Method:       "GET",
+		RequestCount: requests,
+		Status2xx:    requests - errors,
+		Status5xx:    errors,
+		DurationMax:  5,
+		Histogram:    string(data),
+	}
+	if err := db.Create(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,266 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/analytics"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// Built-in rule names
+const (
+	RuleHealth       = "health"
+	RuleErrorRate    = "error_rate"
+	RuleLatency      = "latency"
+	RuleCacheFailure = "cache_failure"
+)
+
+// Monitor implements the built-in alert rules: collection health transitions,
+// error-rate and latency spikes, and cache backend failures. All methods are
+// safe to call on nil.
+type Monitor struct {
+	db       *gorm.DB
+	alerts   *Manager
+	rules    config.AlertRulesConfig
+	interval time.Duration
+
+	mu             sync.Mutex
+	cacheFailures  []time.Time
+	lastCacheError string
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMonitor creates the rule monitor
+func NewMonitor(db *gorm.DB, alerts *Manager, cfg *config.AlertingConfig) *Monitor {
+	interval := cfg.EvaluationInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	rules := cfg.Rules
+	if rules.CacheFailure.Window <= 0 {
+		rules.CacheFailure.Window = 5 * time.Minute
+	}
+	if rules.CacheFailure.Threshold <= 0 {
+		rules.CacheFailure.Threshold = 1
+	}
+	for _, spike := range []*config.SpikeRuleConfig{&rules.ErrorRate, &rules.Latency} {
+		if spike.Window <= 0 {
+			spike.Window = 5 * time.Minute
+		}
+		if spike.Baseline <= 0 {
+			spike.Baseline = time.Hour
+		}
+		if spike.Factor <= 0 {
+			spike.Factor = 3
+		}
+	}
+	return &Monitor{
+		db:       db,
+		alerts:   alerts,
+		rules:    rules,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start starts evaluating the spike and cache rules periodically
+func (m *Monitor) Start() {
+	if m == nil {
+		return
+	}
+	go m.run()
+}
+
+// Stop stops the evaluation loop
+func (m *Monitor) Stop() {
+	if m == nil {
+		return
+	}
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
+}
+
+func (m *Monitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Evaluate()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// HealthChanged raises an alert when a collection's health check goes down and
+// resolves it, notifying the recovery, when it comes back up
+func (m *Monitor) HealthChanged(collectionID string, healthy bool, url string) {
+	if m == nil || !m.rules.Health {
+		return
+	}
+	key := RuleHealth + ":" + collectionID
+	if healthy {
+		m.alerts.Resolve(key)
+		return
+	}
+
+	name := m.collectionName(collectionID)
+	m.alerts.Fire(Alert{
+		Key:         key,
+		Rule:        RuleHealth,
+		Severity:    SeverityCritical,
+		Summary:     fmt.Sprintf("Collection %q is unhealthy", name),
+		Description: fmt.Sprintf("Health check %s is failing.", url),
+		Labels:      map[string]string{"collection_id": collectionID, "collection": name},
+	})
+}
+
+// CacheError records a failed cache backend operation and raises an alert once
+// the configured number of failures occurs within the window
+func (m *Monitor) CacheError(op string, err error) {
+	if m == nil || !m.rules.CacheFailure.Enabled {
+		return
+	}
+	m.mu.Lock()
+	now := time.Now()
+	m.cacheFailures = append(trimBefore(m.cacheFailures, now.Add(-m.rules.CacheFailure.Window)), now)
+	m.lastCacheError = fmt.Sprintf("%s: %v", op, err)
+	count := len(m.cacheFailures)
+	lastError := m.lastCacheError
+	m.mu.Unlock()
+
+	if count >= m.rules.CacheFailure.Threshold {
+		m.alerts.Fire(Alert{
+			Key:         RuleCacheFailure + ":redis",
+			Rule:        RuleCacheFailure,
+			Severity:    SeverityWarning,
+			Summary:     fmt.Sprintf("%d cache operations failed in the last %s", count, m.rules.CacheFailure.Window),
+			Description: "Last error: " + lastError,
+			Labels:      map[string]string{"backend": "redis"},
+			Value:       float64(count),
+		})
+	}
+}
+
+// Evaluate checks the error-rate and latency rules for every active collection
+// and resolves the cache alert once no failures remain in its window
+func (m *Monitor) Evaluate() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.cacheFailures = trimBefore(m.cacheFailures, time.Now().Add(-m.rules.CacheFailure.Window))
+	cacheFailures := len(m.cacheFailures)
+	m.mu.Unlock()
+	if cacheFailures == 0 {
+		m.alerts.Resolve(RuleCacheFailure + ":redis")
+	}
+
+	if !m.rules.ErrorRate.Enabled && !m.rules.Latency.Enabled {
+		return
+	}
+	var collections []database.Collection
+	if err := m.db.Select("id", "name").Where("active = ?", true).Find(&collections).Error; err != nil {
+		log.Printf("Alert rule evaluation failed: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool, len(collections))
+	for _, coll := range collections {
+		seen[coll.ID] = true
+		m.evaluateSpike(coll, RuleErrorRate, m.rules.ErrorRate, func(s analytics.Stats) float64 { return s.ErrorRate })
+		m.evaluateSpike(coll, RuleLatency, m.rules.Latency, func(s analytics.Stats) float64 { return s.P95 })
+	}
+
+	// Resolve spike alerts of collections that were deleted or deactivated
+	for _, a := range m.alerts.Active() {
+		if (a.Rule == RuleErrorRate || a.Rule == RuleLatency) && !seen[a.Labels["collection_id"]] {
+			m.alerts.Resolve(a.Key)
+		}
+	}
+}
+
+// evaluateSpike fires or resolves one spike rule for one collection. A spike is a
+// value above the rule's threshold that is also at least Factor times the value over
+// the baseline period before the window; without enough baseline traffic only the
+// threshold applies.
+func (m *Monitor) evaluateSpike(coll database.Collection, rule string, cfg config.SpikeRuleConfig, value func(analytics.Stats) float64) {
+	key := rule + ":" + coll.ID
+	if !cfg.Enabled {
+		m.alerts.Resolve(key)
+		return
+	}
+
+	now := time.Now()
+	start := now.Add(-cfg.Window)
+	stats, _, err := analytics.Summary(m.db, analytics.Query{CollectionID: coll.ID, From: start, To: now})
+	if err != nil {
+		log.Printf("Alert rule %s evaluation failed for collection %s: %v", rule, coll.ID, err)
+		return
+	}
+	v := value(stats)
+	if stats.RequestCount < cfg.MinRequests || v <= cfg.Threshold {
+		m.alerts.Resolve(key)
+		return
+	}
+
+	baselineStats, _, err := analytics.Summary(m.db, analytics.Query{CollectionID: coll.ID, From: start.Add(-cfg.Baseline), To: start})
+	if err != nil {
+		log.Printf("Alert rule %s evaluation failed for collection %s: %v", rule, coll.ID, err)
+		return
+	}
+	var baseline float64
+	if baselineStats.RequestCount >= cfg.MinRequests {
+		baseline = value(baselineStats)
+	}
+	if v < cfg.Factor*baseline {
+		m.alerts.Resolve(key)
+		return
+	}
+
+	a := Alert{
+		Key:      key,
+		Rule:     rule,
+		Severity: SeverityWarning,
+		Labels:   map[string]string{"collection_id": coll.ID, "collection": coll.Name},
+		Value:    v,
+	}
+	if rule == RuleErrorRate {
+		a.Summary = fmt.Sprintf("Collection %q error rate is %.1f%%", coll.Name, 100*v)
+		a.Description = fmt.Sprintf("%d of %d requests failed with 5xx in the last %s (baseline %.1f%% over the %s before, threshold %.1f%%).",
+			stats.ErrorCount, stats.RequestCount, cfg.Window, 100*baseline, cfg.Baseline, 100*cfg.Threshold)
+	} else {
+		a.Summary = fmt.Sprintf("Collection %q p95 latency is %.0fms", coll.Name, v)
+		a.Description = fmt.Sprintf("p95 latency over %d requests in the last %s exceeds %.0fms (baseline %.0fms over the %s before).",
+			stats.RequestCount, cfg.Window, cfg.Threshold, baseline, cfg.Baseline)
+	}
+	m.alerts.Fire(a)
+}
+
+func (m *Monitor) collectionName(id string) string {
+	var coll database.Collection
+	if err := m.db.Select("name").Where("id = ?", id).First(&coll).Error; err != nil || coll.Name == "" {
+		return id
+	}
+	return coll.Name
+}
+
+// trimBefore drops timestamps older than cutoff from an ordered slice
+func trimBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,244 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midgard/gateway/config"
+)
+
+// NewNotifiers creates the notifiers configured in the alerting section.
+// Alerts are always written to the process log as well.
+func NewNotifiers(cfg *config.AlertingConfig) []Notifier {
+	notifiers := []Notifier{LogNotifier{}}
+	client := &http.Client{Timeout: notifyTimeout}
+	for _, w := range cfg.Webhooks {
+		if w.URL != "" {
+			notifiers = append(notifiers, &WebhookNotifier{URL: w.URL, Headers: w.Headers, client: client})
+		}
+	}
+	for _, s := range cfg.Slack {
+		if s.WebhookURL != "" {
+			notifiers = append(notifiers, &SlackNotifier{WebhookURL: s.WebhookURL, Channel: s.Channel, Username: s.Username, client: client})
+		}
+	}
+	if cfg.SMTP.Host != "" && len(cfg.SMTP.To) > 0 {
+		notifiers = append(notifiers, &SMTPNotifier{cfg: cfg.SMTP})
+	}
+	return notifiers
+}
+
+// WebhookNotifier posts each alert as JSON to a URL
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	client  *http.Client
+}
+
+// Name returns the notifier name
+func (w *WebhookNotifier) Name() string { return "webhook:" + hostOf(w.URL) }
+
+// Notify posts the alert
+func (w *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	return postJSON(ctx, w.client, w.URL, w.Headers, a)
+}
+
+// SlackNotifier posts alerts to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Channel    string
+	Username   string
+	client     *http.Client
+}
+
+// Name returns the notifier name
+func (s *SlackNotifier) Name() string { return "slack:" + hostOf(s.WebhookURL) }
+
+// Notify posts the alert as a Slack message with a colored attachment
+func (s *SlackNotifier) Notify(ctx context.Context, a Alert) error {
+	color := "#2eb886" // resolved
+	if a.Status == StatusFiring {
+		switch a.Severity {
+		case SeverityCritical:
+			color = "#d00000"
+		case SeverityWarning:
+			color = "#daa038"
+		default:
+			color = "#439fe0"
+		}
+	}
+
+	fields := make([]map[string]interface{}, 0, len(a.Labels))
+	for _, k := range sortedKeys(a.Labels) {
+		fields = append(fields, map[string]interface{}{"title": k, "value": a.Labels[k], "short": true})
+	}
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf("[%s] %s", strings.ToUpper(a.Status), a.Summary),
+		"attachments": []map[string]interface{}{{
+			"color":  color,
+			"title":  fmt.Sprintf("%s (%s)", a.Rule, a.Severity),
+			"text":   a.Description,
+			"fields": fields,
+			"ts":     a.StartsAt.Unix(),
+		}},
+	}
+	if s.Channel != "" {
+		payload["channel"] = s.Channel
+	}
+	if s.Username != "" {
+		payload["username"] = s.Username
+	}
+	return postJSON(ctx, s.client, s.WebhookURL, nil, payload)
+}
+
+// SMTPNotifier emails alerts
+type SMTPNotifier struct {
+	cfg config.SMTPConfig
+}
+
+// Name returns the notifier name
+func (s *SMTPNotifier) Name() string { return "smtp:" + s.cfg.Host }
+
+// Notify sends the alert as a plain-text email. With implicit TLS (SMTPS, port 465)
+// the connection is encrypted from the start; otherwise STARTTLS is used when the
+// server offers it.
+func (s *SMTPNotifier) Notify(ctx context.Context, a Alert) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	implicitTLS := s.cfg.ImplicitTLS || s.cfg.Port == 465
+	var conn net.Conn
+	var err error
+	if implicitTLS {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: s.cfg.Host}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !implicitTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(emailMessage(s.cfg.From, s.cfg.To, a)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailMessage renders an alert as an RFC 5322 message
+func emailMessage(from string, to []string, a Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	// Alert text can contain anything, including line breaks that would start new
+	// headers; encode it so it stays within the Subject header
+	subject := fmt.Sprintf("[%s][%s] %s", strings.ToUpper(a.Status), a.Severity, a.Summary)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "%s\r\n\r\n", a.Summary)
+	if a.Description != "" {
+		fmt.Fprintf(&b, "%s\r\n\r\n", a.Description)
+	}
+	fmt.Fprintf(&b, "Rule: %s\r\nStatus: %s\r\nSeverity: %s\r\nStarted: %s\r\n", a.Rule, a.Status, a.Severity, a.StartsAt.Format(time.RFC3339))
+	if a.EndsAt != nil {
+		fmt.Fprintf(&b, "Resolved: %s\r\n", a.EndsAt.Format(time.RFC3339))
+	}
+	for _, k := range sortedKeys(a.Labels) {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, a.Labels[k])
+	}
+	return b.Bytes()
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// hostOf returns the host of a URL for notifier names, so secrets in paths are not exposed
+func hostOf(rawURL string) string {
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		rawURL = rawURL[i+3:]
+	}
+	if i := strings.IndexAny(rawURL, "/?#"); i >= 0 {
+		rawURL = rawURL[:i]
+	}
+	if i := strings.LastIndex(rawURL, "@"); i >= 0 {
+		rawURL = rawURL[i+1:]
+	}
+	return rawURL
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
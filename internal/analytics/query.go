@@ -0,0 +1,290 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// Query selects rollups for one collection over a time range
+type Query struct {
+	CollectionID string
+	From         time.Time
+	To           time.Time
+	EndpointID   uint   // optional matched endpoint filter
+	Path         string // optional endpoint template (or unmatched raw path) filter
+	Method       string // optional method filter
+}
+
+// Stats are the aggregated statistics for a set of requests
+type Stats struct {
+	RequestCount  int64            `json:"request_count"`
+	ErrorCount    int64            `json:"error_count"` // 5xx responses
+	ErrorRate     float64          `json:"error_rate"`
+	StatusClasses map[string]int64 `json:"status_classes"`
+	Throughput    float64          `json:"throughput"` // requests per second
+	CacheHits     int64            `json:"cache_hits"`
+	CacheHitRatio float64          `json:"cache_hit_ratio"`
+	AvgDuration   float64          `json:"avg_duration"` // in milliseconds
+	MaxDuration   int64            `json:"max_duration"`
+	P50           float64          `json:"p50"`
+	P90           float64          `json:"p90"`
+	P95           float64          `json:"p95"`
+	P99           float64          `json:"p99"`
+}
+
+// EndpointStats are the statistics for one endpoint template and method.
+// Unmatched paths are reported individually with EndpointID 0.
+type EndpointStats struct {
+	EndpointID uint   `json:"endpoint_id"`
+	Matched    bool   `json:"matched"`
+	Path       string `json:"path"`
+	Method     string `json:"method"`
+	Stats
+}
+
+// Point is one bucket of a time series
+type Point struct {
+	Time time.Time `json:"time"`
+	Stats
+}
+
+// Granularity picks the rollup table resolution for a window and bucket size.
+// Hour rollups are used for long windows and hour-aligned buckets.
+func Granularity(window, bucket time.Duration) string {
+	if window > 24*time.Hour || (bucket >= time.Hour && bucket%time.Hour == 0) {
+		return Hour
+	}
+	return Minute
+}
+
+// Summary returns overall statistics and per-endpoint statistics ordered by request count
+func Summary(db *gorm.DB, q Query) (Stats, []EndpointStats, error) {
+	window := q.To.Sub(q.From)
+	rows, err := load(db, q, Granularity(window, 0))
+	if err != nil {
+		return Stats{}, nil, err
+	}
+
+	total := &database.RequestRollup{}
+	// Endpoints that share a path template, e.g. on different hosts, are reported separately
+	byEndpoint := make(map[endpointKey]*database.RequestRollup)
+	for i := range rows {
+		r := &rows[i]
+		mergeInto(total, r)
+		key := endpointKey{r.EndpointID, r.Path, r.Method}
+		acc, ok := byEndpoint[key]
+		if !ok {
+			acc = &database.RequestRollup{EndpointID: r.EndpointID, Path: r.Path, Method: r.Method}
+			byEndpoint[key] = acc
+		}
+		mergeInto(acc, r)
+	}
+
+	endpoints := make([]EndpointStats, 0, len(byEndpoint))
+	for _, acc := range byEndpoint {
+		endpoints = append(endpoints, EndpointStats{
+			EndpointID: acc.EndpointID,
+			Matched:    acc.EndpointID != 0,
+			Path:       acc.Path,
+			Method:     acc.Method,
+			Stats:      computeStats(acc, window),
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].RequestCount != endpoints[j].RequestCount {
+			return endpoints[i].RequestCount > endpoints[j].RequestCount
+		}
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		if endpoints[i].Method != endpoints[j].Method {
+			return endpoints[i].Method < endpoints[j].Method
+		}
+		return endpoints[i].EndpointID < endpoints[j].EndpointID
+	})
+	return computeStats(total, window), endpoints, nil
+}
+
+type endpointKey struct {
+	endpointID uint
+	path       string
+	method     string
+}
+
+// TimeSeries returns statistics per bucket between From and To, including empty buckets
+func TimeSeries(db *gorm.DB, q Query, bucket time.Duration) ([]Point, error) {
+	rows, err := load(db, q, Granularity(q.To.Sub(q.From), bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	accs := make(map[int64]*database.RequestRollup)
+	for i := range rows {
+		start := rows[i].BucketStart.Local().Truncate(bucket).Unix()
+		acc, ok := accs[start]
+		if !ok {
+			acc = &database.RequestRollup{}
+			accs[start] = acc
+		}
+		mergeInto(acc, &rows[i])
+	}
+
+	var points []Point
+	for t := q.From.Truncate(bucket); t.Before(q.To); t = t.Add(bucket) {
+		acc, ok := accs[t.Unix()]
+		if !ok {
+			acc = &database.RequestRollup{}
+		}
+		points = append(points, Point{Time: t, Stats: computeStats(acc, bucket)})
+	}
+	return points, nil
+}
+
+// Aggregate merges all rollups in the query range at the given granularity into one
+func Aggregate(db *gorm.DB, q Query, granularity string) (*database.RequestRollup, error) {
+	rows, err := load(db, q, granularity)
+	if err != nil {
+		return nil, err
+	}
+	total := &database.RequestRollup{}
+	for i := range rows {
+		mergeInto(total, &rows[i])
+	}
+	return total, nil
+}
+
+// Timed returns how many requests of a rollup have a latency, which excludes
+// WebSocket connections
+func Timed(r *database.RequestRollup) int64 {
+	return sum(decodeHistogram(r.Histogram))
+}
+
+func sum(hist []int64) int64 {
+	var total int64
+	for _, c := range hist {
+		total += c
+	}
+	return total
+}
+
+// SlowerThan estimates how many requests in a rollup took longer than thresholdMs,
+// interpolating linearly within the histogram bucket containing the threshold
+func SlowerThan(r *database.RequestRollup, thresholdMs int64) float64 {
+	if r.DurationMax <= thresholdMs {
+		return 0
+	}
+	hist := decodeHistogram(r.Histogram)
+	var slow float64
+	for i, c := range hist {
+		if c == 0 {
+			continue
+		}
+		var lower int64
+		if i > 0 {
+			lower = LatencyBounds[i-1]
+		}
+		upper := r.DurationMax
+		if i < len(LatencyBounds) && LatencyBounds[i] < upper {
+			upper = LatencyBounds[i]
+		}
+		switch {
+		case lower >= thresholdMs:
+			slow += float64(c)
+		case upper > thresholdMs:
+			slow += float64(c) * float64(upper-thresholdMs) / float64(upper-lower)
+		}
+	}
+	return slow
+}
+
+// load reads the rollups overlapping the query range at the given granularity
+func load(db *gorm.DB, q Query, granularity string) ([]database.RequestRollup, error) {
+	from := q.From.Truncate(time.Minute)
+	if granularity == Hour {
+		from = q.From.Truncate(time.Hour)
+	}
+	query := db.Where("collection_id = ? AND granularity = ? AND bucket_start >= ? AND bucket_start < ?",
+		q.CollectionID, granularity, from, q.To)
+	if q.EndpointID != 0 {
+		query = query.Where("endpoint_id = ?", q.EndpointID)
+	}
+	if q.Path != "" {
+		query = query.Where("path = ?", q.Path)
+	}
+	if q.Method != "" {
+		query = query.Where("method = ?", q.Method)
+	}
+
+	var rows []database.RequestRollup
+	err := query.Find(&rows).Error
+	return rows, err
+}
+
+// computeStats derives rates and percentiles from aggregated counters
+func computeStats(r *database.RequestRollup, window time.Duration) Stats {
+	s := Stats{
+		RequestCount: r.RequestCount,
+		ErrorCount:   r.Status5xx,
+		StatusClasses: map[string]int64{
+			"2xx": r.Status2xx,
+			"3xx": r.Status3xx,
+			"4xx": r.Status4xx,
+			"5xx": r.Status5xx,
+		},
+		CacheHits:   r.CacheHits,
+		MaxDuration: r.DurationMax,
+	}
+	if window > 0 {
+		s.Throughput = float64(r.RequestCount) / window.Seconds()
+	}
+	if r.RequestCount == 0 {
+		return s
+	}
+
+	count := float64(r.RequestCount)
+	s.ErrorRate = float64(r.Status5xx) / count
+	s.CacheHitRatio = float64(r.CacheHits) / count
+	hist := decodeHistogram(r.Histogram)
+	if timed := sum(hist); timed > 0 {
+		s.AvgDuration = float64(r.DurationSum) / float64(timed)
+	}
+	s.P50 = percentile(hist, 0.50, r.DurationMax)
+	s.P90 = percentile(hist, 0.90, r.DurationMax)
+	s.P95 = percentile(hist, 0.95, r.DurationMax)
+	s.P99 = percentile(hist, 0.99, r.DurationMax)
+	return s
+}
+
+// percentile estimates the q-th quantile from histogram counts by linear interpolation
+// within the containing bucket. Estimates never exceed the observed maximum.
+func percentile(hist []int64, q float64, max int64) float64 {
+	total := sum(hist)
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	var cumulative int64
+	for i, c := range hist {
+		if c == 0 || float64(cumulative+c) < rank {
+			cumulative += c
+			continue
+		}
+		var lower float64
+		if i > 0 {
+			lower = float64(LatencyBounds[i-1])
+		}
+		upper := float64(max)
+		if i < len(LatencyBounds) && float64(LatencyBounds[i]) < upper {
+			upper = float64(LatencyBounds[i])
+		}
+		if upper < lower {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(c)
+	}
+	return float64(max)
+}
@@ -0,0 +1,41 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/midgard/gateway/internal/database"
+)
+
+func TestSlowerThan(t *testing.T) {
+	hist := make([]int64, len(LatencyBounds)+1)
+	hist[bucketIndex(60)] = 10    // (50, 75] ms
+	hist[bucketIndex(40000)] = 10 // overflow bucket, above 30 s
+	r := &database.RequestRollup{DurationMax: 40000, Histogram: encodeHistogram(hist)}
+
+	tests := []struct {
+		thresholdMs int64
+		want        float64
+	}{
+		{10, 20},   // below every request
+		{50, 20},   // at the lower bound of the first non-empty bucket
+		{60, 16},   // 15/25 of the (50, 75] bucket
+		{75, 10},   // only the overflow bucket
+		{35000, 5}, // overflow bucket interpolated up to the observed maximum
+		{40000, 0}, // at the maximum
+		{50000, 0}, // above the maximum
+	}
+	for _, tt := range tests {
+		if got := SlowerThan(r, tt.thresholdMs); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("SlowerThan(%d) = %v, want %v", tt.thresholdMs, got, tt.want)
+		}
+	}
+
+	// The last bucket ends at the maximum when it is below the bucket's upper bound
+	hist = make([]int64, len(LatencyBounds)+1)
+	hist[bucketIndex(60)] = 10
+	r = &database.RequestRollup{DurationMax: 70, Histogram: encodeHistogram(hist)}
+	if got := SlowerThan(r, 60); math.Abs(got-5) > 1e-9 {
+		t.Fatalf("SlowerThan with max 70 = %v, want 5", got)
+	}
+}
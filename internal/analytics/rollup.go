@@ -0,0 +1,344 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// Rollup granularities
+const (
+	Minute = "minute"
+	Hour   = "hour"
+)
+
+// cursorName identifies the rollup job in the rollup_cursors table
+const cursorName = "request_rollups"
+
+// settleDelay keeps the job away from logs that may still be committing out of ID order
+const settleDelay = 5 * time.Second
+
+// LatencyBounds are the upper bounds, in milliseconds, of the latency histogram buckets.
+// Each rollup stores len(LatencyBounds)+1 counts; the last one is the overflow bucket.
+var LatencyBounds = []int64{5, 10, 25, 50, 75, 100, 150, 200, 300, 400, 500, 750, 1000, 1500, 2000, 3000, 5000, 7500, 10000, 30000}
+
+// Manager maintains minute and hour rollups of request logs in the background
+type Manager struct {
+	db       *gorm.DB
+	cfg      config.AnalyticsConfig
+	runMu    sync.Mutex
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewManager creates a rollup manager
+func NewManager(db *gorm.DB, cfg config.AnalyticsConfig) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 5000
+	}
+	return &Manager{
+		db:       db,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start starts the background rollup job
+func (m *Manager) Start() {
+	go m.run()
+}
+
+// Stop stops the background rollup job
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	m.runLogged()
+	for {
+		select {
+		case <-ticker.C:
+			m.runLogged()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+func (m *Manager) runLogged() {
+	if err := m.RunOnce(); err != nil {
+		log.Printf("Analytics rollup failed: %v", err)
+	}
+}
+
+// RunOnce rolls up all settled logs written since the last run and expires old rollups
+func (m *Manager) RunOnce() error {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	for {
+		n, err := m.processBatch()
+		if err != nil {
+			return err
+		}
+		if n < m.cfg.BatchSize {
+			break
+		}
+	}
+	return m.expire()
+}
+
+// processBatch aggregates the next batch of logs and advances the cursor in the same transaction
+func (m *Manager) processBatch() (int, error) {
+	processed := 0
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		cursor := database.RollupCursor{Name: cursorName}
+		if err := tx.Where("name = ?", cursorName).FirstOrCreate(&cursor).Error; err != nil {
+			return err
+		}
+
+		var logs []database.RequestLog
+		if err := tx.Select("id", "collection_id", "endpoint_id", "method", "path", "status", "duration", "from_cache", "timestamp").
+			Where("id > ?", cursor.LastLogID).
+			Order("id ASC").Limit(m.cfg.BatchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		// The cursor only moves forward by ID, so the batch ends at the first unsettled
+		// log; later logs are picked up once it has settled
+		cutoff := time.Now().Add(-settleDelay)
+		for i := range logs {
+			if !logs[i].Timestamp.Before(cutoff) {
+				logs = logs[:i]
+				break
+			}
+		}
+		processed = len(logs)
+		if processed == 0 {
+			return nil
+		}
+
+		templates, err := endpointTemplates(tx, logs)
+		if err != nil {
+			return err
+		}
+
+		buckets := make(map[rollupKey]*pendingRollup)
+		for i := range logs {
+			entry := &logs[i]
+			ts := entry.Timestamp.Local()
+
+			// Matched requests are rolled up under their endpoint template
+			var endpointID uint
+			path := entry.Path
+			if entry.EndpointID != nil {
+				if template, ok := templates[*entry.EndpointID]; ok {
+					endpointID = *entry.EndpointID
+					path = template
+				}
+			}
+
+			for _, g := range []struct {
+				name  string
+				start time.Time
+			}{{Minute, ts.Truncate(time.Minute)}, {Hour, ts.Truncate(time.Hour)}} {
+				key := rollupKey{entry.CollectionID, g.name, g.start.Unix(), endpointID, path, entry.Method}
+				p, ok := buckets[key]
+				if !ok {
+					p = &pendingRollup{
+						rollup: database.RequestRollup{
+							CollectionID: entry.CollectionID,
+							Granularity:  g.name,
+							BucketStart:  g.start,
+							EndpointID:   endpointID,
+							Path:         path,
+							Method:       entry.Method,
+						},
+						hist: make([]int64, len(LatencyBounds)+1),
+					}
+					buckets[key] = p
+				}
+				p.add(entry)
+			}
+		}
+
+		for _, p := range buckets {
+			p.rollup.Histogram = encodeHistogram(p.hist)
+			if err := mergeRollup(tx, &p.rollup); err != nil {
+				return err
+			}
+		}
+
+		cursor.LastLogID = logs[len(logs)-1].ID
+		cursor.UpdatedAt = time.Now()
+		return tx.Save(&cursor).Error
+	})
+	return processed, err
+}
+
+// endpointTemplates loads the path templates of the endpoints referenced by logs.
+// Logs whose endpoint has since been deleted are rolled up as unmatched.
+func endpointTemplates(tx *gorm.DB, logs []database.RequestLog) (map[uint]string, error) {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, entry := range logs {
+		if entry.EndpointID != nil && !seen[*entry.EndpointID] {
+			seen[*entry.EndpointID] = true
+			ids = append(ids, *entry.EndpointID)
+		}
+	}
+	templates := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return templates, nil
+	}
+
+	var endpoints []database.Endpoint
+	if err := tx.Select("id", "path").Where("id IN ?", ids).Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		templates[ep.ID] = ep.Path
+	}
+	return templates, nil
+}
+
+// expire removes rollups older than the configured retention
+func (m *Manager) expire() error {
+	if m.cfg.MinuteRetentionHours > 0 {
+		cutoff := time.Now().Add(-time.Duration(m.cfg.MinuteRetentionHours) * time.Hour)
+		if err := m.db.Where("granularity = ? AND bucket_start < ?", Minute, cutoff).Delete(&database.RequestRollup{}).Error; err != nil {
+			return err
+		}
+	}
+	if m.cfg.HourRetentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -m.cfg.HourRetentionDays)
+		if err := m.db.Where("granularity = ? AND bucket_start < ?", Hour, cutoff).Delete(&database.RequestRollup{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rollupKey struct {
+	collectionID string
+	granularity  string
+	bucket       int64
+	endpointID   uint
+	path         string
+	method       string
+}
+
+// pendingRollup accumulates the logs of one rollup bucket in memory; the histogram is
+// encoded once when the bucket is stored
+type pendingRollup struct {
+	rollup database.RequestRollup
+	hist   []int64
+}
+
+// add adds a single request log to the bucket's counters
+func (p *pendingRollup) add(entry *database.RequestLog) {
+	r := &p.rollup
+	r.RequestCount++
+	switch {
+	case entry.Status >= 500:
+		r.Status5xx++
+	case entry.Status >= 400:
+		r.Status4xx++
+	case entry.Status >= 300:
+		r.Status3xx++
+	default:
+		r.Status2xx++
+	}
+	if entry.FromCache {
+		r.CacheHits++
+	}
+	// A WebSocket connection's duration is how long it stayed open, not request
+	// latency, so it is counted as a request but left out of the latency statistics
+	if entry.Status == http.StatusSwitchingProtocols {
+		return
+	}
+	r.DurationSum += entry.Duration
+	if entry.Duration > r.DurationMax {
+		r.DurationMax = entry.Duration
+	}
+	p.hist[bucketIndex(entry.Duration)]++
+}
+
+// mergeRollup adds the counters of r to the stored rollup with the same key, creating it if needed
+func mergeRollup(tx *gorm.DB, r *database.RequestRollup) error {
+	var existing database.RequestRollup
+	err := tx.Where("collection_id = ? AND granularity = ? AND bucket_start = ? AND endpoint_id = ? AND path = ? AND method = ?",
+		r.CollectionID, r.Granularity, r.BucketStart, r.EndpointID, r.Path, r.Method).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(r).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	mergeInto(&existing, r)
+	return tx.Save(&existing).Error
+}
+
+// mergeInto adds the counters and histogram of src to dst
+func mergeInto(dst, src *database.RequestRollup) {
+	dst.RequestCount += src.RequestCount
+	dst.Status2xx += src.Status2xx
+	dst.Status3xx += src.Status3xx
+	dst.Status4xx += src.Status4xx
+	dst.Status5xx += src.Status5xx
+	dst.CacheHits += src.CacheHits
+	dst.DurationSum += src.DurationSum
+	if src.DurationMax > dst.DurationMax {
+		dst.DurationMax = src.DurationMax
+	}
+
+	hist := decodeHistogram(dst.Histogram)
+	for i, c := range decodeHistogram(src.Histogram) {
+		hist[i] += c
+	}
+	dst.Histogram = encodeHistogram(hist)
+}
+
+// bucketIndex returns the histogram bucket for a duration in milliseconds
+func bucketIndex(ms int64) int {
+	for i, bound := range LatencyBounds {
+		if ms <= bound {
+			return i
+		}
+	}
+	return len(LatencyBounds)
+}
+
+// decodeHistogram parses a stored histogram, returning zeroed counts for empty or
+// incompatible values (e.g. rows written with different bounds)
+func decodeHistogram(s string) []int64 {
+	hist := make([]int64, len(LatencyBounds)+1)
+	if s == "" {
+		return hist
+	}
+	var stored []int64
+	if err := json.Unmarshal([]byte(s), &stored); err != nil || len(stored) != len(hist) {
+		return hist
+	}
+	return stored
+}
+
+func encodeHistogram(hist []int64) string {
+	data, _ := json.Marshal(hist)
+	return string(data)
+}
@@ -0,0 +1,173 @@
+package analytics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "analytics.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.Create(&database.Collection{ID: "c1", Name: "shop", Prefix: "shop", BaseURL: "http://upstream"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func addTestLog(t *testing.T, db *gorm.DB, ts time.Time, status int, duration int64) *database.RequestLog {
+	t.Helper()
+	entry := &database.RequestLog{
+		CollectionID: "c1",
+		Path:         "/items",
+		Method:       "GET",
+		TargetURL:    "http://upstream/items",
+		Status:       status,
+		Duration:     duration,
+		Timestamp:    ts.Round(0),
+	}
+	if err := db.Create(entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// minuteTotals sums the minute rollups of the test collection
+func minuteTotals(t *testing.T, db *gorm.DB) *database.RequestRollup {
+	t.Helper()
+	var rows []database.RequestRollup
+	if err := db.Where("granularity = ?", Minute).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	total := &database.RequestRollup{}
+	for i := range rows {
+		mergeInto(total, &rows[i])
+	}
+	return total
+}
+
+func TestRollupWaitsForLogsCommittedOutOfOrder(t *testing.T) {
+	db := newTestDB(t)
+	m := NewManager(db, config.AnalyticsConfig{BatchSize: 100})
+	now := time.Now()
+
+	// The second log has a lower ID than the third but has not settled yet
+	addTestLog(t, db, now.Add(-time.Minute), 200, 10)
+	late := addTestLog(t, db, now, 500, 20)
+	addTestLog(t, db, now.Add(-time.Minute), 200, 30)
+
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if total := minuteTotals(t, db); total.RequestCount != 1 {
+		t.Fatalf("first run rolled up %d logs, want only the one before the unsettled log", total.RequestCount)
+	}
+	var cursor database.RollupCursor
+	db.First(&cursor, "name = ?", cursorName)
+	if cursor.LastLogID != late.ID-1 {
+		t.Fatalf("cursor at %d, want %d", cursor.LastLogID, late.ID-1)
+	}
+
+	// Once it settles, the rest of the logs are rolled up and none is skipped
+	db.Model(late).Update("timestamp", now.Add(-time.Minute).Round(0))
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	total := minuteTotals(t, db)
+	if total.RequestCount != 3 || total.Status5xx != 1 || total.DurationSum != 60 || total.DurationMax != 30 {
+		t.Fatalf("rollup totals: %d requests, %d 5xx, sum %d, max %d", total.RequestCount, total.Status5xx, total.DurationSum, total.DurationMax)
+	}
+	hist := decodeHistogram(total.Histogram)
+	if hist[bucketIndex(10)] != 1 || hist[bucketIndex(20)] != 1 || hist[bucketIndex(30)] != 1 {
+		t.Fatalf("histogram %v", hist)
+	}
+
+	// Running again adds nothing
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if total := minuteTotals(t, db); total.RequestCount != 3 {
+		t.Fatalf("rerun counted %d logs", total.RequestCount)
+	}
+}
+
+func TestRollupBatches(t *testing.T) {
+	db := newTestDB(t)
+	m := NewManager(db, config.AnalyticsConfig{BatchSize: 2})
+	ts := time.Now().Add(-time.Minute)
+	for i := 0; i < 5; i++ {
+		addTestLog(t, db, ts, 200, int64(i))
+	}
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	total := minuteTotals(t, db)
+	if total.RequestCount != 5 || total.DurationSum != 10 {
+		t.Fatalf("rolled up %d logs with duration sum %d, want 5 and 10", total.RequestCount, total.DurationSum)
+	}
+	var hourly database.RequestRollup
+	if err := db.Where("granularity = ?", Hour).First(&hourly).Error; err != nil || hourly.RequestCount != 5 {
+		t.Fatalf("hour rollup: %d requests, %v", hourly.RequestCount, err)
+	}
+}
+
+func TestRollupKeepsEndpointsWithTheSameTemplateApart(t *testing.T) {
+	db := newTestDB(t)
+	endpoints := []database.Endpoint{
+		{CollectionID: "c1", Method: "GET", Path: "/items/{id}"},
+		{CollectionID: "c1", Method: "GET", Path: "/items/{id}"},
+	}
+	if err := db.Create(&endpoints).Error; err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Now().Add(-time.Minute)
+	for i, ep := range endpoints {
+		for n := 0; n <= i; n++ {
+			entry := addTestLog(t, db, ts, 200, 5)
+			db.Model(entry).Update("endpoint_id", ep.ID)
+		}
+	}
+	if err := NewManager(db, config.AnalyticsConfig{}).RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stats, err := Summary(db, Query{CollectionID: "c1", From: ts.Add(-time.Minute), To: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].EndpointID != endpoints[1].ID || stats[0].RequestCount != 2 || stats[1].RequestCount != 1 {
+		t.Fatalf("endpoint stats: %+v", stats)
+	}
+}
+
+func TestRollupCountsWebSocketsWithoutTheirDuration(t *testing.T) {
+	db := newTestDB(t)
+	ts := time.Now().Add(-time.Minute)
+	addTestLog(t, db, ts, 200, 10)
+	addTestLog(t, db, ts, 200, 30)
+	addTestLog(t, db, ts, 101, 60000)
+	if err := NewManager(db, config.AnalyticsConfig{}).RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	total, _, err := Summary(db, Query{CollectionID: "c1", From: ts.Add(-time.Minute), To: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.RequestCount != 3 || total.MaxDuration != 30 || total.AvgDuration != 20 {
+		t.Fatalf("stats: %d requests, max %d, avg %v", total.RequestCount, total.MaxDuration, total.AvgDuration)
+	}
+	if timed := Timed(minuteTotals(t, db)); timed != 2 {
+		t.Fatalf("%d timed requests, want 2", timed)
+	}
+}
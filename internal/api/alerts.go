@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/database"
+)
+
+// handleGetActiveAlerts returns the alerts currently firing
+func (s *APIServer) handleGetActiveAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, s.alertManager.Active())
+}
+
+// handleGetAlertHistory returns fired alerts, most recent first, filtered by
+// status, rule, severity, key, collection_id and from/to on the firing time
+func (s *APIServer) handleGetAlertHistory(c *gin.Context) {
+	query := s.db.Model(&database.AlertHistory{})
+	for _, column := range []string{"status", "rule", "severity", "key"} {
+		if v := c.Query(column); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	if collectionID := c.Query("collection_id"); collectionID != "" {
+		query = query.Where("labels LIKE ?", `%"collection_id":"`+collectionID+`"%`)
+	}
+
+	from, err := parseTimeParam(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.IsZero() {
+		query = query.Where("starts_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("starts_at < ?", to)
+	}
+
+	var alerts []database.AlertHistory
+	if err := query.Order("id DESC").Limit(parseLimit(c.Query("limit"), 100)).Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Labels are stored as JSON text; return them as an object
+	type alertResponse struct {
+		database.AlertHistory
+		Labels json.RawMessage `json:"labels"`
+	}
+	response := make([]alertResponse, 0, len(alerts))
+	for _, a := range alerts {
+		labels := json.RawMessage(a.Labels)
+		if !json.Valid(labels) {
+			labels = json.RawMessage("null")
+		}
+		response = append(response, alertResponse{AlertHistory: a, Labels: labels})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleTestAlert sends a test notification through every configured channel
+func (s *APIServer) handleTestAlert(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"results": s.alertManager.Test(c.Request.Context())})
+}
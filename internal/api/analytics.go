@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/analytics"
+)
+
+// maxSeriesPoints bounds the number of buckets a single time series request may produce
+const maxSeriesPoints = 1440
+
+// handleGetAnalytics returns latency percentiles, error rate, status distribution,
+// throughput and cache hit ratio for a collection and each of its endpoints
+func (s *APIServer) handleGetAnalytics(c *gin.Context) {
+	q, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary, endpoints, err := analytics.Summary(s.db, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        q.From,
+		"to":          q.To,
+		"granularity": analytics.Granularity(q.To.Sub(q.From), 0),
+		"summary":     summary,
+		"endpoints":   endpoints,
+	})
+}
+
+// handleGetAnalyticsTimeSeries returns the same statistics bucketed over time for charts
+func (s *APIServer) handleGetAnalyticsTimeSeries(c *gin.Context) {
+	q, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window := q.To.Sub(q.From)
+	bucket := defaultBucket(window)
+	if v := c.Query("bucket"); v != "" {
+		bucket, err = parseWindow(v)
+		if err != nil || bucket < time.Minute {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid bucket %q: use a duration of at least 1m, e.g. 5m, 1h, 1d", v)})
+			return
+		}
+	}
+	if window/bucket > maxSeriesPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many buckets: at most %d per request", maxSeriesPoints)})
+		return
+	}
+
+	points, err := analytics.TimeSeries(s.db, q, bucket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        q.From,
+		"to":          q.To,
+		"bucket":      bucket.String(),
+		"granularity": analytics.Granularity(window, bucket),
+		"points":      points,
+	})
+}
+
+// parseAnalyticsQuery reads the collection, time range (window or from/to) and endpoint filters
+func parseAnalyticsQuery(c *gin.Context) (analytics.Query, error) {
+	q := analytics.Query{
+		CollectionID: c.Param("id"),
+		Path:         c.Query("path"),
+		Method:       strings.ToUpper(c.Query("method")),
+	}
+
+	var err error
+	if q.To, err = parseTimeParam(c.Query("to")); err != nil {
+		return q, err
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From, err = parseTimeParam(c.Query("from")); err != nil {
+		return q, err
+	}
+	if q.From.IsZero() {
+		window := time.Hour
+		if v := c.Query("window"); v != "" {
+			if window, err = parseWindow(v); err != nil || window <= 0 {
+				return q, fmt.Errorf("invalid window %q: use e.g. 15m, 1h, 24h, 7d", v)
+			}
+		}
+		q.From = q.To.Add(-window)
+	}
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+	return q, nil
+}
+
+// parseWindow parses a Go duration, additionally accepting whole days such as "7d"
+func parseWindow(v string) (time.Duration, error) {
+	if strings.HasSuffix(v, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// defaultBucket picks a bucket size giving roughly 60 to 360 points per window
+func defaultBucket(window time.Duration) time.Duration {
+	switch {
+	case window <= 6*time.Hour:
+		return time.Minute
+	case window <= 24*time.Hour:
+		return 5 * time.Minute
+	case window <= 7*24*time.Hour:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/cache"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/openapi"
+	"github.com/midgard/gateway/internal/proxy"
+)
+
+// validateCache checks the cache settings of a collection
+func validateCache(coll *database.Collection) error {
+	switch coll.CacheMode {
+	case "", cache.ModeTTL, cache.ModeHTTP:
+	default:
+		return fmt.Errorf("invalid cache_mode %q: must be %q or %q", coll.CacheMode, cache.ModeTTL, cache.ModeHTTP)
+	}
+	if coll.CacheStaleWhileRevalidate < 0 || coll.CacheStaleIfError < 0 {
+		return fmt.Errorf("cache_stale_while_revalidate and cache_stale_if_error must not be negative")
+	}
+	if coll.CacheMaxSize < 0 {
+		return fmt.Errorf("cache_max_size must not be negative")
+	}
+	return nil
+}
+
+// handleGetCacheStats returns the cache statistics of every collection with caching enabled
+func (s *APIServer) handleGetCacheStats(c *gin.Context) {
+	collections, err := s.collectionManager.GetAllCollections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats := make([]*proxy.CacheStats, 0, len(collections))
+	for i := range collections {
+		if !collections[i].CacheEnabled {
+			continue
+		}
+		st, err := s.proxyManager.CacheStats(c.Request.Context(), &collections[i])
+		if err != nil {
+			c.JSON(cacheErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		stats = append(stats, st)
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleGetCollectionCacheStats returns the cache statistics of one collection
+func (s *APIServer) handleGetCollectionCacheStats(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+	stats, err := s.proxyManager.CacheStats(c.Request.Context(), coll)
+	if err != nil {
+		c.JSON(cacheErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// handlePurgeCollectionCache purges a collection's cached responses: all of them, those
+// of one endpoint (endpoint_id) or those whose path matches a pattern (path), optionally
+// restricted to one method
+func (s *APIServer) handlePurgeCollectionCache(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	match, err := cachePurgeMatcher(coll, c.Query("endpoint_id"), c.Query("path"), c.Query("method"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	purged, err := s.proxyManager.PurgeCache(c.Request.Context(), coll.ID, match)
+	if err != nil {
+		c.JSON(cacheErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// handlePurgeCacheTags purges a collection's cached responses tagged with one of the given tags
+func (s *APIServer) handlePurgeCacheTags(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tags is required"})
+		return
+	}
+
+	purged, err := s.proxyManager.PurgeCacheTags(c.Request.Context(), coll.ID, req.Tags)
+	if err != nil {
+		c.JSON(cacheErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// cachePurgeMatcher builds the selector of a collection purge; nil purges everything.
+// Path patterns use path.Match syntax relative to the collection prefix, and a trailing
+// /** matches any subpath.
+func cachePurgeMatcher(coll *database.Collection, endpointID, pattern, method string) (func(cache.Meta) bool, error) {
+	var matchers []func(cache.Meta) bool
+
+	if endpointID != "" {
+		id, err := strconv.ParseUint(endpointID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint_id %q", endpointID)
+		}
+		found := false
+		for _, ep := range coll.Endpoints {
+			found = found || uint64(ep.ID) == id
+		}
+		if !found {
+			return nil, fmt.Errorf("endpoint %d not found in collection", id)
+		}
+		matchers = append(matchers, func(m cache.Meta) bool {
+			ep := openapi.MatchEndpoint(coll.Endpoints, m.Method, m.Path)
+			return ep != nil && uint64(ep.ID) == id
+		})
+	}
+
+	if pattern != "" {
+		matchPath, err := cache.PathMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, func(m cache.Meta) bool {
+			return matchPath(m.Path)
+		})
+	}
+
+	if method != "" {
+		matchers = append(matchers, func(m cache.Meta) bool {
+			return strings.EqualFold(m.Method, method)
+		})
+	}
+
+	if len(matchers) == 0 {
+		return nil, nil
+	}
+	return func(m cache.Meta) bool {
+		for _, match := range matchers {
+			if !match(m) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// cacheErrorStatus maps cache administration errors to HTTP status codes
+func cacheErrorStatus(err error) int {
+	if errors.Is(err, proxy.ErrCacheUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/cache"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// cacheRuleRequest is the body accepted when creating or updating a cache rule
+type cacheRuleRequest struct {
+	Name           string `json:"name"`
+	EndpointID     *uint  `json:"endpoint_id"`
+	PathPattern    string `json:"path_pattern"`
+	Methods        string `json:"methods"`
+	Priority       int    `json:"priority"`
+	Bypass         bool   `json:"bypass"`
+	TTL            int    `json:"ttl"`
+	KeyHeaders     string `json:"key_headers"`
+	KeyQuery       string `json:"key_query"`
+	KeyQueryIgnore string `json:"key_query_ignore"`
+	KeyBodyFields  string `json:"key_body_fields"`
+	KeyConsumer    bool   `json:"key_consumer"`
+}
+
+func (s *APIServer) handleGetCacheRules(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+	var rules []database.CacheRule
+	if err := s.db.Where("collection_id = ?", coll.ID).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (s *APIServer) handleCreateCacheRule(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	var req cacheRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := database.CacheRule{CollectionID: coll.ID}
+	applyCacheRuleRequest(&rule, &req)
+	if err := validateCacheRule(coll, &rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *APIServer) handleUpdateCacheRule(c *gin.Context) {
+	coll, rule, ok := s.findCacheRule(c)
+	if !ok {
+		return
+	}
+
+	var req cacheRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applyCacheRuleRequest(rule, &req)
+	if err := validateCacheRule(coll, rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Save(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *APIServer) handleDeleteCacheRule(c *gin.Context) {
+	_, rule, ok := s.findCacheRule(c)
+	if !ok {
+		return
+	}
+	if err := s.db.Delete(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cache rule deleted"})
+}
+
+func (s *APIServer) findCacheRule(c *gin.Context) (*database.Collection, *database.CacheRule, bool) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return nil, nil, false
+	}
+	id, err := strconv.ParseUint(c.Param("ruleId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cache rule ID"})
+		return nil, nil, false
+	}
+	var rule database.CacheRule
+	if err := s.db.Where("collection_id = ?", coll.ID).First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cache rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, nil, false
+	}
+	return coll, &rule, true
+}
+
+// validateCacheRule checks a rule's matchers and key settings and that its endpoint
+// belongs to the collection
+func validateCacheRule(coll *database.Collection, rule *database.CacheRule) error {
+	if rule.EndpointID != nil {
+		found := false
+		for _, ep := range coll.Endpoints {
+			found = found || ep.ID == *rule.EndpointID
+		}
+		if !found {
+			return fmt.Errorf("endpoint %d not found in collection", *rule.EndpointID)
+		}
+	}
+	if rule.PathPattern != "" {
+		if _, err := cache.PathMatcher(rule.PathPattern); err != nil {
+			return err
+		}
+	}
+	if rule.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	for _, field := range strings.Split(rule.KeyBodyFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			if err := cache.ValidateJSONPath(field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyCacheRuleRequest(rule *database.CacheRule, req *cacheRuleRequest) {
+	rule.Name = req.Name
+	rule.EndpointID = req.EndpointID
+	rule.PathPattern = req.PathPattern
+	rule.Methods = req.Methods
+	rule.Priority = req.Priority
+	rule.Bypass = req.Bypass
+	rule.TTL = req.TTL
+	rule.KeyHeaders = req.KeyHeaders
+	rule.KeyQuery = req.KeyQuery
+	rule.KeyQueryIgnore = req.KeyQueryIgnore
+	rule.KeyBodyFields = req.KeyBodyFields
+	rule.KeyConsumer = req.KeyConsumer
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/collection"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/proxy"
+)
+
+// maxDescriptorSetSize bounds uploaded descriptor sets
+const maxDescriptorSetSize = 16 << 20
+
+// validateProtocol checks the protocol of a collection and that gRPC collections have an
+// http:// (h2c) or https:// base URL
+func validateProtocol(coll *database.Collection) error {
+	switch coll.Protocol {
+	case "", proxy.ProtocolHTTP:
+		if coll.GRPCWeb {
+			return fmt.Errorf("grpc_web requires protocol %q", proxy.ProtocolGRPC)
+		}
+	case proxy.ProtocolGRPC:
+		u, err := url.Parse(coll.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("gRPC collections need an http:// (h2c) or https:// base_url")
+		}
+	default:
+		return fmt.Errorf("invalid protocol %q: must be %q or %q", coll.Protocol, proxy.ProtocolHTTP, proxy.ProtocolGRPC)
+	}
+	return nil
+}
+
+// handleImportDescriptorSet replaces a collection's endpoints with the methods of a
+// protobuf descriptor set, sent either as the raw binary body or base64-encoded in
+// {"descriptor_set": "..."}
+func (s *APIServer) handleImportDescriptorSet(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.collectionManager.GetCollection(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	// The limit covers both encodings, so base64 in JSON cannot get around it
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDescriptorSetSize)
+	var descriptorSet []byte
+	var err error
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var req struct {
+			DescriptorSet []byte `json:"descriptor_set"`
+		}
+		err = c.ShouldBindJSON(&req)
+		descriptorSet = req.DescriptorSet
+	} else {
+		descriptorSet, err = io.ReadAll(c.Request.Body)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.collectionManager.ImportDescriptorSet(id, descriptorSet); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, collection.ErrEndpointsInUse) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	coll, _ := s.collectionManager.GetCollection(id)
+	c.JSON(http.StatusOK, coll)
+}
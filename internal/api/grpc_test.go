@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/collection"
+	"github.com/midgard/gateway/internal/database"
+)
+
+func TestImportDescriptorSetLimitsBothEncodings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cm := collection.NewCollectionManager(newTestDB(t))
+	coll := &database.Collection{Name: "svc", Prefix: "svc", BaseURL: "http://upstream", Protocol: "grpc"}
+	if err := cm.CreateCollection(coll); err != nil {
+		t.Fatal(err)
+	}
+	s := &APIServer{collectionManager: cm}
+	router := gin.New()
+	router.POST("/collections/:id/descriptor-set", s.handleImportDescriptorSet)
+
+	oversized := make([]byte, maxDescriptorSetSize+1)
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"raw", "application/octet-stream", oversized},
+		{"json", "application/json", []byte(`{"descriptor_set":"` + base64.StdEncoding.EncodeToString(oversized) + `"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/collections/"+coll.ID+"/descriptor-set", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/health"
+)
+
+// healthIncident is a period during which a collection was unhealthy
+type healthIncident struct {
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"` // nil while ongoing
+	Duration  int64      `json:"duration"` // in seconds, up to now for ongoing incidents
+	Checks    int        `json:"checks"`   // Number of unhealthy checks
+	Error     string     `json:"error"`    // Error of the first failing check
+}
+
+// handleGetHealthStatuses returns the current health check state of every collection
+func (s *APIServer) handleGetHealthStatuses(c *gin.Context) {
+	collections, err := s.collectionManager.GetAllCollections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses := make([]gin.H, 0, len(collections))
+	for _, coll := range collections {
+		status, ok := s.healthChecker.Status(coll.ID)
+		if !ok {
+			continue
+		}
+		statuses = append(statuses, gin.H{
+			"collection": coll.Name,
+			"prefix":     coll.Prefix,
+			"status":     status,
+		})
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// handleGetCollectionHealth returns the current state, uptime, incidents and recent
+// check results of one collection
+func (s *APIServer) handleGetCollectionHealth(c *gin.Context) {
+	coll, err := s.collectionManager.GetCollection(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+	from, to, err := parseHealthWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var results []database.HealthCheckResult
+	if err := s.db.Where("collection_id = ? AND checked_at >= ? AND checked_at <= ?", coll.ID, from, to).
+		Order("checked_at ASC").Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"collection_id": coll.ID,
+		"from":          from,
+		"to":            to,
+		"checks":        len(results),
+		"uptime":        nil, // Percentage of checks in the healthy state, nil without data
+		"success_rate":  nil, // Percentage of probes that passed
+		"avg_latency":   nil,
+		"incidents":     healthIncidents(results, to),
+	}
+	if status, ok := s.healthChecker.Status(coll.ID); ok {
+		response["status"] = status
+	}
+	if len(results) > 0 {
+		var healthy, succeeded, latency int64
+		for _, r := range results {
+			if r.Healthy {
+				healthy++
+			}
+			if r.Success {
+				succeeded++
+			}
+			latency += r.Latency
+		}
+		n := float64(len(results))
+		response["uptime"] = 100 * float64(healthy) / n
+		response["success_rate"] = 100 * float64(succeeded) / n
+		response["avg_latency"] = float64(latency) / n
+	}
+
+	// Most recent results first
+	limit := parseLimit(c.Query("limit"), 100)
+	history := make([]database.HealthCheckResult, 0, limit)
+	for i := len(results) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, results[i])
+	}
+	response["history"] = history
+
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRunHealthCheck probes a collection immediately
+func (s *APIServer) handleRunHealthCheck(c *gin.Context) {
+	status, ok := s.healthChecker.CheckNow(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection has no health check"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// healthIncidents groups consecutive unhealthy results into incidents, most recent first
+func healthIncidents(results []database.HealthCheckResult, now time.Time) []healthIncident {
+	incidents := []healthIncident{}
+	var current *healthIncident
+	for _, r := range results {
+		if !r.Healthy {
+			if current == nil {
+				current = &healthIncident{StartedAt: r.CheckedAt, Error: r.Error}
+			}
+			current.Checks++
+			continue
+		}
+		if current != nil {
+			ended := r.CheckedAt
+			current.EndedAt = &ended
+			current.Duration = int64(ended.Sub(current.StartedAt) / time.Second)
+			incidents = append(incidents, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.Duration = int64(now.Sub(current.StartedAt) / time.Second)
+		incidents = append(incidents, *current)
+	}
+
+	for i, j := 0, len(incidents)-1; i < j; i, j = i+1, j-1 {
+		incidents[i], incidents[j] = incidents[j], incidents[i]
+	}
+	return incidents
+}
+
+// parseHealthWindow reads from/to or a window (default 24h) ending now
+func parseHealthWindow(c *gin.Context) (time.Time, time.Time, error) {
+	to, err := parseTimeParam(c.Query("to"))
+	if err != nil {
+		return to, to, err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from, err := parseTimeParam(c.Query("from"))
+	if err != nil {
+		return from, to, err
+	}
+	if from.IsZero() {
+		window := 24 * time.Hour
+		if v := c.Query("window"); v != "" {
+			if window, err = parseWindow(v); err != nil || window <= 0 {
+				return from, to, fmt.Errorf("invalid window %q: use e.g. 1h, 24h, 7d", v)
+			}
+		}
+		from = to.Add(-window)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// validateHealthCheck checks the probe configuration of a collection
+func validateHealthCheck(coll *database.Collection) error {
+	if !health.Enabled(coll) && coll.HealthType == "" {
+		return nil
+	}
+	_, err := health.NewProbe(coll)
+	return err
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/requestid"
+)
+
+// exportFlushEvery controls how many rows are written between flushes
+const exportFlushEvery = 500
+
+// logExporter writes request logs in one export format
+type logExporter interface {
+	begin() error
+	write(entry *database.RequestLog) error
+	end() error
+	// fail ends an export cut short by an error after the response has started
+	fail(err error)
+}
+
+// handleExportLogs streams filtered request logs as CSV, NDJSON or HAR.
+// Rows are read from a cursor and written one at a time, so the result set is never held in memory.
+func (s *APIServer) handleExportLogs(c *gin.Context) {
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", "ndjson")
+	var exporter logExporter
+	var contentType string
+	switch format {
+	case "csv":
+		exporter = &csvExporter{w: csv.NewWriter(c.Writer)}
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		exporter = &ndjsonExporter{enc: json.NewEncoder(c.Writer)}
+		contentType = "application/x-ndjson"
+	case "har":
+		exporter = &harExporter{w: c.Writer}
+		contentType = "application/json"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q: must be one of csv, ndjson, har", format)})
+		return
+	}
+
+	rows, err := filter.order(filter.apply(s.db.Model(&database.RequestLog{}))).Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("request-logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	if err := exporter.begin(); err != nil {
+		return
+	}
+	count := 0
+	// The status is already sent, so a failed read can only be logged and marked in the output
+	failed := func(err error) {
+		log.Printf("[request_id=%s] Log export cut short after %d rows: %v", requestid.Get(c), count, err)
+		c.Error(err)
+		exporter.fail(err)
+		c.Writer.Flush()
+	}
+	for rows.Next() {
+		var entry database.RequestLog
+		if err := s.db.ScanRows(rows, &entry); err != nil {
+			failed(err)
+			return
+		}
+		if err := exporter.write(&entry); err != nil {
+			// Client went away
+			return
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		failed(err)
+		return
+	}
+	exporter.end()
+	c.Writer.Flush()
+}
+
+// csvExporter writes one CSV row per log entry
+type csvExporter struct {
+	w *csv.Writer
+}
+
+var csvExportColumns = []string{
+	"id", "timestamp", "collection_id", "method", "path", "target_url", "status", "duration",
+	"request_size", "response_size", "client_ip", "from_cache",
+	"dns_time", "connect_time", "tls_time", "ttfb", "transfer_time",
+	"request_params", "request_headers", "response_headers", "request_body", "response_body",
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write(csvExportColumns)
+}
+
+func (e *csvExporter) write(entry *database.RequestLog) error {
+	return e.w.Write([]string{
+		strconv.FormatUint(uint64(entry.ID), 10),
+		entry.Timestamp.Format(time.RFC3339Nano),
+		entry.CollectionID,
+		entry.Method,
+		entry.Path,
+		entry.TargetURL,
+		strconv.Itoa(entry.Status),
+		strconv.FormatInt(entry.Duration, 10),
+		strconv.Itoa(entry.RequestSize),
+		strconv.Itoa(entry.ResponseSize),
+		entry.ClientIP,
+		strconv.FormatBool(entry.FromCache),
+		strconv.FormatInt(entry.DNSTime, 10),
+		strconv.FormatInt(entry.ConnectTime, 10),
+		strconv.FormatInt(entry.TLSTime, 10),
+		strconv.FormatInt(entry.TTFB, 10),
+		strconv.FormatInt(entry.TransferTime, 10),
+		entry.RequestParams,
+		entry.RequestHeaders,
+		entry.ResponseHeaders,
+		entry.RequestBody,
+		entry.ResponseBody,
+	})
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// fail writes out the complete rows; CSV has no way to mark the export as incomplete
+func (e *csvExporter) fail(err error) {
+	e.w.Flush()
+}
+
+// ndjsonExporter writes one JSON object per line
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) begin() error { return nil }
+
+func (e *ndjsonExporter) write(entry *database.RequestLog) error {
+	return e.enc.Encode(entry)
+}
+
+func (e *ndjsonExporter) end() error { return nil }
+
+// fail writes a final record telling readers the export is incomplete
+func (e *ndjsonExporter) fail(err error) {
+	e.enc.Encode(map[string]string{"error": "export incomplete: " + err.Error()})
+}
+
+// harExporter writes a HAR 1.2 document, emitting entries as they are read
+type harExporter struct {
+	w     http.ResponseWriter
+	count int
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+func (e *harExporter) begin() error {
+	_, err := fmt.Fprint(e.w, `{"log":{"version":"1.2","creator":{"name":"Midgard Gateway","version":"1.0"},"entries":[`)
+	return err
+}
+
+func (e *harExporter) write(entry *database.RequestLog) error {
+	data, err := json.Marshal(buildHAREntry(entry))
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := e.w.Write([]byte{','}); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *harExporter) end() error {
+	_, err := fmt.Fprint(e.w, `]}}`)
+	return err
+}
+
+// fail leaves the document unterminated, so it does not parse as a complete HAR
+func (e *harExporter) fail(err error) {}
+
+// buildHAREntry reconstructs a HAR entry from the stored headers, params and bodies
+func buildHAREntry(entry *database.RequestLog) *harEntry {
+	reqHeaders := decodeStoredHeaders(entry.RequestHeaders)
+	respHeaders := decodeStoredHeaders(entry.ResponseHeaders)
+
+	var params url.Values
+	json.Unmarshal([]byte(entry.RequestParams), &params)
+
+	har := &harEntry{
+		StartedDateTime: entry.Timestamp.Format(time.RFC3339Nano),
+		Time:            float64(entry.Duration),
+		Request: harRequest{
+			Method:      entry.Method,
+			URL:         entry.TargetURL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harNameValues(reqHeaders),
+			QueryString: harNameValues(params),
+			HeadersSize: -1,
+			BodySize:    entry.RequestSize,
+		},
+		Response: harResponse{
+			Status:      entry.Status,
+			StatusText:  http.StatusText(entry.Status),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harNameValues(respHeaders),
+			Content: harContent{
+				Size:     entry.ResponseSize,
+				MimeType: respHeaders.Get("Content-Type"),
+				Text:     entry.ResponseBody,
+			},
+			RedirectURL: respHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    entry.ResponseSize,
+		},
+		Timings: harTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+			Wait:    float64(entry.Duration),
+		},
+	}
+
+	if entry.RequestBody != "" {
+		har.Request.PostData = &harPostData{
+			MimeType: reqHeaders.Get("Content-Type"),
+			Text:     entry.RequestBody,
+		}
+	}
+
+	// Stored timings are in microseconds; HAR uses milliseconds. Connect includes TLS in HAR.
+	if entry.TTFB > 0 {
+		har.Timings.Wait = float64(entry.TTFB) / 1000
+		har.Timings.Receive = float64(entry.TransferTime) / 1000
+		if entry.DNSTime > 0 {
+			har.Timings.DNS = float64(entry.DNSTime) / 1000
+		}
+		if entry.ConnectTime > 0 {
+			har.Timings.Connect = float64(entry.ConnectTime+entry.TLSTime) / 1000
+		}
+		if entry.TLSTime > 0 {
+			har.Timings.SSL = float64(entry.TLSTime) / 1000
+		}
+	}
+	if entry.FromCache {
+		har.Comment = "served from gateway cache"
+	}
+
+	return har
+}
+
+func decodeStoredHeaders(data string) http.Header {
+	headers := http.Header{}
+	if data != "" {
+		json.Unmarshal([]byte(data), &headers)
+	}
+	return headers
+}
+
+// harNameValues flattens a multi-valued map into name/value pairs sorted by name
+func harNameValues(m map[string][]string) []harNameValue {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []harNameValue{}
+	for _, name := range names {
+		for _, v := range m[name] {
+			out = append(out, harNameValue{Name: name, Value: v})
+		}
+	}
+	return out
+}
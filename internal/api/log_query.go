@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLogPageSize = 20
+	maxLogPageSize     = 1000
+)
+
+// logFilter holds request log search criteria shared by the log endpoints
+type logFilter struct {
+	Path         string
+	CollectionID string
+	Methods      []string
+	StatusMin    int
+	StatusMax    int
+	MinDuration  int64
+	MaxDuration  int64
+	ClientIP     string
+	From         time.Time
+	To           time.Time
+	FromCache    *bool
+	Query        string
+	Sort         string // "timestamp", "duration" or "status"
+	Desc         bool
+}
+
+// logCursor marks the position after the last row of a page
+type logCursor struct {
+	Value int64 `json:"v"` // Sort column value; Unix nanoseconds for timestamp ordering
+	ID    uint  `json:"id"`
+}
+
+// sortColumns maps sort names to columns. Every order breaks ties by id; insertion ids
+// need not follow timestamps, so timestamp ordering sorts on (timestamp, id).
+var sortColumns = map[string]string{
+	"timestamp": "timestamp",
+	"duration":  "duration",
+	"status":    "status",
+}
+
+// parseLogFilter reads the log search criteria from query parameters
+func parseLogFilter(c *gin.Context) (*logFilter, error) {
+	f := &logFilter{
+		Path:         c.Query("path"),
+		CollectionID: c.Query("collection_id"),
+		ClientIP:     c.Query("client_ip"),
+		Query:        c.Query("q"),
+		Sort:         c.DefaultQuery("sort", "timestamp"),
+		Desc:         !strings.EqualFold(c.Query("order"), "asc"),
+	}
+
+	if _, ok := sortColumns[f.Sort]; !ok {
+		return nil, fmt.Errorf("invalid sort %q: must be one of timestamp, duration, status", f.Sort)
+	}
+
+	if methods := c.Query("method"); methods != "" {
+		for _, m := range strings.Split(methods, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				f.Methods = append(f.Methods, strings.ToUpper(m))
+			}
+		}
+	}
+
+	// status accepts an exact code ("404") or a class ("5xx"); status_min/status_max give a range
+	if status := strings.ToLower(c.Query("status")); status != "" {
+		if len(status) == 3 && strings.HasSuffix(status, "xx") {
+			class, err := strconv.Atoi(status[:1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", status)
+			}
+			f.StatusMin, f.StatusMax = class*100, class*100+99
+		} else {
+			code, err := strconv.Atoi(status)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", status)
+			}
+			f.StatusMin, f.StatusMax = code, code
+		}
+	}
+	if err := parseIntParam(c, "status_min", &f.StatusMin); err != nil {
+		return nil, err
+	}
+	if err := parseIntParam(c, "status_max", &f.StatusMax); err != nil {
+		return nil, err
+	}
+
+	if err := parseInt64Param(c, "min_duration", &f.MinDuration); err != nil {
+		return nil, err
+	}
+	if err := parseInt64Param(c, "max_duration", &f.MaxDuration); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if f.From, err = parseTimeParam(c.Query("from")); err != nil {
+		return nil, err
+	}
+	if f.To, err = parseTimeParam(c.Query("to")); err != nil {
+		return nil, err
+	}
+
+	if fromCache := c.Query("from_cache"); fromCache != "" {
+		v, err := strconv.ParseBool(fromCache)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from_cache %q", fromCache)
+		}
+		f.FromCache = &v
+	}
+
+	return f, nil
+}
+
+// apply adds the filter conditions to a request_logs query
+func (f *logFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Path != "" {
+		query = query.Where("path LIKE ?", "%"+f.Path+"%")
+	}
+	if f.CollectionID != "" {
+		query = query.Where("collection_id = ?", f.CollectionID)
+	}
+	if len(f.Methods) > 0 {
+		query = query.Where("method IN ?", f.Methods)
+	}
+	if f.StatusMin > 0 {
+		query = query.Where("status >= ?", f.StatusMin)
+	}
+	if f.StatusMax > 0 {
+		query = query.Where("status <= ?", f.StatusMax)
+	}
+	if f.MinDuration > 0 {
+		query = query.Where("duration >= ?", f.MinDuration)
+	}
+	if f.MaxDuration > 0 {
+		query = query.Where("duration <= ?", f.MaxDuration)
+	}
+	if f.ClientIP != "" {
+		query = query.Where("client_ip = ?", f.ClientIP)
+	}
+	if !f.From.IsZero() {
+		query = query.Where("timestamp >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("timestamp < ?", f.To)
+	}
+	if f.FromCache != nil {
+		query = query.Where("from_cache = ?", *f.FromCache)
+	}
+	if f.Query != "" {
+		like := "%" + f.Query + "%"
+		query = query.Where("(request_body LIKE ? OR response_body LIKE ?)", like, like)
+	}
+	return query
+}
+
+// order adds the sort order, with id as tie-breaker
+func (f *logFilter) order(query *gorm.DB) *gorm.DB {
+	column := sortColumns[f.Sort]
+	direction := "ASC"
+	if f.Desc {
+		direction = "DESC"
+	}
+	return query.Order(column + " " + direction).Order("id " + direction)
+}
+
+// after restricts the query to rows following the cursor in the current sort order
+func (f *logFilter) after(query *gorm.DB, cursor *logCursor) *gorm.DB {
+	column := sortColumns[f.Sort]
+	op := ">"
+	if f.Desc {
+		op = "<"
+	}
+	var value interface{} = cursor.Value
+	if f.Sort == "timestamp" {
+		value = time.Unix(0, cursor.Value)
+	}
+	return query.Where(
+		fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, op, column, op),
+		value, value, cursor.ID,
+	)
+}
+
+// cursorAfter returns the cursor that continues after a row in the current sort order
+func (f *logFilter) cursorAfter(row *database.RequestLog) *logCursor {
+	cursor := &logCursor{ID: row.ID}
+	switch f.Sort {
+	case "timestamp":
+		cursor.Value = row.Timestamp.UnixNano()
+	case "duration":
+		cursor.Value = row.Duration
+	case "status":
+		cursor.Value = int64(row.Status)
+	}
+	return cursor
+}
+
+func encodeLogCursor(cursor *logCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeLogCursor(s string) (*logCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor logCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// parseLimit parses a page size query parameter, clamped to maxLogPageSize
+func parseLimit(value string, def int) int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return def
+	}
+	if limit > maxLogPageSize {
+		return maxLogPageSize
+	}
+	return limit
+}
+
+func parseIntParam(c *gin.Context, name string, dst *int) error {
+	if v := c.Query(name); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+func parseInt64Param(c *gin.Context, name string, dst *int64) error {
+	if v := c.Query(name); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or Unix time in milliseconds.
+// Times are converted to local time to match how log timestamps are stored.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or Unix milliseconds", v)
+	}
+	return t.Local(), nil
+}
+
+// scanTimeLayouts are the layouts SQLite drivers use when aggregate functions return timestamps as text
+var scanTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// scanTime converts a scanned aggregate timestamp (time.Time, string or []byte) to a time
+func scanTime(v interface{}) time.Time {
+	var s string
+	switch val := v.(type) {
+	case time.Time:
+		return val
+	case string:
+		s = val
+	case []byte:
+		s = string(val)
+	default:
+		return time.Time{}
+	}
+	// Values written via time.Time.String() may carry a monotonic clock suffix
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	for _, layout := range scanTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
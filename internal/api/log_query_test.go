@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "api.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return db
+}
+
+func TestLogCursorPagesThroughEqualSortValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	// Timestamps repeat and do not follow insertion order, as when logs are written
+	// concurrently; durations repeat too
+	base := time.Now().Truncate(time.Second)
+	var logs []database.RequestLog
+	for i, offset := range []int{2, 0, 2, 1, 0, 2, 1, 2, 0} {
+		logs = append(logs, database.RequestLog{
+			CollectionID: "c1",
+			Path:         "/items",
+			Method:       "GET",
+			Status:       200,
+			Duration:     int64(i % 3),
+			Timestamp:    base.Add(time.Duration(offset) * time.Millisecond).Round(0),
+		})
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := &APIServer{db: db}
+	router := gin.New()
+	router.GET("/logs", s.handleGetLogs)
+
+	for _, sortBy := range []string{"timestamp", "duration"} {
+		for _, order := range []string{"asc", "desc"} {
+			want := make([]database.RequestLog, len(logs))
+			copy(want, logs)
+			sort.Slice(want, func(i, j int) bool {
+				a, b := want[i], want[j]
+				if order == "desc" {
+					a, b = b, a
+				}
+				if sortBy == "timestamp" && !a.Timestamp.Equal(b.Timestamp) {
+					return a.Timestamp.Before(b.Timestamp)
+				}
+				if sortBy == "duration" && a.Duration != b.Duration {
+					return a.Duration < b.Duration
+				}
+				return a.ID < b.ID
+			})
+
+			var got []uint
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(logs) {
+					t.Fatalf("%s %s: cursor does not advance", sortBy, order)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+					"/logs?limit=2&sort="+sortBy+"&order="+order+"&cursor="+cursor, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%s %s: status %d: %s", sortBy, order, rec.Code, rec.Body)
+				}
+				var page struct {
+					Data       []database.RequestLog `json:"data"`
+					NextCursor string                `json:"next_cursor"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+					t.Fatal(err)
+				}
+				for _, row := range page.Data {
+					got = append(got, row.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("%s %s: got rows %v, want %d rows", sortBy, order, got, len(want))
+			}
+			for i := range want {
+				if got[i] != want[i].ID {
+					t.Fatalf("%s %s: got rows %v, want %v", sortBy, order, got, ids(want))
+				}
+			}
+		}
+	}
+}
+
+func ids(logs []database.RequestLog) []uint {
+	out := make([]uint, len(logs))
+	for i := range logs {
+		out[i] = logs[i].ID
+	}
+	return out
+}
@@ -4,17 +4,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/alert"
 	"github.com/midgard/gateway/internal/collection"
 	"github.com/midgard/gateway/internal/database"
 	"github.com/midgard/gateway/internal/health"
+	"github.com/midgard/gateway/internal/metrics"
 	"github.com/midgard/gateway/internal/proxy"
+	"github.com/midgard/gateway/internal/requestid"
+	"github.com/midgard/gateway/internal/retention"
+	"github.com/midgard/gateway/internal/slo"
 	"gorm.io/gorm"
 )
 
@@ -23,16 +30,24 @@ type APIServer struct {
 	collectionManager *collection.CollectionManager
 	proxyManager      *proxy.ProxyManager
 	healthChecker     *health.HealthChecker
+	retentionManager  *retention.Manager
+	metrics           *metrics.Gateway
+	sloEvaluator      *slo.Evaluator
+	alertManager      *alert.Manager
 	db                *gorm.DB
 	enableFrontend    bool
 }
 
 // NewAPIServer creates a new API server
-func NewAPIServer(cm *collection.CollectionManager, pm *proxy.ProxyManager, hc *health.HealthChecker, db *gorm.DB, enableFrontend bool) *APIServer {
+func NewAPIServer(cm *collection.CollectionManager, pm *proxy.ProxyManager, hc *health.HealthChecker, rm *retention.Manager, gm *metrics.Gateway, se *slo.Evaluator, am *alert.Manager, db *gorm.DB, enableFrontend bool) *APIServer {
 	return &APIServer{
 		collectionManager: cm,
 		proxyManager:      pm,
 		healthChecker:     hc,
+		retentionManager:  rm,
+		metrics:           gm,
+		sloEvaluator:      se,
+		alertManager:      am,
 		db:                db,
 		enableFrontend:    enableFrontend,
 	}
@@ -40,26 +55,44 @@ func NewAPIServer(cm *collection.CollectionManager, pm *proxy.ProxyManager, hc *
 
 // RegisterRoutes registers all routes
 func (s *APIServer) RegisterRoutes() http.Handler {
-	router := gin.Default()
+	router := gin.New()
+	router.Use(requestid.Middleware(), gin.LoggerWithFormatter(requestid.LogFormatter), gin.Recovery())
 
-	// Configure CORS
-	router.Use(cors.Default())
+	// Configure CORS; gRPC-Web clients send their own headers and read the call status
+	// from response headers
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders("X-Grpc-Web", "X-User-Agent", "Grpc-Timeout")
+	corsConfig.AddExposeHeaders("Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin")
+	router.Use(cors.New(corsConfig))
 
 	// Serve static files (frontend) - only if enabled
+	frontend := false
 	if s.enableFrontend {
 		if _, err := os.Stat("./web/dist"); err == nil {
 			router.Use(static.Serve("/", static.LocalFile("./web/dist", false)))
-			router.NoRoute(func(c *gin.Context) {
-				// Only serve frontend for non-API routes
-				if !strings.HasPrefix(c.Request.URL.Path, "/api") {
-					c.File("./web/dist/index.html")
-				} else {
-					c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
-				}
-			})
+			frontend = true
 		}
 	}
 
+	// Native gRPC clients call /package.Service/Method without a gateway prefix. Such
+	// calls only reach the fallback, so they never shadow the API or proxy routes.
+	router.NoRoute(func(c *gin.Context) {
+		if proxy.IsGRPCMethodCall(c.Request) {
+			s.proxyManager.HandleGRPCRequest(c)
+			return
+		}
+		if !frontend {
+			return
+		}
+		// Only serve frontend for non-API routes
+		if !strings.HasPrefix(c.Request.URL.Path, "/api") {
+			c.File("./web/dist/index.html")
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		}
+	})
+
 	// API routes
 	api := router.Group("/api")
 	{
@@ -72,9 +105,16 @@ func (s *APIServer) RegisterRoutes() http.Handler {
 		api.DELETE("/collections/:id", s.handleDeleteCollection)
 		api.POST("/collections/:id/toggle", s.handleToggleCollection)
 		api.POST("/collections/:id/import-openapi", s.handleImportOpenAPI)
+		api.POST("/collections/:id/import-descriptors", s.handleImportDescriptorSet)
+		api.GET("/collections/:id/cache-rules", s.handleGetCacheRules)
+		api.POST("/collections/:id/cache-rules", s.handleCreateCacheRule)
+		api.PUT("/collections/:id/cache-rules/:ruleId", s.handleUpdateCacheRule)
+		api.DELETE("/collections/:id/cache-rules/:ruleId", s.handleDeleteCacheRule)
 
 		// Logs
 		api.GET("/logs", s.handleGetLogs)
+		api.GET("/logs/export", s.handleExportLogs) // Must be before /:collectionId route
+		api.GET("/logs/request/:requestId", s.handleGetLogsByRequestID)
 		api.GET("/logs/:collectionId", s.handleGetCollectionLogs)
 		api.GET("/logs/:collectionId/latest", s.handleGetLatestLog)
 		api.DELETE("/logs", s.handleClearLogs)
@@ -82,6 +122,34 @@ func (s *APIServer) RegisterRoutes() http.Handler {
 
 		// Statistics
 		api.GET("/collections/:id/endpoint-stats", s.handleGetEndpointStats)
+		api.GET("/collections/:id/unmatched-paths", s.handleGetUnmatchedPaths)
+		api.GET("/collections/:id/analytics", s.handleGetAnalytics)
+		api.GET("/collections/:id/analytics/timeseries", s.handleGetAnalyticsTimeSeries)
+
+		// Admin
+		api.GET("/admin/retention", s.handleGetRetentionStatus)
+		api.POST("/admin/retention/run", s.handleRunRetention)
+		api.GET("/admin/slos", s.handleGetSLOs)
+		api.POST("/admin/slos", s.handleCreateSLO)
+		api.GET("/admin/slos/status", s.handleGetSLOStatuses) // Must be before /:id route
+		api.POST("/admin/slos/evaluate", s.handleEvaluateSLOs)
+		api.GET("/admin/slos/:id", s.handleGetSLO)
+		api.PUT("/admin/slos/:id", s.handleUpdateSLO)
+		api.DELETE("/admin/slos/:id", s.handleDeleteSLO)
+		api.GET("/admin/slos/:id/status", s.handleGetSLOStatus)
+		api.GET("/admin/alerts", s.handleGetActiveAlerts)
+		api.POST("/admin/alerts/test", s.handleTestAlert)
+		api.GET("/admin/health", s.handleGetHealthStatuses)
+		api.GET("/admin/health/:id", s.handleGetCollectionHealth)
+		api.POST("/admin/health/:id/check", s.handleRunHealthCheck)
+		api.GET("/admin/cache", s.handleGetCacheStats)
+		api.GET("/admin/cache/:id", s.handleGetCollectionCacheStats)
+		api.DELETE("/admin/cache/:id", s.handlePurgeCollectionCache)
+		api.POST("/admin/cache/:id/purge-tags", s.handlePurgeCacheTags)
+
+		// Alerts
+		api.GET("/alerts", s.handleGetAlertHistory)
+		api.GET("/alerts/active", s.handleGetActiveAlerts)
 	}
 
 	// Proxy routes - using prefix instead of collectionID
@@ -92,6 +160,9 @@ func (s *APIServer) RegisterRoutes() http.Handler {
 	// Health check
 	router.GET("/health", s.handleHealthCheck)
 
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(s.metrics.Handler()))
+
 	return router
 }
 
@@ -106,19 +177,42 @@ func (s *APIServer) handleGetCollections(c *gin.Context) {
 
 func (s *APIServer) handleCreateCollection(c *gin.Context) {
 	var coll struct {
-		Name             string `json:"name" binding:"required"`
-		Description      string `json:"description"`
-		Prefix           string `json:"prefix" binding:"required"`
-		BaseURL          string `json:"base_url" binding:"required"`
-		OpenAPIURL       string `json:"openapi_url"`
-		HealthPath       string `json:"health_path"`
-		HealthInterval   int    `json:"health_interval"`
-		LogEnabled       bool   `json:"log_enabled"`
-		LogRolling       bool   `json:"log_rolling"`
-		LogMaxEntries    int    `json:"log_max_entries"`
-		CacheEnabled     bool   `json:"cache_enabled"`
-		CacheTTL         int    `json:"cache_ttl"`
-		CacheKeyStrategy string `json:"cache_key_strategy"`
+		Name                      string `json:"name" binding:"required"`
+		Description               string `json:"description"`
+		Prefix                    string `json:"prefix" binding:"required"`
+		BaseURL                   string `json:"base_url" binding:"required"`
+		OpenAPIURL                string `json:"openapi_url"`
+		Protocol                  string `json:"protocol"`
+		GRPCWeb                   bool   `json:"grpc_web"`
+		HealthPath                string `json:"health_path"`
+		HealthInterval            int    `json:"health_interval"`
+		HealthType                string `json:"health_type"`
+		HealthTarget              string `json:"health_target"`
+		HealthGRPCService         string `json:"health_grpc_service"`
+		HealthMethod              string `json:"health_method"`
+		HealthHeaders             string `json:"health_headers"`
+		HealthExpectedStatus      string `json:"health_expected_status"`
+		HealthBodyContains        string `json:"health_body_contains"`
+		HealthJSONPath            string `json:"health_json_path"`
+		HealthJSONValue           string `json:"health_json_value"`
+		HealthTimeout             int    `json:"health_timeout"`
+		HealthRise                int    `json:"health_rise"`
+		HealthFall                int    `json:"health_fall"`
+		LogEnabled                bool   `json:"log_enabled"`
+		LogRolling                bool   `json:"log_rolling"`
+		LogMaxEntries             int    `json:"log_max_entries"`
+		LogResponseBody           bool   `json:"log_response_body"`
+		LogResponseBodyMaxSize    int    `json:"log_response_body_max_size"`
+		MaxRequestBodySize        int64  `json:"max_request_body_size"`
+		MaxWebSocketConnections   int    `json:"max_websocket_connections"`
+		CacheEnabled              bool   `json:"cache_enabled"`
+		CacheTTL                  int    `json:"cache_ttl"`
+		CacheKeyStrategy          string `json:"cache_key_strategy"`
+		CacheMode                 string `json:"cache_mode"`
+		CacheMethods              string `json:"cache_methods"`
+		CacheStaleWhileRevalidate int    `json:"cache_stale_while_revalidate"`
+		CacheStaleIfError         int    `json:"cache_stale_if_error"`
+		CacheMaxSize              int    `json:"cache_max_size"`
 	}
 
 	if err := c.ShouldBindJSON(&coll); err != nil {
@@ -127,20 +221,55 @@ func (s *APIServer) handleCreateCollection(c *gin.Context) {
 	}
 
 	dbColl := &database.Collection{
-		Name:             coll.Name,
-		Description:      coll.Description,
-		Prefix:           coll.Prefix,
-		BaseURL:          coll.BaseURL,
-		OpenAPIURL:       coll.OpenAPIURL,
-		HealthPath:       coll.HealthPath,
-		HealthInterval:   coll.HealthInterval,
-		LogEnabled:       coll.LogEnabled,
-		LogRolling:       coll.LogRolling,
-		LogMaxEntries:    coll.LogMaxEntries,
-		CacheEnabled:     coll.CacheEnabled,
-		CacheTTL:         coll.CacheTTL,
-		CacheKeyStrategy: coll.CacheKeyStrategy,
-		Active:           true,
+		Name:                      coll.Name,
+		Description:               coll.Description,
+		Prefix:                    coll.Prefix,
+		BaseURL:                   coll.BaseURL,
+		OpenAPIURL:                coll.OpenAPIURL,
+		Protocol:                  coll.Protocol,
+		GRPCWeb:                   coll.GRPCWeb,
+		HealthPath:                coll.HealthPath,
+		HealthInterval:            coll.HealthInterval,
+		HealthType:                coll.HealthType,
+		HealthTarget:              coll.HealthTarget,
+		HealthGRPCService:         coll.HealthGRPCService,
+		HealthMethod:              coll.HealthMethod,
+		HealthHeaders:             coll.HealthHeaders,
+		HealthExpectedStatus:      coll.HealthExpectedStatus,
+		HealthBodyContains:        coll.HealthBodyContains,
+		HealthJSONPath:            coll.HealthJSONPath,
+		HealthJSONValue:           coll.HealthJSONValue,
+		HealthTimeout:             coll.HealthTimeout,
+		HealthRise:                coll.HealthRise,
+		HealthFall:                coll.HealthFall,
+		LogEnabled:                coll.LogEnabled,
+		LogRolling:                coll.LogRolling,
+		LogMaxEntries:             coll.LogMaxEntries,
+		LogResponseBody:           coll.LogResponseBody,
+		LogResponseBodyMaxSize:    coll.LogResponseBodyMaxSize,
+		MaxRequestBodySize:        coll.MaxRequestBodySize,
+		MaxWebSocketConnections:   coll.MaxWebSocketConnections,
+		CacheEnabled:              coll.CacheEnabled,
+		CacheTTL:                  coll.CacheTTL,
+		CacheKeyStrategy:          coll.CacheKeyStrategy,
+		CacheMode:                 coll.CacheMode,
+		CacheMethods:              coll.CacheMethods,
+		CacheStaleWhileRevalidate: coll.CacheStaleWhileRevalidate,
+		CacheStaleIfError:         coll.CacheStaleIfError,
+		CacheMaxSize:              coll.CacheMaxSize,
+		Active:                    true,
+	}
+	if err := validateHealthCheck(dbColl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCache(dbColl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateProtocol(dbColl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Check if prefix already exists
@@ -160,7 +289,7 @@ func (s *APIServer) handleCreateCollection(c *gin.Context) {
 	}
 
 	// Start health check if configured
-	if dbColl.HealthPath != "" {
+	if health.Enabled(dbColl) {
 		s.healthChecker.StartHealthCheck(dbColl)
 	}
 
@@ -180,20 +309,43 @@ func (s *APIServer) handleGetCollection(c *gin.Context) {
 func (s *APIServer) handleUpdateCollection(c *gin.Context) {
 	id := c.Param("id")
 	var coll struct {
-		Name             string `json:"name"`
-		Description      string `json:"description"`
-		Prefix           string `json:"prefix"`
-		BaseURL          string `json:"base_url"`
-		OpenAPIURL       string `json:"openapi_url"`
-		HealthPath       string `json:"health_path"`
-		HealthInterval   int    `json:"health_interval"`
-		LogEnabled       bool   `json:"log_enabled"`
-		LogRolling       bool   `json:"log_rolling"`
-		LogMaxEntries    int    `json:"log_max_entries"`
-		CacheEnabled     bool   `json:"cache_enabled"`
-		CacheTTL         int    `json:"cache_ttl"`
-		CacheKeyStrategy string `json:"cache_key_strategy"`
-		Active           bool   `json:"active"`
+		Name                      string `json:"name"`
+		Description               string `json:"description"`
+		Prefix                    string `json:"prefix"`
+		BaseURL                   string `json:"base_url"`
+		OpenAPIURL                string `json:"openapi_url"`
+		Protocol                  string `json:"protocol"`
+		GRPCWeb                   bool   `json:"grpc_web"`
+		HealthPath                string `json:"health_path"`
+		HealthInterval            int    `json:"health_interval"`
+		HealthType                string `json:"health_type"`
+		HealthTarget              string `json:"health_target"`
+		HealthGRPCService         string `json:"health_grpc_service"`
+		HealthMethod              string `json:"health_method"`
+		HealthHeaders             string `json:"health_headers"`
+		HealthExpectedStatus      string `json:"health_expected_status"`
+		HealthBodyContains        string `json:"health_body_contains"`
+		HealthJSONPath            string `json:"health_json_path"`
+		HealthJSONValue           string `json:"health_json_value"`
+		HealthTimeout             int    `json:"health_timeout"`
+		HealthRise                int    `json:"health_rise"`
+		HealthFall                int    `json:"health_fall"`
+		LogEnabled                bool   `json:"log_enabled"`
+		LogRolling                bool   `json:"log_rolling"`
+		LogMaxEntries             int    `json:"log_max_entries"`
+		LogResponseBody           bool   `json:"log_response_body"`
+		LogResponseBodyMaxSize    int    `json:"log_response_body_max_size"`
+		MaxRequestBodySize        int64  `json:"max_request_body_size"`
+		MaxWebSocketConnections   int    `json:"max_websocket_connections"`
+		CacheEnabled              bool   `json:"cache_enabled"`
+		CacheTTL                  int    `json:"cache_ttl"`
+		CacheKeyStrategy          string `json:"cache_key_strategy"`
+		CacheMode                 string `json:"cache_mode"`
+		CacheMethods              string `json:"cache_methods"`
+		CacheStaleWhileRevalidate int    `json:"cache_stale_while_revalidate"`
+		CacheStaleIfError         int    `json:"cache_stale_if_error"`
+		CacheMaxSize              int    `json:"cache_max_size"`
+		Active                    bool   `json:"active"`
 	}
 
 	if err := c.ShouldBindJSON(&coll); err != nil {
@@ -234,15 +386,58 @@ func (s *APIServer) handleUpdateCollection(c *gin.Context) {
 	if coll.OpenAPIURL != "" {
 		existing.OpenAPIURL = coll.OpenAPIURL
 	}
+	if coll.Protocol != "" {
+		existing.Protocol = coll.Protocol
+	}
+	existing.GRPCWeb = coll.GRPCWeb
 	existing.HealthPath = coll.HealthPath
 	existing.HealthInterval = coll.HealthInterval
+	existing.HealthType = coll.HealthType
+	existing.HealthTarget = coll.HealthTarget
+	existing.HealthGRPCService = coll.HealthGRPCService
+	existing.HealthMethod = coll.HealthMethod
+	existing.HealthHeaders = coll.HealthHeaders
+	existing.HealthExpectedStatus = coll.HealthExpectedStatus
+	existing.HealthBodyContains = coll.HealthBodyContains
+	existing.HealthJSONPath = coll.HealthJSONPath
+	existing.HealthJSONValue = coll.HealthJSONValue
+	existing.HealthTimeout = coll.HealthTimeout
+	existing.HealthRise = coll.HealthRise
+	existing.HealthFall = coll.HealthFall
 	existing.LogEnabled = coll.LogEnabled
 	existing.LogRolling = coll.LogRolling
 	existing.LogMaxEntries = coll.LogMaxEntries
+	existing.LogResponseBody = coll.LogResponseBody
+	if coll.LogResponseBodyMaxSize > 0 {
+		existing.LogResponseBodyMaxSize = coll.LogResponseBodyMaxSize
+	}
+	existing.MaxRequestBodySize = coll.MaxRequestBodySize
+	existing.MaxWebSocketConnections = coll.MaxWebSocketConnections
 	existing.CacheEnabled = coll.CacheEnabled
 	existing.CacheTTL = coll.CacheTTL
 	existing.CacheKeyStrategy = coll.CacheKeyStrategy
+	if coll.CacheMode != "" {
+		existing.CacheMode = coll.CacheMode
+	}
+	existing.CacheMethods = coll.CacheMethods
+	existing.CacheStaleWhileRevalidate = coll.CacheStaleWhileRevalidate
+	existing.CacheStaleIfError = coll.CacheStaleIfError
+	if coll.CacheMaxSize > 0 {
+		existing.CacheMaxSize = coll.CacheMaxSize
+	}
 	existing.Active = coll.Active
+	if err := validateHealthCheck(existing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCache(existing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateProtocol(existing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := s.collectionManager.UpdateCollection(id, existing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -250,7 +445,7 @@ func (s *APIServer) handleUpdateCollection(c *gin.Context) {
 	}
 
 	// Restart health check if configured
-	if existing.HealthPath != "" {
+	if health.Enabled(existing) {
 		s.healthChecker.StartHealthCheck(existing)
 	} else {
 		s.healthChecker.StopHealthCheck(existing.ID)
@@ -269,6 +464,11 @@ func (s *APIServer) handleDeleteCollection(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
 		return
 	}
+
+	// Drop the collection's cached responses
+	if _, err := s.proxyManager.PurgeCache(c.Request.Context(), id, nil); err != nil && !errors.Is(err, proxy.ErrCacheUnavailable) {
+		log.Printf("[request_id=%s] Failed to purge cache of deleted collection %s: %v", requestid.Get(c), id, err)
+	}
 	c.Status(http.StatusNoContent)
 }
 
@@ -301,7 +501,11 @@ func (s *APIServer) handleImportOpenAPI(c *gin.Context) {
 	}
 
 	if err := s.collectionManager.ImportOpenAPI(id, req.OpenAPIURL, openAPIJSON); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, collection.ErrEndpointsInUse) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -316,42 +520,44 @@ func (s *APIServer) handleHealthCheck(c *gin.Context) {
 func (s *APIServer) handleCheckPrefix(c *gin.Context) {
 	prefix := c.Param("prefix")
 	excludeID := c.Query("exclude_id")
-	
+
 	exists, err := s.collectionManager.CheckPrefixExists(prefix, excludeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	
+
 	c.JSON(http.StatusOK, gin.H{"exists": exists})
 }
 
+// handleGetLogs searches request logs.
+// Without a cursor parameter it returns offset pages with a total count (page/pageSize);
+// with cursor (empty for the first page) it uses keyset pagination, which stays fast on large tables.
 func (s *APIServer) handleGetLogs(c *gin.Context) {
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if cursorParam, ok := c.GetQuery("cursor"); ok {
+		s.getLogsByCursor(c, filter, cursorParam)
+		return
+	}
+
 	var logs []database.RequestLog
 	var total int64
 
 	// Pagination parameters
-	page := c.DefaultQuery("page", "1")
-	pageSize := c.DefaultQuery("pageSize", "5")
 	pageInt := 1
-	pageSizeInt := 5
-	fmt.Sscanf(page, "%d", &pageInt)
-	fmt.Sscanf(pageSize, "%d", &pageSizeInt)
-
-	// Filter parameters
-	pathFilter := c.Query("path")
-	collectionIDFilter := c.Query("collection_id")
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageInt)
+	if pageInt < 1 {
+		pageInt = 1
+	}
+	pageSizeInt := parseLimit(c.Query("pageSize"), defaultLogPageSize)
 
 	// Build query
-	query := s.db.Model(&database.RequestLog{})
-
-	// Apply filters
-	if pathFilter != "" {
-		query = query.Where("path LIKE ?", "%"+pathFilter+"%")
-	}
-	if collectionIDFilter != "" {
-		query = query.Where("collection_id = ?", collectionIDFilter)
-	}
+	query := filter.apply(s.db.Model(&database.RequestLog{}))
 
 	// Get total count
 	if err := query.Count(&total).Error; err != nil {
@@ -361,30 +567,66 @@ func (s *APIServer) handleGetLogs(c *gin.Context) {
 
 	// Apply pagination and ordering
 	offset := (pageInt - 1) * pageSizeInt
-	if err := query.Order("timestamp DESC").Offset(offset).Limit(pageSizeInt).Find(&logs).Error; err != nil {
+	if err := filter.order(query).Offset(offset).Limit(pageSizeInt).Find(&logs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Return paginated response
 	c.JSON(http.StatusOK, gin.H{
-		"data":  logs,
-		"total": total,
-		"page":  pageInt,
+		"data":     logs,
+		"total":    total,
+		"page":     pageInt,
 		"pageSize": pageSizeInt,
 	})
 }
 
-func (s *APIServer) handleGetCollectionLogs(c *gin.Context) {
-	collectionID := c.Param("collectionId")
+// getLogsByCursor returns one keyset page of logs and the cursor for the next page
+func (s *APIServer) getLogsByCursor(c *gin.Context, filter *logFilter, cursorParam string) {
+	limit := parseLimit(c.Query("limit"), defaultLogPageSize)
+
+	query := filter.apply(s.db.Model(&database.RequestLog{}))
+	if cursorParam != "" {
+		cursor, err := decodeLogCursor(cursorParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = filter.after(query, cursor)
+	}
+
+	// Fetch one extra row to know whether another page exists
 	var logs []database.RequestLog
-	limit := c.DefaultQuery("limit", "100")
+	if err := filter.order(query).Limit(limit + 1).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := s.db.Where("collection_id = ?", collectionID).Order("timestamp DESC")
-	if limit != "" {
-		query = query.Limit(100)
+	nextCursor := ""
+	if len(logs) > limit {
+		logs = logs[:limit]
+		nextCursor = encodeLogCursor(filter.cursorAfter(&logs[len(logs)-1]))
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"data":        logs,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+func (s *APIServer) handleGetCollectionLogs(c *gin.Context) {
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.CollectionID = c.Param("collectionId")
+
+	var logs []database.RequestLog
+	limit := parseLimit(c.Query("limit"), 100)
+
+	query := filter.order(filter.apply(s.db.Model(&database.RequestLog{}))).Limit(limit)
 	if err := query.Find(&logs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -409,6 +651,22 @@ func (s *APIServer) handleGetLatestLog(c *gin.Context) {
 	c.JSON(http.StatusOK, log)
 }
 
+func (s *APIServer) handleGetLogsByRequestID(c *gin.Context) {
+	requestID := c.Param("requestId")
+	var logs []database.RequestLog
+
+	if err := s.db.Where("request_id = ?", requestID).Order("id DESC").Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(logs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No logs found for request ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
 func (s *APIServer) handleClearLogs(c *gin.Context) {
 	if err := s.db.Exec("DELETE FROM request_logs").Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -426,10 +684,27 @@ func (s *APIServer) handleClearCollectionLogs(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (s *APIServer) handleGetRetentionStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, s.retentionManager.Status())
+}
+
+func (s *APIServer) handleRunRetention(c *gin.Context) {
+	if !s.retentionManager.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Log retention is not configured"})
+		return
+	}
+	if err := s.retentionManager.RunOnce(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "status": s.retentionManager.Status()})
+		return
+	}
+	c.JSON(http.StatusOK, s.retentionManager.Status())
+}
+
 func (s *APIServer) handleGetEndpointStats(c *gin.Context) {
 	collectionID := c.Param("id")
 
 	type EndpointStat struct {
+		EndpointID   uint    `json:"endpoint_id"`
 		Path         string  `json:"path"`
 		Method       string  `json:"method"`
 		RequestCount int64   `json:"request_count"`
@@ -438,11 +713,12 @@ func (s *APIServer) handleGetEndpointStats(c *gin.Context) {
 
 	var stats []EndpointStat
 
-	// Group by path and method, calculate count and average duration
+	// Group matched requests by endpoint template, calculate count and average duration
 	if err := s.db.Model(&database.RequestLog{}).
-		Select("path, method, COUNT(*) as request_count, AVG(duration) as avg_duration").
-		Where("collection_id = ?", collectionID).
-		Group("path, method").
+		Select("endpoints.id as endpoint_id, endpoints.path as path, endpoints.method as method, COUNT(*) as request_count, AVG(request_logs.duration) as avg_duration").
+		Joins("JOIN endpoints ON endpoints.id = request_logs.endpoint_id").
+		Where("request_logs.collection_id = ?", collectionID).
+		Group("endpoints.id, endpoints.path, endpoints.method").
 		Order("request_count DESC").
 		Scan(&stats).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -451,3 +727,63 @@ func (s *APIServer) handleGetEndpointStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// handleGetUnmatchedPaths reports traffic to paths that match no imported endpoint
+func (s *APIServer) handleGetUnmatchedPaths(c *gin.Context) {
+	collectionID := c.Param("id")
+
+	type UnmatchedPath struct {
+		Path         string    `json:"path"`
+		Method       string    `json:"method"`
+		RequestCount int64     `json:"request_count"`
+		ErrorCount   int64     `json:"error_count"` // 4xx and 5xx responses
+		AvgDuration  float64   `json:"avg_duration"`
+		LastSeen     time.Time `json:"last_seen"`
+	}
+
+	query := s.db.Model(&database.RequestLog{}).
+		Select("path, method, COUNT(*) as request_count, SUM(CASE WHEN status >= 400 THEN 1 ELSE 0 END) as error_count, AVG(duration) as avg_duration, MAX(timestamp) as last_seen").
+		Where("collection_id = ? AND endpoint_id IS NULL", collectionID)
+
+	from, err := parseTimeParam(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.IsZero() {
+		query = query.Where("timestamp >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("timestamp < ?", to)
+	}
+
+	// Scan into raw rows: SQLite returns MAX(timestamp) as text, which gorm cannot map to time.Time
+	rows, err := query.Group("path, method").
+		Order("request_count DESC").
+		Limit(parseLimit(c.Query("limit"), 100)).
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	paths := []UnmatchedPath{}
+	for rows.Next() {
+		var p UnmatchedPath
+		var lastSeen interface{}
+		if err := rows.Scan(&p.Path, &p.Method, &p.RequestCount, &p.ErrorCount, &p.AvgDuration, &lastSeen); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		p.LastSeen = scanTime(lastSeen)
+		paths = append(paths, p)
+	}
+
+	c.JSON(http.StatusOK, paths)
+}
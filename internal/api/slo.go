@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/slo"
+	"gorm.io/gorm"
+)
+
+// sloRequest is the body accepted when creating or updating an SLO
+type sloRequest struct {
+	Name             string  `json:"name"`
+	CollectionID     string  `json:"collection_id"`
+	EndpointID       *uint   `json:"endpoint_id"`
+	Type             string  `json:"type"`
+	Target           float64 `json:"target"`
+	LatencyThreshold int64   `json:"latency_threshold"`
+	WindowDays       int     `json:"window_days"`
+	Enabled          *bool   `json:"enabled"`
+}
+
+func (s *APIServer) handleGetSLOs(c *gin.Context) {
+	var slos []database.SLO
+	query := s.db.Order("id ASC")
+	if collectionID := c.Query("collection_id"); collectionID != "" {
+		query = query.Where("collection_id = ?", collectionID)
+	}
+	if err := query.Find(&slos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, slos)
+}
+
+func (s *APIServer) handleGetSLO(c *gin.Context) {
+	target, ok := s.findSLO(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+func (s *APIServer) handleCreateSLO(c *gin.Context) {
+	var req sloRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := database.SLO{Enabled: true}
+	applySLORequest(&target, &req)
+	if err := s.validateSLO(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	enabled := target.Enabled
+	if err := s.db.Create(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// gorm replaces zero values with column defaults on create, so store a disabled flag explicitly
+	if !enabled {
+		if err := s.db.Model(&target).Update("enabled", false).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		target.Enabled = false
+	}
+	c.JSON(http.StatusCreated, target)
+}
+
+func (s *APIServer) handleUpdateSLO(c *gin.Context) {
+	target, ok := s.findSLO(c)
+	if !ok {
+		return
+	}
+
+	var req sloRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applySLORequest(target, &req)
+	if err := s.validateSLO(target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.Save(target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+func (s *APIServer) handleDeleteSLO(c *gin.Context) {
+	target, ok := s.findSLO(c)
+	if !ok {
+		return
+	}
+	if err := s.db.Delete(target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "SLO deleted"})
+}
+
+// handleGetSLOStatuses returns the latest evaluation of every enabled SLO
+func (s *APIServer) handleGetSLOStatuses(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"rules":    slo.BurnRateRules,
+		"statuses": s.sloEvaluator.Statuses(),
+	})
+}
+
+// handleGetSLOStatus returns the latest evaluation of one SLO
+func (s *APIServer) handleGetSLOStatus(c *gin.Context) {
+	target, ok := s.findSLO(c)
+	if !ok {
+		return
+	}
+	status, ok := s.sloEvaluator.StatusOf(target.ID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SLO has not been evaluated yet"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// handleEvaluateSLOs runs an evaluation immediately
+func (s *APIServer) handleEvaluateSLOs(c *gin.Context) {
+	if err := s.sloEvaluator.RunOnce(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statuses": s.sloEvaluator.Statuses()})
+}
+
+func (s *APIServer) findSLO(c *gin.Context) (*database.SLO, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SLO ID"})
+		return nil, false
+	}
+	var target database.SLO
+	if err := s.db.First(&target, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "SLO not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return &target, true
+}
+
+// validateSLO checks the definition and that the collection and endpoint exist
+func (s *APIServer) validateSLO(target *database.SLO) error {
+	if err := slo.Validate(target); err != nil {
+		return err
+	}
+	if _, err := s.collectionManager.GetCollection(target.CollectionID); err != nil {
+		return fmt.Errorf("collection %q not found", target.CollectionID)
+	}
+	if target.EndpointID != nil {
+		var count int64
+		s.db.Model(&database.Endpoint{}).Where("id = ? AND collection_id = ?", *target.EndpointID, target.CollectionID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("endpoint %d not found in collection", *target.EndpointID)
+		}
+	}
+	return nil
+}
+
+func applySLORequest(target *database.SLO, req *sloRequest) {
+	target.Name = req.Name
+	target.CollectionID = req.CollectionID
+	target.EndpointID = req.EndpointID
+	target.Type = req.Type
+	target.Target = req.Target
+	target.LatencyThreshold = req.LatencyThreshold
+	target.WindowDays = req.WindowDays
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+}
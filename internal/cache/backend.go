@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend stores cached responses. Entries returned by Lookup are shared and must not
+// be modified.
+type Backend interface {
+	// Lookup returns the entry stored for key that matches the request's varying
+	// headers, or nil on a miss
+	Lookup(ctx context.Context, key string, req *http.Request) (*Entry, error)
+	// Store saves an entry for ttl under key, indexed by the entry's Meta
+	Store(ctx context.Context, key string, req *http.Request, entry *Entry, ttl time.Duration) error
+	// Invalidate removes the entry for key and all its variants
+	Invalidate(ctx context.Context, collection, key string) error
+	// Purge removes the entries of a collection for which match returns true, or all
+	// of them when match is nil, and returns how many were removed
+	Purge(ctx context.Context, collection string, match func(Meta) bool) (int, error)
+	// PurgeTags removes the entries of a collection tagged with any of tags and returns
+	// how many were removed
+	PurgeTags(ctx context.Context, collection string, tags []string) (int, error)
+	// Stats counts the live entries of a collection and their body sizes
+	Stats(ctx context.Context, collection string) (Stats, error)
+}
+
+// Locker is implemented by backends shared between instances, which can coordinate
+// upstream fetches with a lock per key
+type Locker interface {
+	// Lock acquires the fetch lock of key for ttl. It returns the token needed to
+	// release the lock, or an empty token when another instance holds it.
+	Lock(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Unlock releases a fetch lock acquired with Lock
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// Meta describes a cached resource in its collection's index
+type Meta struct {
+	Collection string    `json:"collection"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"` // Request path relative to the collection prefix
+	Tags       []string  `json:"tags,omitempty"`
+	Size       int       `json:"size"`       // Body size in bytes
+	ExpiresAt  time.Time `json:"expires_at"` // When the entry expires from storage
+}
+
+// Stats summarizes the stored entries of a collection
+type Stats struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// ParseTags returns the surrogate keys listed in a response header. Tags are separated
+// by spaces or commas, so both Surrogate-Key and Cache-Tag style headers work.
+func ParseTags(header http.Header, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var tags []string
+	for _, v := range header.Values(name) {
+		tags = append(tags, strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	return tags
+}
+
+// Backend names accepted in the cache configuration
+const (
+	BackendAuto   = "auto"   // Redis when configured, otherwise in-process memory
+	BackendRedis  = "redis"  // Redis only
+	BackendMemory = "memory" // In-process LRU only
+	BackendTiered = "tiered" // In-process LRU in front of Redis
+	BackendNone   = "none"   // Caching disabled
+)
+
+// NewBackend builds the backend selected in the configuration. Backends that need Redis
+// fall back to the in-process cache when no Redis client is configured. It returns nil
+// when caching is disabled, and the name of the backend in use.
+func NewBackend(cfg config.CacheConfig, client redis.UniversalClient) (Backend, string) {
+	name := cfg.Backend
+	if name == "" {
+		name = BackendAuto
+	}
+	if client == nil && name != BackendNone {
+		if name == BackendRedis || name == BackendTiered {
+			log.Printf("Warning: cache backend %q needs Redis, using the in-process cache", name)
+		}
+		name = BackendMemory
+	}
+
+	codec := Codec{CompressMinSize: cfg.CompressMinSize}
+	switch name {
+	case BackendNone:
+		return nil, name
+	case BackendMemory:
+		return NewMemory(cfg.MaxEntries, cfg.MaxBytes), name
+	case BackendTiered:
+		return NewTiered(NewMemory(cfg.MaxEntries, cfg.MaxBytes), NewRedis(client, codec), cfg.LocalTTL), name
+	case BackendAuto, BackendRedis:
+		return NewRedis(client, codec), BackendRedis
+	default:
+		log.Printf("Warning: unknown cache backend %q, using Redis", name)
+		return NewRedis(client, codec), BackendRedis
+	}
+}
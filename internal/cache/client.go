@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/midgard/gateway/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfigured reports whether a Redis server, Sentinel or Cluster is configured
+func RedisConfigured(cfg *config.RedisConfig) bool {
+	return cfg.Host != "" || len(cfg.ClusterAddrs) > 0 || cfg.Sentinel.MasterName != ""
+}
+
+// RedisAddr describes the configured Redis deployment for logs
+func RedisAddr(cfg *config.RedisConfig) string {
+	switch {
+	case len(cfg.ClusterAddrs) > 0:
+		return fmt.Sprintf("cluster %v", cfg.ClusterAddrs)
+	case cfg.Sentinel.MasterName != "":
+		return fmt.Sprintf("sentinel master %q via %v", cfg.Sentinel.MasterName, cfg.Sentinel.Addrs)
+	default:
+		return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	}
+}
+
+// NewRedisClient creates a client for a standalone server, a Sentinel-managed master
+// or a Cluster. Cluster takes precedence over Sentinel when both are configured.
+func NewRedisClient(cfg *config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := redisTLSConfig(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(cfg.ClusterAddrs) > 0:
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("redis cluster does not support db %d", cfg.DB)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.ClusterAddrs,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolTimeout:  cfg.PoolTimeout,
+		}), nil
+
+	case cfg.Sentinel.MasterName != "":
+		if len(cfg.Sentinel.Addrs) == 0 {
+			return nil, fmt.Errorf("redis sentinel master %q has no sentinel addresses", cfg.Sentinel.MasterName)
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.Sentinel.MasterName,
+			SentinelAddrs:    cfg.Sentinel.Addrs,
+			SentinelUsername: cfg.Sentinel.Username,
+			SentinelPassword: cfg.Sentinel.Password,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+			DialTimeout:      cfg.DialTimeout,
+			ReadTimeout:      cfg.ReadTimeout,
+			WriteTimeout:     cfg.WriteTimeout,
+			PoolTimeout:      cfg.PoolTimeout,
+		}), nil
+
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolTimeout:  cfg.PoolTimeout,
+		}), nil
+	}
+}
+
+// redisTLSConfig builds the TLS settings of Redis connections, or nil when TLS is off
+func redisTLSConfig(cfg *config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis CA file %s contains no certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/midgard/gateway/config"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRedisClientModes(t *testing.T) {
+	client, err := NewRedisClient(&config.RedisConfig{Host: "localhost", Port: 6379})
+	if _, ok := client.(*redis.Client); err != nil || !ok {
+		t.Fatalf("standalone: %T, %v", client, err)
+	}
+	client.Close()
+
+	client, err = NewRedisClient(&config.RedisConfig{
+		Sentinel: config.RedisSentinelConfig{MasterName: "mymaster", Addrs: []string{"localhost:26379"}},
+	})
+	if _, ok := client.(*redis.Client); err != nil || !ok {
+		t.Fatalf("sentinel: %T, %v", client, err)
+	}
+	client.Close()
+
+	client, err = NewRedisClient(&config.RedisConfig{ClusterAddrs: []string{"localhost:7000", "localhost:7001"}})
+	if _, ok := client.(*redis.ClusterClient); err != nil || !ok {
+		t.Fatalf("cluster: %T, %v", client, err)
+	}
+	client.Close()
+}
+
+func TestNewRedisClientErrors(t *testing.T) {
+	for name, cfg := range map[string]config.RedisConfig{
+		"sentinel without addresses": {Sentinel: config.RedisSentinelConfig{MasterName: "mymaster"}},
+		"cluster with db":            {ClusterAddrs: []string{"localhost:7000"}, DB: 1},
+		"missing CA file": {Host: "localhost", TLS: config.RedisTLSConfig{
+			Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.pem"),
+		}},
+	} {
+		if _, err := NewRedisClient(&cfg); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
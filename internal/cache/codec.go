@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Serialized entries start with a magic prefix and a format version so entries written
+// by other versions of the gateway are recognized. Entries written before the binary
+// format are JSON objects and are still decoded.
+const (
+	entryMagic   = "MC"
+	entryVersion = 1
+
+	flagCompressed = 1 << 0 // The body is DEFLATE-compressed
+)
+
+// ErrEntryFormat is returned when a serialized entry has an unknown format or is corrupt
+var ErrEntryFormat = errors.New("unsupported cache entry format")
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// Codec serializes entries for shared backends: the status, every header value and the
+// raw body, with the body compressed when it is large enough to benefit
+type Codec struct {
+	CompressMinSize int // Bodies at least this large are compressed; zero disables compression
+}
+
+// Encode serializes an entry
+func (c Codec) Encode(e *Entry) ([]byte, error) {
+	body, flags := e.Body, byte(0)
+	// Bodies with a Content-Encoding are already compressed
+	if c.CompressMinSize > 0 && len(e.Body) >= c.CompressMinSize && e.Header.Get("Content-Encoding") == "" {
+		var buf bytes.Buffer
+		w := flateWriters.Get().(*flate.Writer)
+		w.Reset(&buf)
+		_, err := w.Write(e.Body)
+		if err == nil {
+			err = w.Close()
+		}
+		flateWriters.Put(w)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(e.Body) {
+			body, flags = buf.Bytes(), flagCompressed
+		}
+	}
+
+	b := make([]byte, 0, len(body)+256)
+	b = append(b, entryMagic...)
+	b = append(b, entryVersion, flags)
+	b = binary.AppendUvarint(b, uint64(e.Status))
+	b = appendTime(b, e.StoredAt)
+	b = binary.AppendVarint(b, e.InitialAge)
+	b = appendTime(b, e.FreshUntil)
+	b = binary.AppendVarint(b, e.StaleWhileRevalidate)
+	b = binary.AppendVarint(b, e.StaleIfError)
+	b = appendStrings(b, e.Vary)
+	b = binary.AppendUvarint(b, uint64(len(e.Header)))
+	for name, values := range e.Header {
+		b = appendString(b, name)
+		b = appendStrings(b, values)
+	}
+	b = appendString(b, e.Meta.Collection)
+	b = appendString(b, e.Meta.Method)
+	b = appendString(b, e.Meta.Path)
+	b = appendStrings(b, e.Meta.Tags)
+	b = appendTime(b, e.Meta.ExpiresAt)
+	b = binary.AppendUvarint(b, uint64(len(e.Body)))
+	return append(b, body...), nil
+}
+
+// Decode parses an entry serialized by Encode or by the earlier JSON format
+func Decode(data []byte) (*Entry, error) {
+	if len(data) > 0 && data[0] == '{' {
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEntryFormat, err)
+		}
+		return &entry, nil
+	}
+	if len(data) < len(entryMagic)+2 || string(data[:len(entryMagic)]) != entryMagic {
+		return nil, ErrEntryFormat
+	}
+	if version := data[len(entryMagic)]; version != entryVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrEntryFormat, version)
+	}
+	flags := data[len(entryMagic)+1]
+
+	r := &entryReader{data: data[len(entryMagic)+2:]}
+	e := &Entry{}
+	e.Status = int(r.uvarint())
+	e.StoredAt = r.time()
+	e.InitialAge = r.varint()
+	e.FreshUntil = r.time()
+	e.StaleWhileRevalidate = r.varint()
+	e.StaleIfError = r.varint()
+	e.Vary = r.strings()
+	if n := r.count(); n > 0 {
+		e.Header = make(http.Header, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			name := r.string()
+			e.Header[name] = r.strings()
+		}
+	} else {
+		e.Header = http.Header{}
+	}
+	e.Meta.Collection = r.string()
+	e.Meta.Method = r.string()
+	e.Meta.Path = r.string()
+	e.Meta.Tags = r.strings()
+	e.Meta.ExpiresAt = r.time()
+	size := r.uvarint()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if flags&flagCompressed != 0 {
+		fr := flate.NewReader(bytes.NewReader(r.data))
+		body, err := io.ReadAll(io.LimitReader(fr, int64(size)+1))
+		fr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEntryFormat, err)
+		}
+		if uint64(len(body)) != size {
+			return nil, fmt.Errorf("%w: body size mismatch", ErrEntryFormat)
+		}
+		e.Body = body
+	} else {
+		if uint64(len(r.data)) != size {
+			return nil, fmt.Errorf("%w: truncated body", ErrEntryFormat)
+		}
+		e.Body = r.data
+	}
+	e.Meta.Size = len(e.Body)
+	return e, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendStrings(b []byte, values []string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(values)))
+	for _, v := range values {
+		b = appendString(b, v)
+	}
+	return b
+}
+
+// appendTime stores a time as Unix nanoseconds, with zero for the zero time
+func appendTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return binary.AppendVarint(b, 0)
+	}
+	return binary.AppendVarint(b, t.UnixNano())
+}
+
+// entryReader decodes the fields of a serialized entry, recording the first error
+type entryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *entryReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: truncated entry", ErrEntryFormat)
+	}
+	r.data = nil
+}
+
+func (r *entryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *entryReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a length that has to fit in the remaining data
+func (r *entryReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *entryReader) string() string {
+	n := r.count()
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func (r *entryReader) strings() []string {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	values := make([]string, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		values = append(values, r.string())
+	}
+	return values
+}
+
+func (r *entryReader) time() time.Time {
+	if ns := r.varint(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func codecEntry(body []byte) *Entry {
+	header := http.Header{
+		"Content-Type": {"application/octet-stream"},
+		"Link":         {"</a>; rel=preload", "</b>; rel=preload"},
+	}
+	e := NewEntry(http.StatusOK, header, body, time.Now())
+	e.Vary = []string{"Accept-Encoding"}
+	e.SetLifetime(time.Now(), time.Minute, 0, time.Hour)
+	e.Meta = Meta{Collection: "c1", Method: http.MethodGet, Path: "/blob", Tags: []string{"blob"}, ExpiresAt: time.Now().Add(time.Hour)}
+	return e
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	binaryBody := []byte{0x00, 0xff, 0xfe, '{', 0x80, 0x00}
+	compressible := bytes.Repeat([]byte("midgard "), 1000)
+
+	for name, body := range map[string][]byte{"binary": binaryBody, "compressed": compressible, "empty": nil} {
+		e := codecEntry(body)
+		data, err := Codec{CompressMinSize: 1024}.Encode(e)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+		if name == "compressed" && len(data) >= len(body) {
+			t.Fatalf("%s: %d encoded bytes for a %d byte body", name, len(data), len(body))
+		}
+
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		if !bytes.Equal(got.Body, body) || got.Status != e.Status {
+			t.Fatalf("%s: got status %d body %q", name, got.Status, got.Body)
+		}
+		if links := got.Header.Values("Link"); len(links) != 2 || links[1] != "</b>; rel=preload" {
+			t.Fatalf("%s: multi-valued header = %q", name, links)
+		}
+		if !got.FreshUntil.Equal(e.FreshUntil) || got.StaleIfError != e.StaleIfError || got.Vary[0] != "Accept-Encoding" {
+			t.Fatalf("%s: lifetime or Vary not preserved: %+v", name, got)
+		}
+		if got.Meta.Path != "/blob" || got.Meta.Tags[0] != "blob" || !got.Meta.ExpiresAt.Equal(e.Meta.ExpiresAt) {
+			t.Fatalf("%s: meta = %+v", name, got.Meta)
+		}
+	}
+}
+
+func TestCodecFormats(t *testing.T) {
+	// Entries written in the earlier JSON format are still readable
+	legacy, _ := json.Marshal(codecEntry([]byte("old")))
+	if e, err := Decode(legacy); err != nil || string(e.Body) != "old" {
+		t.Fatalf("legacy entry: %v", err)
+	}
+
+	data, _ := Codec{}.Encode(codecEntry([]byte("body")))
+	future := append([]byte(nil), data...)
+	future[len(entryMagic)] = entryVersion + 1
+	if _, err := Decode(future); !errors.Is(err, ErrEntryFormat) {
+		t.Fatalf("unknown version error = %v", err)
+	}
+	if _, err := Decode(data[:len(data)-2]); !errors.Is(err, ErrEntryFormat) {
+		t.Fatalf("truncated entry error = %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   time.Time   `json:"stored_at"`
+	InitialAge int64       `json:"initial_age"` // Age in seconds the response had when it was stored
+	Vary       []string    `json:"vary,omitempty"`
+	Meta       Meta        `json:"meta"` // Index record, filled in by the caller and the backend
+
+	FreshUntil           time.Time `json:"fresh_until"`
+	StaleWhileRevalidate int64     `json:"stale_while_revalidate,omitempty"` // Seconds the entry may be served stale while it is refreshed
+	StaleIfError         int64     `json:"stale_if_error,omitempty"`         // Seconds the entry may be served stale when the upstream fails
+}
+
+// NewEntry builds a cache entry from an upstream response
+func NewEntry(status int, header http.Header, body []byte, now time.Time) *Entry {
+	return &Entry{
+		Status:     status,
+		Header:     StorableHeader(header),
+		Body:       body,
+		StoredAt:   now,
+		InitialAge: int64(initialAge(header) / time.Second),
+		Vary:       VaryHeaders(header),
+	}
+}
+
+// SetLifetime sets how long the entry stays fresh and may then be served stale, and
+// returns how long it has to be stored
+func (e *Entry) SetLifetime(now time.Time, fresh, staleWhileRevalidate, staleIfError time.Duration) time.Duration {
+	e.FreshUntil = now.Add(fresh)
+	e.StaleWhileRevalidate = int64(staleWhileRevalidate / time.Second)
+	e.StaleIfError = int64(staleIfError / time.Second)
+	return fresh + max(staleWhileRevalidate, staleIfError)
+}
+
+// Fresh reports whether the entry can be served without contacting the upstream.
+// Entries stored without a freshness lifetime are fresh until they expire from storage.
+func (e *Entry) Fresh(now time.Time) bool {
+	return e.FreshUntil.IsZero() || now.Before(e.FreshUntil)
+}
+
+// Revalidatable reports whether a stale entry may be served while it is refreshed in
+// the background (stale-while-revalidate)
+func (e *Entry) Revalidatable(now time.Time) bool {
+	return now.Before(e.FreshUntil.Add(time.Duration(e.StaleWhileRevalidate) * time.Second))
+}
+
+// UsableOnError reports whether a stale entry may be served in place of an upstream
+// error (stale-if-error)
+func (e *Entry) UsableOnError(now time.Time) bool {
+	return now.Before(e.FreshUntil.Add(time.Duration(e.StaleIfError) * time.Second))
+}
+
+// Freshened returns the stored headers updated with the headers of a 304 response to a
+// validation request (RFC 9111 section 4.3.4)
+func (e *Entry) Freshened(header http.Header) http.Header {
+	h := e.Header.Clone()
+	for k, v := range StorableHeader(header) {
+		if k != "Content-Length" {
+			h[k] = v
+		}
+	}
+	return h
+}
+
+// Age returns the current age of the entry in seconds
+func (e *Entry) Age(now time.Time) int64 {
+	age := e.InitialAge + int64(now.Sub(e.StoredAt)/time.Second)
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// WriteHeaders copies the stored headers and the current Age to dst
+func (e *Entry) WriteHeaders(dst http.Header, now time.Time) {
+	for k, v := range e.Header {
+		dst[k] = append([]string(nil), v...)
+	}
+	dst.Set("Age", strconv.FormatInt(e.Age(now), 10))
+}
+
+// NotModified reports whether a conditional GET or HEAD request can be answered with
+// 304 from this entry. If-None-Match takes precedence over If-Modified-Since.
+func (e *Entry) NotModified(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if e.Status != http.StatusOK {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := e.Header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakMatch(candidate, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(e.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(ims)
+}
+
+// NotModifiedHeaders returns the stored headers a 304 response carries (RFC 9110 section 15.4.5)
+func (e *Entry) NotModifiedHeaders(now time.Time) http.Header {
+	h := http.Header{}
+	for _, name := range []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"} {
+		if v := e.Header.Values(name); len(v) > 0 {
+			h[http.CanonicalHeaderKey(name)] = append([]string(nil), v...)
+		}
+	}
+	h.Set("Age", strconv.FormatInt(e.Age(now), 10))
+	return h
+}
+
+// weakMatch compares entity tags ignoring the weak indicator
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// VaryHeaders returns the canonical request header names listed in Vary
+func VaryHeaders(header http.Header) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && name != "*" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
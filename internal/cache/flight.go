@@ -0,0 +1,37 @@
+package cache
+
+import "sync"
+
+// Flights coalesces concurrent upstream fetches of the same cache key within an instance
+type Flights struct {
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+}
+
+// NewFlights creates an empty flight group
+func NewFlights() *Flights {
+	return &Flights{pending: make(map[string]chan struct{})}
+}
+
+// Begin registers a fetch of key. The first caller becomes the leader and gets a done
+// function to call once its response is stored. While the leader's fetch is in flight,
+// other callers get a nil done function and a channel that is closed when it finishes.
+func (f *Flights) Begin(key string) (wait <-chan struct{}, done func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ch, ok := f.pending[key]; ok {
+		return ch, nil
+	}
+	ch := make(chan struct{})
+	f.pending[key] = ch
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.pending, key)
+			f.mu.Unlock()
+			close(ch)
+		})
+	}
+}
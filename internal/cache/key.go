@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/midgard/gateway/internal/jsonpath"
+)
+
+// KeySpec describes which parts of a request make up its cache key. Requests that
+// differ only in parts left out of the key share a cached response.
+type KeySpec struct {
+	Query       bool     // Include the query parameters
+	QueryParams []string // Only these query parameters; empty includes all of them
+	QueryIgnore []string // Query parameters left out, e.g. tracking parameters
+	Body        bool     // Include a hash of the request body
+	BodyFields  []string // JSON paths such as $.tenant or $.filter.ids[0]; replaces the body hash
+	Headers     []string // Request headers whose values are included
+	Consumer    string   // Consumer identity from ConsumerID, empty for a shared key
+}
+
+// Key builds the cache key of a request. Query parameters are sorted by name so that
+// reordered query strings share an entry; header names are case-insensitive.
+func (s KeySpec) Key(collectionID, method string, r *http.Request, body []byte) string {
+	key := fmt.Sprintf("%s:%s:%s", collectionID, method, r.URL.Path)
+
+	if s.Query {
+		key += ":" + s.query(r.URL.Query()).Encode()
+	}
+
+	if len(s.BodyFields) > 0 {
+		hash := md5.Sum(BodyFieldValues(body, s.BodyFields))
+		key += fmt.Sprintf(":f%x", hash)
+	} else if s.Body && len(body) > 0 {
+		hash := md5.Sum(body)
+		key += fmt.Sprintf(":%x", hash)
+	}
+
+	if len(s.Headers) > 0 {
+		var b strings.Builder
+		for _, name := range s.Headers {
+			b.WriteString(strings.ToLower(name))
+			b.WriteByte('=')
+			b.WriteString(strings.Join(r.Header.Values(name), ","))
+			b.WriteByte('\n')
+		}
+		hash := md5.Sum([]byte(b.String()))
+		key += fmt.Sprintf(":h%x", hash)
+	}
+
+	if s.Consumer != "" {
+		key += ":c" + s.Consumer
+	}
+	return key
+}
+
+// query returns the query parameters selected by the spec
+func (s KeySpec) query(values url.Values) url.Values {
+	selected := url.Values{}
+	for name, v := range values {
+		if len(s.QueryParams) > 0 && !slices.Contains(s.QueryParams, name) {
+			continue
+		}
+		if slices.Contains(s.QueryIgnore, name) {
+			continue
+		}
+		selected[name] = v
+	}
+	return selected
+}
+
+// ConsumerID identifies the caller of a request by the values of the given headers,
+// such as Authorization or an API key header. It returns a hash so credentials never
+// appear in cache keys, or an empty string for anonymous requests.
+func ConsumerID(r *http.Request, headers []string) string {
+	var b strings.Builder
+	for _, name := range headers {
+		if values := r.Header.Values(name); len(values) > 0 {
+			b.WriteString(strings.ToLower(name))
+			b.WriteByte('=')
+			b.WriteString(strings.Join(values, ","))
+			b.WriteByte('\n')
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(hash[:16])
+}
+
+// BodyFieldValues extracts the values at the given JSON paths of a request body in a
+// canonical form. Missing fields and bodies that are not JSON yield null values, so
+// such requests share a key.
+func BodyFieldValues(body []byte, fields []string) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		doc = nil
+	}
+	var out bytes.Buffer
+	for _, field := range fields {
+		var value interface{}
+		if p, err := parseBodyField(field); err == nil {
+			value, _ = p.Lookup(doc)
+		}
+		// encoding/json sorts object keys, so equal values encode identically
+		encoded, _ := json.Marshal(value)
+		out.WriteString(field)
+		out.WriteByte('=')
+		out.Write(encoded)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// ValidateJSONPath checks that a body field path can be parsed
+func ValidateJSONPath(field string) error {
+	_, err := parseBodyField(field)
+	return err
+}
+
+// parseBodyField parses a body field path, which must address a single value
+func parseBodyField(field string) (jsonpath.Path, error) {
+	p, err := jsonpath.Parse(field)
+	if err == nil && p.HasWildcard() {
+		err = fmt.Errorf("wildcards are not supported")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON path %q: %v; use e.g. $.tenant or $.items[0].id", field, err)
+	}
+	return p, nil
+}
+
+// PathMatcher returns a matcher for a path pattern relative to a collection prefix.
+// Patterns use path.Match syntax, and a trailing /** matches any subpath.
+func PathMatcher(pattern string) (func(string) bool, error) {
+	pattern = "/" + strings.TrimPrefix(pattern, "/")
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return func(p string) bool {
+			return p == prefix || strings.HasPrefix(p, prefix+"/")
+		}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+	}
+	return func(p string) bool {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}, nil
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKeySpecNormalizesQuery(t *testing.T) {
+	spec := KeySpec{Query: true, QueryIgnore: []string{"utm_source"}}
+	a := spec.Key("c1", http.MethodGet, httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil), nil)
+	b := spec.Key("c1", http.MethodGet, httptest.NewRequest(http.MethodGet, "/items?a=1&utm_source=x&b=2", nil), nil)
+	if a != b {
+		t.Fatalf("reordered and ignored query params give different keys: %q, %q", a, b)
+	}
+
+	spec = KeySpec{Query: true, QueryParams: []string{"page"}}
+	a = spec.Key("c1", http.MethodGet, httptest.NewRequest(http.MethodGet, "/items?page=1&ts=1", nil), nil)
+	b = spec.Key("c1", http.MethodGet, httptest.NewRequest(http.MethodGet, "/items?page=1&ts=2", nil), nil)
+	c := spec.Key("c1", http.MethodGet, httptest.NewRequest(http.MethodGet, "/items?page=2", nil), nil)
+	if a != b || a == c {
+		t.Fatalf("query include list: %q, %q, %q", a, b, c)
+	}
+}
+
+func TestKeySpecBodyFieldsAndHeaders(t *testing.T) {
+	spec := KeySpec{BodyFields: []string{"$.tenant", "$.filter.ids[0]"}, Headers: []string{"X-Region"}}
+	req := func(region string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/search", nil)
+		r.Header.Set("x-region", region)
+		return r
+	}
+
+	a := spec.Key("c1", http.MethodPost, req("eu"), []byte(`{"tenant":"t1","filter":{"ids":[7]},"trace":"a"}`))
+	b := spec.Key("c1", http.MethodPost, req("eu"), []byte(`{"trace":"b","filter":{"ids":[7,8]},"tenant":"t1"}`))
+	if a != b {
+		t.Fatalf("requests differing only in unselected fields give different keys: %q, %q", a, b)
+	}
+	if c := spec.Key("c1", http.MethodPost, req("eu"), []byte(`{"tenant":"t2","filter":{"ids":[7]}}`)); c == a {
+		t.Fatal("different tenants share a key")
+	}
+	if c := spec.Key("c1", http.MethodPost, req("us"), []byte(`{"tenant":"t1","filter":{"ids":[7]}}`)); c == a {
+		t.Fatal("different key header values share a key")
+	}
+}
+
+func TestConsumerID(t *testing.T) {
+	headers := []string{"Authorization", "X-Api-Key"}
+	anonymous := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id := ConsumerID(anonymous, headers); id != "" {
+		t.Fatalf("anonymous consumer = %q, want empty", id)
+	}
+
+	alice := httptest.NewRequest(http.MethodGet, "/", nil)
+	alice.Header.Set("X-Api-Key", "alice-secret")
+	bob := httptest.NewRequest(http.MethodGet, "/", nil)
+	bob.Header.Set("X-Api-Key", "bob-secret")
+	idA, idB := ConsumerID(alice, headers), ConsumerID(bob, headers)
+	if idA == "" || idA == idB {
+		t.Fatalf("consumer IDs %q and %q", idA, idB)
+	}
+	if key := (KeySpec{Consumer: idA}).Key("c1", http.MethodGet, alice, nil); key == "" || strings.Contains(key, "alice-secret") {
+		t.Fatalf("key %q exposes the credential", key)
+	}
+}
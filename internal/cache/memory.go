@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache backend bounded by entry count and by the total
+// size of the stored responses. It keeps the same Vary, index and tag semantics as the
+// Redis backend but is local to one instance.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	lru        *list.List               // Most recently used first; values are *memRecord
+	records    map[string]*list.Element // By base key
+	tags       map[string]map[string]struct{}
+	now        func() time.Time
+}
+
+// memRecord holds the variants of one base key
+type memRecord struct {
+	key      string
+	meta     Meta
+	vary     []string           // Varying request headers, nil when the response does not vary
+	variants map[string]memItem // By variant key, or the base key when not varying
+	size     int64
+}
+
+type memItem struct {
+	entry   *Entry
+	expires time.Time
+	size    int64
+}
+
+// NewMemory creates an in-process cache holding at most maxEntries resources and
+// maxBytes of responses; zero disables a limit
+func NewMemory(maxEntries int, maxBytes int64) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		records:    make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+		now:        time.Now,
+	}
+}
+
+// Lookup returns the entry stored for key that matches the request's varying headers,
+// or nil on a miss
+func (m *Memory) Lookup(ctx context.Context, key string, req *http.Request) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.records[key]
+	if !ok {
+		return nil, nil
+	}
+	rec := el.Value.(*memRecord)
+	variant := key
+	if rec.vary != nil {
+		variant = VariantKey(key, rec.vary, req)
+	}
+	item, ok := rec.variants[variant]
+	if !ok {
+		return nil, nil
+	}
+	if !m.now().Before(item.expires) {
+		m.removeVariant(el, variant)
+		return nil, nil
+	}
+	m.lru.MoveToFront(el)
+	return item.entry, nil
+}
+
+// Store saves an entry for ttl, evicting the least recently used resources when the
+// cache is over its limits. Responses larger than the byte limit are not stored.
+func (m *Memory) Store(ctx context.Context, key string, req *http.Request, entry *Entry, ttl time.Duration) error {
+	now := m.now()
+	entry.Meta.Size = len(entry.Body)
+	entry.Meta.ExpiresAt = now.Add(ttl)
+	size := entrySize(key, entry)
+	if m.maxBytes > 0 && size > m.maxBytes {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.records[key]
+	if !ok {
+		el = m.lru.PushFront(&memRecord{key: key, variants: make(map[string]memItem)})
+		m.records[key] = el
+	}
+	rec := el.Value.(*memRecord)
+	m.untag(rec)
+
+	// A change of the varying headers makes the other variants unreachable
+	variant := key
+	if len(entry.Vary) > 0 {
+		if !slices.Equal(rec.vary, entry.Vary) {
+			m.clearVariants(rec)
+			rec.vary = entry.Vary
+		}
+		variant = VariantKey(key, entry.Vary, req)
+	} else if rec.vary != nil {
+		m.clearVariants(rec)
+		rec.vary = nil
+	}
+	if old, ok := rec.variants[variant]; ok {
+		rec.size -= old.size
+		m.bytes -= old.size
+	}
+	rec.variants[variant] = memItem{entry: entry, expires: now.Add(ttl), size: size}
+	rec.size += size
+	m.bytes += size
+	rec.meta = entry.Meta
+	m.tag(rec)
+	m.lru.MoveToFront(el)
+
+	m.evict()
+	return nil
+}
+
+// Invalidate removes the entry for key and all its variants
+func (m *Memory) Invalidate(ctx context.Context, collection, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.records[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+// Purge removes the entries of a collection for which match returns true, or all of
+// them when match is nil, and returns how many were removed
+func (m *Memory) Purge(ctx context.Context, collection string, match func(Meta) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	now := m.now()
+	for el := m.lru.Front(); el != nil; {
+		next := el.Next()
+		rec := el.Value.(*memRecord)
+		if rec.meta.Collection == collection {
+			live := m.live(rec, now)
+			if match == nil || match(rec.meta) {
+				if live {
+					purged++
+				}
+				m.remove(el)
+			}
+		}
+		el = next
+	}
+	return purged, nil
+}
+
+// PurgeTags removes the entries of a collection tagged with any of tags and returns how many were removed
+func (m *Memory) PurgeTags(ctx context.Context, collection string, tags []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	now := m.now()
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if el, ok := m.records[key]; ok && el.Value.(*memRecord).meta.Collection == collection {
+				if m.live(el.Value.(*memRecord), now) {
+					purged++
+				}
+				m.remove(el)
+			}
+		}
+	}
+	return purged, nil
+}
+
+// Stats counts the live entries of a collection and their body sizes
+func (m *Memory) Stats(ctx context.Context, collection string) (Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var stats Stats
+	now := m.now()
+	for el := m.lru.Front(); el != nil; el = el.Next() {
+		rec := el.Value.(*memRecord)
+		if rec.meta.Collection == collection && m.live(rec, now) {
+			stats.Entries++
+			stats.Bytes += int64(rec.meta.Size)
+		}
+	}
+	return stats, nil
+}
+
+// Len returns the number of stored resources and their total size in bytes
+func (m *Memory) Len() (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.records), m.bytes
+}
+
+// live reports whether any variant of a record is unexpired
+func (m *Memory) live(rec *memRecord, now time.Time) bool {
+	for _, item := range rec.variants {
+		if now.Before(item.expires) {
+			return true
+		}
+	}
+	return false
+}
+
+// evict drops least recently used resources until the cache is within its limits
+func (m *Memory) evict() {
+	for (m.maxEntries > 0 && len(m.records) > m.maxEntries) || (m.maxBytes > 0 && m.bytes > m.maxBytes) {
+		el := m.lru.Back()
+		if el == nil {
+			return
+		}
+		m.remove(el)
+	}
+}
+
+func (m *Memory) remove(el *list.Element) {
+	rec := el.Value.(*memRecord)
+	m.untag(rec)
+	m.bytes -= rec.size
+	m.lru.Remove(el)
+	delete(m.records, rec.key)
+}
+
+func (m *Memory) removeVariant(el *list.Element, variant string) {
+	rec := el.Value.(*memRecord)
+	item := rec.variants[variant]
+	delete(rec.variants, variant)
+	rec.size -= item.size
+	m.bytes -= item.size
+	if len(rec.variants) == 0 {
+		m.remove(el)
+	}
+}
+
+func (m *Memory) clearVariants(rec *memRecord) {
+	m.bytes -= rec.size
+	rec.size = 0
+	rec.variants = make(map[string]memItem)
+}
+
+func (m *Memory) tag(rec *memRecord) {
+	for _, tag := range rec.meta.Tags {
+		keys, ok := m.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			m.tags[tag] = keys
+		}
+		keys[rec.key] = struct{}{}
+	}
+}
+
+func (m *Memory) untag(rec *memRecord) {
+	for _, tag := range rec.meta.Tags {
+		if keys, ok := m.tags[tag]; ok {
+			delete(keys, rec.key)
+			if len(keys) == 0 {
+				delete(m.tags, tag)
+			}
+		}
+	}
+}
+
+// entrySize approximates the memory held by an entry
+func entrySize(key string, entry *Entry) int64 {
+	size := len(key) + len(entry.Body)
+	for k, values := range entry.Header {
+		size += len(k)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	return int64(size)
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for expiry tests
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestMemory(maxEntries int, maxBytes int64) (*Memory, *fakeClock) {
+	clock := &fakeClock{t: time.Now()}
+	m := NewMemory(maxEntries, maxBytes)
+	m.now = clock.now
+	return m, clock
+}
+
+func testEntry(collection, path, body string, tags ...string) *Entry {
+	header := http.Header{"Content-Type": {"text/plain"}}
+	e := NewEntry(http.StatusOK, header, []byte(body), time.Now())
+	e.Meta = Meta{Collection: collection, Method: http.MethodGet, Path: path, Tags: tags}
+	return e
+}
+
+func getRequest(headers ...string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return req
+}
+
+func mustLookup(t *testing.T, b Backend, key string, req *http.Request) *Entry {
+	t.Helper()
+	entry, err := b.Lookup(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("lookup %s: %v", key, err)
+	}
+	return entry
+}
+
+func TestMemoryStoreLookupAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	m, clock := newTestMemory(0, 0)
+
+	if err := m.Store(ctx, "a", getRequest(), testEntry("c1", "/a", "hello"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	entry := mustLookup(t, m, "a", getRequest())
+	if entry == nil || string(entry.Body) != "hello" || entry.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("lookup returned %+v", entry)
+	}
+
+	clock.advance(time.Minute)
+	if entry := mustLookup(t, m, "a", getRequest()); entry != nil {
+		t.Fatal("expired entry returned")
+	}
+	if n, _ := m.Len(); n != 0 {
+		t.Fatalf("expired entry kept, %d resources stored", n)
+	}
+}
+
+func TestMemoryVaryVariants(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemory(0, 0)
+
+	gzip := testEntry("c1", "/a", "gzipped")
+	gzip.Vary = []string{"Accept-Encoding"}
+	plain := testEntry("c1", "/a", "plain")
+	plain.Vary = []string{"Accept-Encoding"}
+	m.Store(ctx, "a", getRequest("Accept-Encoding", "gzip"), gzip, time.Minute)
+	m.Store(ctx, "a", getRequest(), plain, time.Minute)
+
+	if e := mustLookup(t, m, "a", getRequest("Accept-Encoding", "gzip")); e == nil || string(e.Body) != "gzipped" {
+		t.Fatalf("gzip variant: %+v", e)
+	}
+	if e := mustLookup(t, m, "a", getRequest()); e == nil || string(e.Body) != "plain" {
+		t.Fatalf("identity variant: %+v", e)
+	}
+	if e := mustLookup(t, m, "a", getRequest("Accept-Encoding", "br")); e != nil {
+		t.Fatal("unknown variant returned")
+	}
+
+	// A response that no longer varies replaces every variant
+	m.Store(ctx, "a", getRequest(), testEntry("c1", "/a", "single"), time.Minute)
+	if e := mustLookup(t, m, "a", getRequest("Accept-Encoding", "gzip")); e == nil || string(e.Body) != "single" {
+		t.Fatalf("after Vary removal: %+v", e)
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemory(2, 0)
+
+	m.Store(ctx, "a", getRequest(), testEntry("c1", "/a", "a"), time.Minute)
+	m.Store(ctx, "b", getRequest(), testEntry("c1", "/b", "b"), time.Minute)
+	mustLookup(t, m, "a", getRequest()) // a is now more recently used than b
+	m.Store(ctx, "c", getRequest(), testEntry("c1", "/c", "c"), time.Minute)
+
+	if mustLookup(t, m, "b", getRequest()) != nil {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if mustLookup(t, m, "a", getRequest()) == nil || mustLookup(t, m, "c", getRequest()) == nil {
+		t.Fatal("recently used entries were evicted")
+	}
+}
+
+func TestMemoryByteLimit(t *testing.T) {
+	ctx := context.Background()
+	body := string(make([]byte, 100))
+	limit := 2 * entrySize("k1", testEntry("c1", "/", body))
+	m, _ := newTestMemory(0, limit)
+
+	m.Store(ctx, "k1", getRequest(), testEntry("c1", "/1", body), time.Minute)
+	m.Store(ctx, "k2", getRequest(), testEntry("c1", "/2", body), time.Minute)
+	m.Store(ctx, "k3", getRequest(), testEntry("c1", "/3", body), time.Minute)
+	if n, size := m.Len(); n != 2 || size > limit {
+		t.Fatalf("got %d resources of %d bytes, want 2 within %d bytes", n, size, limit)
+	}
+	if mustLookup(t, m, "k1", getRequest()) != nil {
+		t.Fatal("oldest entry was not evicted")
+	}
+
+	// Responses larger than the whole cache are not stored
+	m.Store(ctx, "big", getRequest(), testEntry("c1", "/big", string(make([]byte, limit))), time.Minute)
+	if mustLookup(t, m, "big", getRequest()) != nil {
+		t.Fatal("oversized entry stored")
+	}
+}
+
+func TestMemoryPurge(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemory(0, 0)
+	m.Store(ctx, "a", getRequest(), testEntry("c1", "/users/1", "a", "user:1"), time.Minute)
+	m.Store(ctx, "b", getRequest(), testEntry("c1", "/users/2", "b", "user:2"), time.Minute)
+	m.Store(ctx, "c", getRequest(), testEntry("c1", "/orders/1", "c", "user:1"), time.Minute)
+	m.Store(ctx, "d", getRequest(), testEntry("c2", "/users/1", "d", "user:1"), time.Minute)
+
+	n, err := m.PurgeTags(ctx, "c1", []string{"user:1"})
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeTags = %d, %v; want 2", n, err)
+	}
+	if mustLookup(t, m, "a", getRequest()) != nil || mustLookup(t, m, "c", getRequest()) != nil {
+		t.Fatal("tagged entries not purged")
+	}
+	if mustLookup(t, m, "d", getRequest()) == nil {
+		t.Fatal("entry of another collection with the same tag purged")
+	}
+
+	stats, _ := m.Stats(ctx, "c1")
+	if stats.Entries != 1 || stats.Bytes != 1 {
+		t.Fatalf("stats = %+v, want 1 entry of 1 byte", stats)
+	}
+
+	n, _ = m.Purge(ctx, "c1", func(meta Meta) bool { return meta.Path == "/users/2" })
+	if n != 1 || mustLookup(t, m, "b", getRequest()) != nil {
+		t.Fatalf("path purge removed %d entries", n)
+	}
+	n, _ = m.Purge(ctx, "c2", nil)
+	if n != 1 || mustLookup(t, m, "d", getRequest()) != nil {
+		t.Fatalf("collection purge removed %d entries", n)
+	}
+}
+
+// failingBackend is a shared tier that is unavailable
+type failingBackend struct{ Memory }
+
+var errUnavailable = errors.New("unavailable")
+
+func (f *failingBackend) Lookup(context.Context, string, *http.Request) (*Entry, error) {
+	return nil, errUnavailable
+}
+
+func (f *failingBackend) Store(context.Context, string, *http.Request, *Entry, time.Duration) error {
+	return errUnavailable
+}
+
+func TestTieredFillsLocalTier(t *testing.T) {
+	ctx := context.Background()
+	local, _ := newTestMemory(0, 0)
+	shared, _ := newTestMemory(0, 0)
+	tiered := NewTiered(local, shared, time.Second)
+
+	shared.Store(ctx, "a", getRequest(), testEntry("c1", "/a", "shared"), time.Minute)
+	if e := mustLookup(t, tiered, "a", getRequest()); e == nil || string(e.Body) != "shared" {
+		t.Fatalf("shared hit: %+v", e)
+	}
+	if e := mustLookup(t, local, "a", getRequest()); e == nil {
+		t.Fatal("shared hit was not copied to the local tier")
+	}
+
+	tiered.Purge(ctx, "c1", nil)
+	if mustLookup(t, local, "a", getRequest()) != nil || mustLookup(t, shared, "a", getRequest()) != nil {
+		t.Fatal("purge did not clear both tiers")
+	}
+}
+
+func TestTieredServesLocallyWhenSharedFails(t *testing.T) {
+	ctx := context.Background()
+	local, _ := newTestMemory(0, 0)
+	tiered := NewTiered(local, &failingBackend{}, time.Minute)
+
+	if err := tiered.Store(ctx, "a", getRequest(), testEntry("c1", "/a", "local"), time.Minute); err == nil {
+		t.Fatal("shared store error not reported")
+	}
+	if e := mustLookup(t, tiered, "a", getRequest()); e == nil || string(e.Body) != "local" {
+		t.Fatalf("local hit while shared tier is down: %+v", e)
+	}
+	if _, err := tiered.Lookup(ctx, "b", getRequest()); !errors.Is(err, errUnavailable) {
+		t.Fatalf("miss error = %v, want shared tier error", err)
+	}
+}
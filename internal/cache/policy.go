@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache modes of a collection
+const (
+	ModeTTL  = "ttl"  // Cache successful responses for the collection TTL regardless of headers
+	ModeHTTP = "http" // Follow HTTP caching semantics (RFC 9111) as a shared cache
+)
+
+// DefaultMethods are the methods cached in HTTP mode when a collection does not list any
+var DefaultMethods = []string{http.MethodGet, http.MethodHead}
+
+// Statuses that may be cached in HTTP mode (RFC 9110 heuristically cacheable codes, except 206)
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// Headers that are not stored or replayed from the cache
+var uncachedHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Proxy-Authorization",
+	"TE", "Trailer", "Transfer-Encoding", "Upgrade", "Set-Cookie", "Age", "X-Cache", "X-Request-ID",
+}
+
+// Directives are the parsed directives of a Cache-Control header
+type Directives map[string]string
+
+// ParseCacheControl parses all Cache-Control headers. Directive names are lowercased
+// and quoted values unquoted.
+func ParseCacheControl(h http.Header) Directives {
+	d := Directives{}
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(part, "=")
+			d[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return d
+}
+
+// Has reports whether a directive is present
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Seconds returns the delta-seconds value of a directive such as max-age
+func (d Directives) Seconds(name string) (time.Duration, bool) {
+	v, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// Methods parses a comma-separated method list, falling back to DefaultMethods
+func Methods(list string) []string {
+	var methods []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	if len(methods) == 0 {
+		return DefaultMethods
+	}
+	return methods
+}
+
+// MethodAllowed reports whether method is in methods
+func MethodAllowed(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupAllowed reports whether a request may be answered from the cache. Requests
+// with no-cache, max-age=0 or Pragma: no-cache go to the upstream.
+func LookupAllowed(req *http.Request) bool {
+	d := ParseCacheControl(req.Header)
+	if d.Has("no-cache") || d.Has("no-store") {
+		return false
+	}
+	if age, ok := d.Seconds("max-age"); ok && age == 0 {
+		return false
+	}
+	return !(len(d) == 0 && strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache"))
+}
+
+// Freshness decides whether a response may be stored by a shared cache and for how
+// long it stays fresh. defaultTTL applies when the response carries no explicit
+// freshness information; zero disables caching of such responses. perConsumer is set
+// when the cache key includes the caller's identity, which makes the entry private to
+// that caller so private and authenticated responses may be stored. The reason explains
+// a refusal.
+func Freshness(req *http.Request, status int, header http.Header, defaultTTL time.Duration, perConsumer bool, now time.Time) (time.Duration, string) {
+	if !cacheableStatus[status] {
+		return 0, "status not cacheable"
+	}
+	if ParseCacheControl(req.Header).Has("no-store") {
+		return 0, "request no-store"
+	}
+
+	d := ParseCacheControl(header)
+	switch {
+	case d.Has("no-store"):
+		return 0, "no-store"
+	case d.Has("private") && !perConsumer:
+		return 0, "private"
+	case d.Has("no-cache"):
+		return 0, "no-cache"
+	}
+	if header.Get("Vary") == "*" {
+		return 0, "vary *"
+	}
+	if len(header.Values("Set-Cookie")) > 0 && !d.Has("public") {
+		return 0, "set-cookie"
+	}
+	// Responses to authenticated requests are only shared when explicitly allowed
+	if req.Header.Get("Authorization") != "" && !perConsumer && !d.Has("public") && !d.Has("s-maxage") && !d.Has("must-revalidate") {
+		return 0, "authorization"
+	}
+
+	lifetime, explicit := d.Seconds("s-maxage")
+	if !explicit {
+		lifetime, explicit = d.Seconds("max-age")
+	}
+	if !explicit && header.Get("Expires") != "" {
+		explicit = true
+		if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			date := now
+			if t, err := http.ParseTime(header.Get("Date")); err == nil {
+				date = t
+			}
+			lifetime = expires.Sub(date)
+		}
+	}
+	if !explicit {
+		lifetime = defaultTTL
+	}
+
+	ttl := lifetime - initialAge(header)
+	if ttl <= 0 {
+		return 0, "stale"
+	}
+	return ttl, ""
+}
+
+// StaleWindows returns how long a response may be served stale while it is refreshed
+// and when the upstream fails. The response's stale-while-revalidate and stale-if-error
+// directives (RFC 5861) override the collection defaults; must-revalidate and
+// proxy-revalidate forbid serving it stale.
+func StaleWindows(header http.Header, staleWhileRevalidate, staleIfError time.Duration) (time.Duration, time.Duration) {
+	d := ParseCacheControl(header)
+	if d.Has("must-revalidate") || d.Has("proxy-revalidate") {
+		return 0, 0
+	}
+	if v, ok := d.Seconds("stale-while-revalidate"); ok {
+		staleWhileRevalidate = v
+	}
+	if v, ok := d.Seconds("stale-if-error"); ok {
+		staleIfError = v
+	}
+	return staleWhileRevalidate, staleIfError
+}
+
+// initialAge is the age a response already had when it was received
+func initialAge(header http.Header) time.Duration {
+	if n, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return 0
+}
+
+// StorableHeader returns a copy of header without hop-by-hop and per-response headers
+func StorableHeader(header http.Header) http.Header {
+	h := header.Clone()
+	for _, name := range connectionHeaders(header) {
+		h.Del(name)
+	}
+	for _, name := range uncachedHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// connectionHeaders lists the headers named by Connection, which are hop-by-hop
+func connectionHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Invalidates reports whether a response to method invalidates cached responses for
+// the same URL (RFC 9111 section 4.4)
+func Invalidates(method string, status int) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return status >= 200 && status < 400
+}
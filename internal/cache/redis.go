@@ -0,0 +1,362 @@
+package cache
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Key suffixes of the Vary header names, the variant keys and the fetch lock of a cached resource
+const (
+	varySuffix     = "|vary"
+	variantsSuffix = "|variants"
+	lockSuffix     = "|lock"
+)
+
+// unlockScript deletes a lock only if it still holds the caller's token
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// Redis stores responses in Redis. Responses with a Vary header are stored per
+// variant: the base key records the varying request headers and each variant is
+// stored under a key derived from their values. Entries are serialized with codec.
+//
+// The Redis keys of one cached resource share a hash tag so that they live in the same
+// Cluster slot; commands and transactions never span several resources.
+type Redis struct {
+	client redis.UniversalClient
+	codec  Codec
+}
+
+// NewRedis creates a cache backend on a standalone, Sentinel or Cluster client
+func NewRedis(client redis.UniversalClient, codec Codec) *Redis {
+	return &Redis{client: client, codec: codec}
+}
+
+// entryKey is the Redis key of a cached resource. Its suffixed keys (Vary spec,
+// variants, lock) hash to the same Cluster slot.
+func entryKey(key string) string {
+	return entryPrefix + "{" + key + "}"
+}
+
+// Lookup returns the entry stored for key that matches the request's varying headers,
+// or nil on a miss. Entries that cannot be decoded, such as those written in a newer
+// format, are treated as misses.
+func (c *Redis) Lookup(ctx context.Context, key string, req *http.Request) (*Entry, error) {
+	key = entryKey(key)
+	values, err := c.client.MGet(ctx, key+varySuffix, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := values[1].(string)
+	if spec, ok := values[0].(string); ok {
+		var names []string
+		if err := json.Unmarshal([]byte(spec), &names); err != nil {
+			return nil, nil
+		}
+		data, err = c.client.Get(ctx, VariantKey(key, names, req)).Result()
+		if err == redis.Nil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	entry, err := Decode([]byte(data))
+	if err != nil {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Store saves an entry for ttl and records it in the collection's index and the sets
+// of its tags so it can be purged. The entry's keys are written in one transaction; the
+// index and tag sets live in other slots and are updated after it.
+func (c *Redis) Store(ctx context.Context, key string, req *http.Request, entry *Entry, ttl time.Duration) error {
+	entry.Meta.Size = len(entry.Body)
+	entry.Meta.ExpiresAt = time.Now().Add(ttl)
+	meta := entry.Meta
+	data, err := c.codec.Encode(entry)
+	if err != nil {
+		return err
+	}
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	k := entryKey(key)
+	tx := c.client.TxPipeline()
+	if len(entry.Vary) > 0 {
+		spec, _ := json.Marshal(entry.Vary)
+		variant := VariantKey(k, entry.Vary, req)
+		tx.Set(ctx, k+varySuffix, spec, ttl)
+		tx.Set(ctx, variant, data, ttl)
+		tx.Del(ctx, k)
+		tx.SAdd(ctx, k+variantsSuffix, variant)
+		extendTTL(ctx, tx, k+variantsSuffix, ttl)
+	} else {
+		tx.Set(ctx, k, data, ttl)
+		tx.Del(ctx, k+varySuffix)
+	}
+	if _, err := tx.Exec(ctx); err != nil {
+		return err
+	}
+
+	pipe := c.client.Pipeline()
+	pipe.HSet(ctx, indexKey(meta.Collection), key, metaData)
+	extendTTL(ctx, pipe, indexKey(meta.Collection), ttl)
+	for _, tag := range meta.Tags {
+		pipe.SAdd(ctx, tagKey(meta.Collection, tag), key)
+		extendTTL(ctx, pipe, tagKey(meta.Collection, tag), ttl)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Invalidate removes the entry for key and all its variants
+func (c *Redis) Invalidate(ctx context.Context, collection, key string) error {
+	if err := c.deleteEntries(ctx, []string{key}); err != nil {
+		return err
+	}
+	return c.client.HDel(ctx, indexKey(collection), key).Err()
+}
+
+// extendTTL sets the expiry of a set or hash shared by several entries so it outlives
+// the longest-lived of them
+func extendTTL(ctx context.Context, pipe redis.Pipeliner, key string, ttl time.Duration) {
+	pipe.ExpireNX(ctx, key, ttl)
+	pipe.ExpireGT(ctx, key, ttl)
+}
+
+// Lock acquires the cross-instance fetch lock of key for ttl. It returns the token
+// needed to release the lock, or an empty token when another instance holds it.
+func (c *Redis) Lock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	token := uuid.NewString()
+	ok, err := c.client.SetNX(ctx, entryKey(key)+lockSuffix, token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// Unlock releases a fetch lock acquired with Lock
+func (c *Redis) Unlock(ctx context.Context, key, token string) error {
+	return unlockScript.Run(ctx, c.client, []string{entryKey(key) + lockSuffix}, token).Err()
+}
+
+// VariantKey derives the key of the variant selected by the request's values of the
+// varying headers
+func VariantKey(key string, names []string, req *http.Request) string {
+	var b strings.Builder
+	for _, name := range names {
+		var values []string
+		for _, v := range req.Header.Values(name) {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+		fmt.Fprintf(&b, "%s=%s\n", strings.ToLower(name), strings.Join(values, ","))
+	}
+	return fmt.Sprintf("%s|v:%x", key, md5.Sum([]byte(b.String())))
+}
+
+// Redis key prefixes of cached resources, the per-collection entry index and the
+// per-collection tag sets. The index and tag sets hold the keys passed to the backend.
+const (
+	entryPrefix = "midgard:cache:entry:"
+	indexPrefix = "midgard:cache:index:"
+	tagPrefix   = "midgard:cache:tag:"
+)
+
+// scanCount is the number of index fields requested per HSCAN call
+const scanCount = 500
+
+func indexKey(collection string) string {
+	return indexPrefix + collection
+}
+
+// tagKey is the set of a collection's entries tagged with tag. Tags are scoped to the
+// collection, since upstreams choose them independently.
+func tagKey(collection, tag string) string {
+	return tagPrefix + collection + ":" + tag
+}
+
+// Purge removes the cached responses of a collection for which match returns true, or
+// all of them when match is nil, and returns how many were removed. Only the index
+// fields that were scanned are removed, so entries stored during the purge stay indexed.
+func (c *Redis) Purge(ctx context.Context, collection string, match func(Meta) bool) (int, error) {
+	var keys []string
+	if err := c.scanIndex(ctx, collection, func(key string, meta Meta) bool {
+		if match == nil || match(meta) {
+			keys = append(keys, key)
+			return true
+		}
+		return false
+	}); err != nil {
+		return 0, err
+	}
+	return len(keys), c.deleteEntries(ctx, keys)
+}
+
+// PurgeTags removes the cached responses of a collection tagged with any of tags and
+// returns how many were removed. Entries are left in their collection index until it
+// is next scanned.
+func (c *Redis) PurgeTags(ctx context.Context, collection string, tags []string) (int, error) {
+	seen := map[string]bool{}
+	var keys []string
+	scanned := make(map[string][]string, len(tags))
+	for _, tag := range tags {
+		iter := c.client.SScan(ctx, tagKey(collection, tag), 0, "", scanCount).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			scanned[tag] = append(scanned[tag], key)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if err := c.deleteEntries(ctx, keys); err != nil {
+		return 0, err
+	}
+	// Remove only the purged members, so entries tagged during the purge keep their tags
+	for tag, members := range scanned {
+		for len(members) > 0 {
+			batch := members[:min(len(members), scanCount)]
+			members = members[len(batch):]
+			if err := c.client.SRem(ctx, tagKey(collection, tag), batch).Err(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(keys), nil
+}
+
+// Stats counts the live entries of a collection and their body sizes
+func (c *Redis) Stats(ctx context.Context, collection string) (Stats, error) {
+	var stats Stats
+	err := c.scanIndex(ctx, collection, func(key string, meta Meta) bool {
+		stats.Entries++
+		stats.Bytes += int64(meta.Size)
+		return false
+	})
+	return stats, err
+}
+
+// scanIndex calls fn for every live entry in a collection's index. Index fields of
+// expired entries, of entries removed by tag purges and those for which fn returns
+// true are deleted from the index.
+func (c *Redis) scanIndex(ctx context.Context, collection string, fn func(key string, meta Meta) bool) error {
+	index := indexKey(collection)
+	now := time.Now()
+	var cursor uint64
+	for {
+		fields, next, err := c.client.HScan(ctx, index, cursor, "", scanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		// HSCAN returns alternating field names and values
+		var keys []string
+		metas := map[string]Meta{}
+		var remove []string
+		for i := 0; i+1 < len(fields); i += 2 {
+			var meta Meta
+			if err := json.Unmarshal([]byte(fields[i+1]), &meta); err != nil || !now.Before(meta.ExpiresAt) {
+				remove = append(remove, fields[i])
+				continue
+			}
+			keys = append(keys, fields[i])
+			metas[fields[i]] = meta
+		}
+		live, err := c.liveKeys(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if !live[key] {
+				remove = append(remove, key)
+				continue
+			}
+			meta := metas[key]
+			meta.Collection = collection
+			if fn(key, meta) {
+				remove = append(remove, key)
+			}
+		}
+		if len(remove) > 0 {
+			if err := c.client.HDel(ctx, index, remove...).Err(); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// liveKeys reports which base keys still hold an entry or a set of variants
+func (c *Redis) liveKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	live := map[string]bool{}
+	if len(keys) == 0 {
+		return live, nil
+	}
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		k := entryKey(key)
+		cmds[i] = pipe.Exists(ctx, k, k+varySuffix)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		live[keys[i]] = cmd.Val() > 0
+	}
+	return live, nil
+}
+
+// deleteEntries removes base keys together with their Vary specs and variants. Each
+// resource is deleted with its own command so no command spans Cluster slots.
+func (c *Redis) deleteEntries(ctx context.Context, keys []string) error {
+	// Pipeline in batches to keep requests small
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), scanCount)]
+		keys = keys[len(batch):]
+
+		pipe := c.client.Pipeline()
+		variantCmds := make([]*redis.StringSliceCmd, len(batch))
+		for i, key := range batch {
+			variantCmds[i] = pipe.SMembers(ctx, entryKey(key)+variantsSuffix)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+
+		pipe = c.client.Pipeline()
+		for i, key := range batch {
+			k := entryKey(key)
+			del := append([]string{k, k + varySuffix, k + variantsSuffix}, variantCmds[i].Val()...)
+			pipe.Del(ctx, del...)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
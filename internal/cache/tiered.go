@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Tiered serves entries from a local in-process cache (L1) in front of a shared backend
+// (L2). Entries are kept locally for at most localTTL, which bounds how long an instance
+// can serve a response that was replaced or purged through another instance. L2 errors
+// are returned, but the local tier keeps working while L2 is unavailable.
+type Tiered struct {
+	local    *Memory
+	shared   Backend
+	localTTL time.Duration
+}
+
+// NewTiered creates a two-tier cache
+func NewTiered(local *Memory, shared Backend, localTTL time.Duration) *Tiered {
+	return &Tiered{local: local, shared: shared, localTTL: localTTL}
+}
+
+// Lookup checks the local tier first and copies shared hits into it
+func (t *Tiered) Lookup(ctx context.Context, key string, req *http.Request) (*Entry, error) {
+	if entry, _ := t.local.Lookup(ctx, key, req); entry != nil {
+		return entry, nil
+	}
+	entry, err := t.shared.Lookup(ctx, key, req)
+	if entry == nil {
+		return nil, err
+	}
+
+	ttl := t.localTTL
+	if !entry.Meta.ExpiresAt.IsZero() {
+		ttl = min(ttl, time.Until(entry.Meta.ExpiresAt))
+	}
+	if ttl > 0 {
+		local := *entry
+		t.local.Store(ctx, key, req, &local, ttl)
+	}
+	return entry, nil
+}
+
+// Store saves the entry in both tiers
+func (t *Tiered) Store(ctx context.Context, key string, req *http.Request, entry *Entry, ttl time.Duration) error {
+	err := t.shared.Store(ctx, key, req, entry, ttl)
+	local := *entry
+	t.local.Store(ctx, key, req, &local, min(ttl, t.localTTL))
+	return err
+}
+
+// Invalidate removes the entry from both tiers
+func (t *Tiered) Invalidate(ctx context.Context, collection, key string) error {
+	t.local.Invalidate(ctx, collection, key)
+	return t.shared.Invalidate(ctx, collection, key)
+}
+
+// Purge removes matching entries from both tiers and reports the shared tier's count
+func (t *Tiered) Purge(ctx context.Context, collection string, match func(Meta) bool) (int, error) {
+	t.local.Purge(ctx, collection, match)
+	return t.shared.Purge(ctx, collection, match)
+}
+
+// PurgeTags removes tagged entries from both tiers and reports the shared tier's count
+func (t *Tiered) PurgeTags(ctx context.Context, collection string, tags []string) (int, error) {
+	t.local.PurgeTags(ctx, collection, tags)
+	return t.shared.PurgeTags(ctx, collection, tags)
+}
+
+// Stats reports the shared tier's statistics
+func (t *Tiered) Stats(ctx context.Context, collection string) (Stats, error) {
+	return t.shared.Stats(ctx, collection)
+}
+
+// Lock acquires the shared tier's fetch lock when it has one, and otherwise always succeeds
+func (t *Tiered) Lock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if locker, ok := t.shared.(Locker); ok {
+		return locker.Lock(ctx, key, ttl)
+	}
+	return "local", nil
+}
+
+// Unlock releases a lock acquired with Lock
+func (t *Tiered) Unlock(ctx context.Context, key, token string) error {
+	if locker, ok := t.shared.(Locker); ok {
+		return locker.Unlock(ctx, key, token)
+	}
+	return nil
+}
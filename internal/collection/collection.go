@@ -1,15 +1,22 @@
 package collection
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/midgard/gateway/internal/database"
 	"github.com/midgard/gateway/internal/openapi"
+	"github.com/midgard/gateway/internal/protoset"
 	"gorm.io/gorm"
 )
 
+// ErrEndpointsInUse is returned when an import would remove endpoints that cache rules
+// or SLOs still refer to
+var ErrEndpointsInUse = errors.New("endpoints are still in use")
+
 // CollectionManager manages collections
 type CollectionManager struct {
 	db *gorm.DB
@@ -103,40 +110,152 @@ func (cm *CollectionManager) ImportOpenAPI(collectionID string, openAPIURL strin
 		return fmt.Errorf("failed to import OpenAPI: %w", err)
 	}
 
-	// Delete existing endpoints
-	if err := cm.db.Where("collection_id = ?", collectionID).Delete(&database.Endpoint{}).Error; err != nil {
+	// Replace the endpoints and record the spec URL together, so a failed import leaves both unchanged
+	return cm.db.Transaction(func(tx *gorm.DB) error {
+		if err := replaceEndpoints(tx, collectionID, endpoints); err != nil {
+			return err
+		}
+
+		// Update collection's OpenAPI URL if provided
+		if openAPIURL != "" {
+			coll.OpenAPIURL = openAPIURL
+			coll.UpdatedAt = time.Now()
+			if err := tx.Save(coll).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportDescriptorSet replaces a collection's endpoints with the RPC methods of a
+// serialized protobuf descriptor set
+func (cm *CollectionManager) ImportDescriptorSet(collectionID string, descriptorSet []byte) error {
+	if _, err := cm.GetCollection(collectionID); err != nil {
+		return fmt.Errorf("collection not found: %w", err)
+	}
+
+	endpoints, err := protoset.ImportDescriptorSet(descriptorSet)
+	if err != nil {
+		return fmt.Errorf("failed to import descriptor set: %w", err)
+	}
+	return cm.db.Transaction(func(tx *gorm.DB) error {
+		return replaceEndpoints(tx, collectionID, endpoints)
+	})
+}
+
+// replaceEndpoints makes endpoints the collection's endpoint list. It runs in tx so
+// readers never see a partially replaced list.
+func replaceEndpoints(tx *gorm.DB, collectionID string, endpoints []database.Endpoint) error {
+	// Keep the IDs of endpoints that still exist so request logs stay linked to them
+	var existing []database.Endpoint
+	if err := tx.Where("collection_id = ?", collectionID).Find(&existing).Error; err != nil {
 		return err
 	}
+	existingByKey := make(map[string]database.Endpoint, len(existing))
+	for _, ep := range existing {
+		existingByKey[ep.Method+" "+ep.Path] = ep
+	}
 
-	// Create new endpoints
+	now := time.Now()
+	keep := make(map[uint]bool)
 	for i := range endpoints {
 		endpoints[i].CollectionID = collectionID
-		endpoints[i].CreatedAt = time.Now()
-		endpoints[i].UpdatedAt = time.Now()
+		endpoints[i].UpdatedAt = now
+		if old, ok := existingByKey[endpoints[i].Method+" "+endpoints[i].Path]; ok && !keep[old.ID] {
+			endpoints[i].ID = old.ID
+			endpoints[i].CreatedAt = old.CreatedAt
+			keep[old.ID] = true
+		} else {
+			endpoints[i].CreatedAt = now
+		}
 	}
 
-	if len(endpoints) > 0 {
-		if err := cm.db.Create(&endpoints).Error; err != nil {
+	// Delete endpoints no longer in the spec, unless something still refers to them
+	var removed []database.Endpoint
+	for _, ep := range existing {
+		if !keep[ep.ID] {
+			removed = append(removed, ep)
+		}
+	}
+	if err := checkEndpointsUnused(tx, removed); err != nil {
+		return err
+	}
+	for _, ep := range removed {
+		if err := tx.Delete(&database.Endpoint{}, ep.ID).Error; err != nil {
 			return err
 		}
 	}
 
-	// Update collection's OpenAPI URL if provided
-	if openAPIURL != "" {
-		coll.OpenAPIURL = openAPIURL
-		coll.UpdatedAt = time.Now()
-		if err := cm.db.Save(coll).Error; err != nil {
+	// Update kept endpoints and create new ones
+	for i := range endpoints {
+		if err := tx.Save(&endpoints[i]).Error; err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
+// checkEndpointsUnused returns ErrEndpointsInUse, naming the endpoints and their cache
+// rules and SLOs, when any of the endpoints is referenced
+func checkEndpointsUnused(tx *gorm.DB, endpoints []database.Endpoint) error {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(endpoints))
+	for i, ep := range endpoints {
+		ids[i] = ep.ID
+	}
+	var rules []database.CacheRule
+	if err := tx.Where("endpoint_id IN ?", ids).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+	var slos []database.SLO
+	if err := tx.Where("endpoint_id IN ?", ids).Order("id").Find(&slos).Error; err != nil {
+		return err
+	}
+
+	var conflicts []string
+	for _, ep := range endpoints {
+		var refs []string
+		for _, r := range rules {
+			if *r.EndpointID == ep.ID {
+				refs = append(refs, fmt.Sprintf("cache rule %d %q", r.ID, r.Name))
+			}
+		}
+		for _, slo := range slos {
+			if *slo.EndpointID == ep.ID {
+				refs = append(refs, fmt.Sprintf("SLO %d %q", slo.ID, slo.Name))
+			}
+		}
+		if len(refs) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("%s %s (used by %s)", ep.Method, ep.Path, strings.Join(refs, ", ")))
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: the import removes %s; update or delete them first", ErrEndpointsInUse, strings.Join(conflicts, "; "))
+}
+
 // GetCollectionByPrefix gets a collection by its prefix
 func (cm *CollectionManager) GetCollectionByPrefix(prefix string) (*database.Collection, error) {
 	var collection database.Collection
-	if err := cm.db.Preload("Endpoints").First(&collection, "prefix = ? AND active = ?", prefix, true).Error; err != nil {
+	rules := func(db *gorm.DB) *gorm.DB { return db.Order("priority DESC, id ASC") }
+	if err := cm.db.Preload("Endpoints").Preload("CacheRules", rules).First(&collection, "prefix = ? AND active = ?", prefix, true).Error; err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// GetCollectionByGRPCMethod gets the active gRPC collection declaring a method, given its
+// path /package.Service/Method. Methods come from imported descriptor sets.
+func (cm *CollectionManager) GetCollectionByGRPCMethod(method string) (*database.Collection, error) {
+	var collection database.Collection
+	err := cm.db.Joins("JOIN endpoints ON endpoints.collection_id = collections.id").
+		Where("collections.protocol = ? AND collections.active = ? AND endpoints.method = ? AND endpoints.path = ?", "grpc", true, "POST", method).
+		Order("collections.created_at ASC").First(&collection).Error
+	if err != nil {
 		return nil, err
 	}
 	return &collection, nil
@@ -0,0 +1,82 @@
+package collection
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+)
+
+func newTestManager(t *testing.T) *CollectionManager {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "collection.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return NewCollectionManager(db)
+}
+
+func spec(paths ...string) []byte {
+	var entries []string
+	for _, p := range paths {
+		entries = append(entries, `"`+p+`":{"get":{"summary":"get `+p+`"}}`)
+	}
+	return []byte(`{"openapi":"3.0.0","paths":{` + strings.Join(entries, ",") + `}}`)
+}
+
+func endpointIDs(t *testing.T, cm *CollectionManager, collectionID string) map[string]uint {
+	t.Helper()
+	coll, err := cm.GetCollection(collectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]uint{}
+	for _, ep := range coll.Endpoints {
+		ids[ep.Method+" "+ep.Path] = ep.ID
+	}
+	return ids
+}
+
+func TestReimportKeepsEndpointsInUse(t *testing.T) {
+	cm := newTestManager(t)
+	coll := &database.Collection{Name: "shop", Prefix: "shop", BaseURL: "http://upstream"}
+	if err := cm.CreateCollection(coll); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.ImportOpenAPI(coll.ID, "", spec("/items", "/items/{id}", "/orders")); err != nil {
+		t.Fatal(err)
+	}
+	before := endpointIDs(t, cm, coll.ID)
+	itemID, orderID := before["GET /items/{id}"], before["GET /orders"]
+	cm.db.Create(&database.CacheRule{CollectionID: coll.ID, Name: "item cache", EndpointID: &itemID})
+	cm.db.Create(&database.SLO{CollectionID: coll.ID, Name: "orders latency", EndpointID: &orderID, Type: "latency", Target: 99})
+
+	// Dropping referenced endpoints is rejected and changes nothing
+	err := cm.ImportOpenAPI(coll.ID, "", spec("/items"))
+	if !errors.Is(err, ErrEndpointsInUse) {
+		t.Fatalf("import error %v, want ErrEndpointsInUse", err)
+	}
+	for _, want := range []string{`GET /items/{id} (used by cache rule 1 "item cache")`, `GET /orders (used by SLO 1 "orders latency")`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if after := endpointIDs(t, cm, coll.ID); len(after) != 3 {
+		t.Fatalf("endpoints after rejected import: %v", after)
+	}
+
+	// Endpoints that stay keep their IDs, and unreferenced ones can be removed
+	if err := cm.ImportOpenAPI(coll.ID, "", spec("/items/{id}", "/orders")); err != nil {
+		t.Fatal(err)
+	}
+	after := endpointIDs(t, cm, coll.ID)
+	if len(after) != 2 || after["GET /items/{id}"] != itemID || after["GET /orders"] != orderID {
+		t.Fatalf("endpoints before %v, after %v", before, after)
+	}
+}
@@ -33,10 +33,12 @@ func InitDatabase(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 		// _busy_timeout: sets the busy timeout in milliseconds
 		// _journal_mode: WAL mode improves concurrency
 		// _foreign_keys: enable foreign key constraints
+		// modernc.org/sqlite only applies settings passed as _pragma, so the busy timeout is
+		// also set that way; health checks, alerts and the log writer write concurrently
 		if !strings.Contains(dsn, "?") {
-			dsn += "?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1"
+			dsn += "?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1&_pragma=busy_timeout(5000)"
 		} else {
-			dsn += "&_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1"
+			dsn += "&_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=1&_pragma=busy_timeout(5000)"
 		}
 		// Open database using modernc.org/sqlite driver
 		sqlDB, err := sql.Open("sqlite", dsn)
@@ -84,9 +86,21 @@ func InitDatabase(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 
 // AutoMigrate runs database migrations
 func AutoMigrate(db *gorm.DB) error {
+	// The rollup key used to leave out the endpoint, so endpoints sharing a path template collided
+	if db.Migrator().HasIndex(&RequestRollup{}, "idx_request_rollups_key") {
+		if err := db.Migrator().DropIndex(&RequestRollup{}, "idx_request_rollups_key"); err != nil {
+			return err
+		}
+	}
 	return db.AutoMigrate(
 		&Collection{},
 		&Endpoint{},
 		&RequestLog{},
+		&RequestRollup{},
+		&RollupCursor{},
+		&CacheRule{},
+		&SLO{},
+		&AlertHistory{},
+		&HealthCheckResult{},
 	)
 }
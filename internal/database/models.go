@@ -8,27 +8,51 @@ import (
 
 // Collection represents a collection of endpoints
 type Collection struct {
-	ID            string         `gorm:"primaryKey;type:varchar(255)" json:"id"`
-	Name          string         `gorm:"type:varchar(255);not null" json:"name"`
-	Description   string         `gorm:"type:text" json:"description"`
-	Prefix        string         `gorm:"type:varchar(255);not null" json:"prefix"` // External gateway prefix
-	BaseURL       string         `gorm:"type:varchar(500);not null" json:"base_url"` // Target base URL
-	OpenAPIURL    string         `gorm:"type:varchar(500)" json:"openapi_url"`
-	HealthPath    string         `gorm:"type:varchar(255)" json:"health_path"` // Health check path, e.g., /health
-	HealthInterval int           `gorm:"default:30" json:"health_interval"` // Health check interval in seconds
-	LogEnabled     bool          `gorm:"default:true" json:"log_enabled"`
-	LogRolling     bool          `gorm:"default:true" json:"log_rolling"`
-	LogMaxEntries  int           `gorm:"default:1000" json:"log_max_entries"`
-	CacheEnabled    bool          `gorm:"default:false" json:"cache_enabled"`
-	CacheTTL        int           `gorm:"default:300" json:"cache_ttl"` // Cache TTL in seconds
-	CacheKeyStrategy string       `gorm:"type:varchar(50);default:'all'" json:"cache_key_strategy"` // "params", "body", "all"
-	Active          bool          `gorm:"default:true" json:"active"`
-	CreatedAt       time.Time     `json:"created_at"`
-	UpdatedAt       time.Time     `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	
+	ID                        string         `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	Name                      string         `gorm:"type:varchar(255);not null" json:"name"`
+	Description               string         `gorm:"type:text" json:"description"`
+	Prefix                    string         `gorm:"type:varchar(255);not null" json:"prefix"`   // External gateway prefix
+	BaseURL                   string         `gorm:"type:varchar(500);not null" json:"base_url"` // Target base URL
+	OpenAPIURL                string         `gorm:"type:varchar(500)" json:"openapi_url"`
+	Protocol                  string         `gorm:"type:varchar(10);default:'http'" json:"protocol"`    // "http" or "grpc" (HTTP/2 upstream, h2c for http:// base URLs)
+	GRPCWeb                   bool           `gorm:"default:false" json:"grpc_web"`                      // gRPC collections: translate gRPC-Web requests from browsers
+	HealthPath                string         `gorm:"type:varchar(255)" json:"health_path"`               // Health check path, e.g., /health
+	HealthInterval            int            `gorm:"default:30" json:"health_interval"`                  // Health check interval in seconds
+	HealthType                string         `gorm:"type:varchar(10);default:'http'" json:"health_type"` // "http", "tcp" or "grpc"
+	HealthTarget              string         `gorm:"type:varchar(500)" json:"health_target"`             // Probe host:port or URL instead of BaseURL
+	HealthGRPCService         string         `gorm:"type:varchar(255)" json:"health_grpc_service"`       // gRPC checks: service name, empty for the whole server
+	HealthMethod              string         `gorm:"type:varchar(10);default:'GET'" json:"health_method"`
+	HealthHeaders             string         `gorm:"type:text" json:"health_headers"`                 // JSON object of extra probe headers
+	HealthExpectedStatus      string         `gorm:"type:varchar(255)" json:"health_expected_status"` // e.g. "200-299,301"; empty means 2xx
+	HealthBodyContains        string         `gorm:"type:text" json:"health_body_contains"`           // Substring the response body must contain
+	HealthJSONPath            string         `gorm:"type:varchar(255)" json:"health_json_path"`       // e.g. $.status; must exist in the body
+	HealthJSONValue           string         `gorm:"type:varchar(255)" json:"health_json_value"`      // Expected value at HealthJSONPath, if set
+	HealthTimeout             int            `gorm:"default:5" json:"health_timeout"`                 // Probe timeout in seconds
+	HealthRise                int            `gorm:"default:1" json:"health_rise"`                    // Consecutive successes before marking healthy
+	HealthFall                int            `gorm:"default:1" json:"health_fall"`                    // Consecutive failures before marking unhealthy
+	LogEnabled                bool           `gorm:"default:true" json:"log_enabled"`
+	LogRolling                bool           `gorm:"default:true" json:"log_rolling"`
+	LogMaxEntries             int            `gorm:"default:1000" json:"log_max_entries"`
+	LogResponseBody           bool           `gorm:"default:false" json:"log_response_body"`          // Store response bodies in request logs
+	LogResponseBodyMaxSize    int            `gorm:"default:65536" json:"log_response_body_max_size"` // Max stored response body size in bytes
+	MaxRequestBodySize        int64          `gorm:"default:0" json:"max_request_body_size"`          // Larger requests are rejected with 413; 0 uses the gateway limit
+	MaxWebSocketConnections   int            `gorm:"default:0" json:"max_websocket_connections"`      // Open WebSocket connections allowed per gateway instance, 0 = unlimited
+	CacheEnabled              bool           `gorm:"default:false" json:"cache_enabled"`
+	CacheTTL                  int            `gorm:"default:300" json:"cache_ttl"`                             // Cache TTL in seconds
+	CacheKeyStrategy          string         `gorm:"type:varchar(50);default:'all'" json:"cache_key_strategy"` // "params", "body", "all"
+	CacheMode                 string         `gorm:"type:varchar(10);default:'ttl'" json:"cache_mode"`         // "ttl" or "http" (RFC 9111 semantics)
+	CacheMethods              string         `gorm:"type:varchar(100)" json:"cache_methods"`                   // HTTP mode: comma-separated cacheable methods, empty means GET,HEAD
+	CacheStaleWhileRevalidate int            `gorm:"default:0" json:"cache_stale_while_revalidate"`            // Seconds an expired response is served while it is refreshed
+	CacheStaleIfError         int            `gorm:"default:0" json:"cache_stale_if_error"`                    // Seconds an expired response is served when the upstream fails
+	CacheMaxSize              int            `gorm:"default:1048576" json:"cache_max_size"`                    // Largest response body in bytes that is cached
+	Active                    bool           `gorm:"default:true" json:"active"`
+	CreatedAt                 time.Time      `json:"created_at"`
+	UpdatedAt                 time.Time      `json:"updated_at"`
+	DeletedAt                 gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
 	// Relations
-	Endpoints []Endpoint `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE" json:"endpoints,omitempty"`
+	Endpoints  []Endpoint  `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE" json:"endpoints,omitempty"`
+	CacheRules []CacheRule `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE" json:"cache_rules,omitempty"`
 }
 
 // Endpoint represents an API endpoint
@@ -45,21 +69,131 @@ type Endpoint struct {
 
 // RequestLog represents a request log entry
 type RequestLog struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	CollectionID    string `gorm:"type:varchar(255);not null;index;index:idx_request_logs_collection_time,priority:1;index:idx_request_logs_collection_status,priority:1;index:idx_request_logs_collection_duration,priority:1" json:"collection_id"`
+	Path            string `gorm:"type:varchar(500);not null" json:"path"`
+	EndpointID      *uint  `gorm:"index" json:"endpoint_id"` // Matched OpenAPI endpoint, nil for unmatched paths
+	Method          string `gorm:"type:varchar(10);not null;index" json:"method"`
+	TargetURL       string `gorm:"type:varchar(1000);not null" json:"target_url"`
+	Status          int    `gorm:"not null;index;index:idx_request_logs_collection_status,priority:2" json:"status"`
+	Duration        int64  `gorm:"not null;index;index:idx_request_logs_collection_duration,priority:2" json:"duration"` // in milliseconds
+	RequestSize     int    `json:"request_size"`
+	ResponseSize    int    `json:"response_size"`
+	ClientIP        string `gorm:"type:varchar(50);index" json:"client_ip"`
+	RequestHeaders  string `gorm:"type:text" json:"request_headers"`          // JSON string
+	ResponseHeaders string `gorm:"type:text" json:"response_headers"`         // JSON string
+	RequestBody     string `gorm:"type:text" json:"request_body"`             // Request body content
+	RequestParams   string `gorm:"type:text" json:"request_params"`           // Query parameters (JSON string)
+	ResponseBody    string `gorm:"type:text" json:"response_body"`            // Response body content (if enabled for the collection)
+	FromCache       bool   `gorm:"default:false" json:"from_cache"`           // Whether response came from cache
+	RequestID       string `gorm:"type:varchar(128);index" json:"request_id"` // X-Request-ID shared with the upstream and the client
+	TraceID         string `gorm:"type:varchar(32);index" json:"trace_id"`    // W3C trace ID, when tracing is enabled
+
+	// WebSocket connections (status 101) are logged once when they close. Duration covers the
+	// whole connection and the request and response sizes count the bytes sent each way.
+	MessagesSent     int64 `json:"messages_sent"`     // Data messages from the client to the upstream
+	MessagesReceived int64 `json:"messages_received"` // Data messages from the upstream to the client
+
+	// gRPC calls record the call's status; Status then holds its HTTP equivalent
+	GRPCStatus  *int   `gorm:"index" json:"grpc_status"`              // nil for other requests
+	GRPCMessage string `gorm:"type:varchar(500)" json:"grpc_message"` // Status message of failed calls
+
+	// Upstream timing breakdown, in microseconds (zero when not applicable, e.g. reused connections or cache hits)
+	DNSTime      int64     `json:"dns_time"`
+	ConnectTime  int64     `json:"connect_time"`
+	TLSTime      int64     `json:"tls_time"`
+	TTFB         int64     `json:"ttfb"`          // Time from sending the request to the first response byte
+	TransferTime int64     `json:"transfer_time"` // Time from the first to the last response byte
+	Timestamp    time.Time `gorm:"index;index:idx_request_logs_collection_time,priority:2" json:"timestamp"`
+}
+
+// RequestRollup holds pre-aggregated request statistics for one endpoint over one time bucket
+type RequestRollup struct {
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	CollectionID string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_request_rollups_bucket,priority:1;index:idx_request_rollups_query,priority:1" json:"collection_id"`
+	Granularity  string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_request_rollups_bucket,priority:2;index:idx_request_rollups_query,priority:2" json:"granularity"` // "minute" or "hour"
+	BucketStart  time.Time `gorm:"not null;uniqueIndex:idx_request_rollups_bucket,priority:3;index:idx_request_rollups_query,priority:3" json:"bucket_start"`
+	EndpointID   uint      `gorm:"not null;default:0;index;uniqueIndex:idx_request_rollups_bucket,priority:4" json:"endpoint_id"` // 0 for unmatched paths
+	Path         string    `gorm:"type:varchar(500);not null;uniqueIndex:idx_request_rollups_bucket,priority:5" json:"path"`      // Endpoint template, or the raw path when unmatched
+	Method       string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_request_rollups_bucket,priority:6" json:"method"`
+	RequestCount int64     `json:"request_count"`
+	Status2xx    int64     `json:"status_2xx"`
+	Status3xx    int64     `json:"status_3xx"`
+	Status4xx    int64     `json:"status_4xx"`
+	Status5xx    int64     `json:"status_5xx"`
+	CacheHits    int64     `json:"cache_hits"`
+	DurationSum  int64     `json:"duration_sum"`       // in milliseconds
+	DurationMax  int64     `json:"duration_max"`       // in milliseconds
+	Histogram    string    `gorm:"type:text" json:"-"` // JSON array of latency bucket counts
+}
+
+// RollupCursor records how far the rollup job has processed request logs
+type RollupCursor struct {
+	Name      string    `gorm:"primaryKey;type:varchar(50)" json:"name"`
+	LastLogID uint      `json:"last_log_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CacheRule overrides a collection's cache settings for the requests of one endpoint or
+// path pattern. The matching rule with the highest priority applies.
+type CacheRule struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	CollectionID   string    `gorm:"type:varchar(255);not null;index" json:"collection_id"`
-	Path           string    `gorm:"type:varchar(500);not null" json:"path"`
-	Method         string    `gorm:"type:varchar(10);not null" json:"method"`
-	TargetURL      string    `gorm:"type:varchar(1000);not null" json:"target_url"`
-	Status         int       `gorm:"not null" json:"status"`
-	Duration       int64     `gorm:"not null" json:"duration"` // in milliseconds
-	RequestSize    int       `json:"request_size"`
-	ResponseSize   int       `json:"response_size"`
-	ClientIP       string    `gorm:"type:varchar(50)" json:"client_ip"`
-	RequestHeaders string    `gorm:"type:text" json:"request_headers"` // JSON string
-	ResponseHeaders string   `gorm:"type:text" json:"response_headers"` // JSON string
-	RequestBody    string    `gorm:"type:text" json:"request_body"` // Request body content
-	RequestParams  string    `gorm:"type:text" json:"request_params"` // Query parameters (JSON string)
-	FromCache      bool      `gorm:"default:false" json:"from_cache"` // Whether response came from cache
-	Timestamp      time.Time `gorm:"index" json:"timestamp"`
+	Name           string    `gorm:"type:varchar(255)" json:"name"`
+	EndpointID     *uint     `gorm:"index" json:"endpoint_id"`                  // Requests routed to this endpoint; nil matches any
+	PathPattern    string    `gorm:"type:varchar(500)" json:"path_pattern"`     // e.g. /users/* or /reports/**; empty matches any path
+	Methods        string    `gorm:"type:varchar(100)" json:"methods"`          // Comma-separated, empty matches any method
+	Priority       int       `gorm:"default:0" json:"priority"`                 // Higher priorities are matched first
+	Bypass         bool      `gorm:"default:false" json:"bypass"`               // Never cache matching requests
+	TTL            int       `gorm:"default:0" json:"ttl"`                      // Seconds; 0 uses the collection TTL
+	KeyHeaders     string    `gorm:"type:varchar(500)" json:"key_headers"`      // Comma-separated request headers added to the key
+	KeyQuery       string    `gorm:"type:varchar(500)" json:"key_query"`        // Comma-separated query params in the key; empty means all
+	KeyQueryIgnore string    `gorm:"type:varchar(500)" json:"key_query_ignore"` // Comma-separated query params left out of the key
+	KeyBodyFields  string    `gorm:"type:varchar(500)" json:"key_body_fields"`  // Comma-separated JSON paths, e.g. $.tenant; replaces the body hash
+	KeyConsumer    bool      `gorm:"default:false" json:"key_consumer"`         // Cache per consumer, which also allows private responses
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SLO is a service level objective for a collection or one of its endpoints
+type SLO struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Name             string    `gorm:"type:varchar(255);not null" json:"name"`
+	CollectionID     string    `gorm:"type:varchar(255);not null;index" json:"collection_id"`
+	EndpointID       *uint     `gorm:"index" json:"endpoint_id"`              // nil covers the whole collection
+	Type             string    `gorm:"type:varchar(20);not null" json:"type"` // "availability" or "latency"
+	Target           float64   `gorm:"not null" json:"target"`                // Percentage of good requests, e.g. 99.9
+	LatencyThreshold int64     `gorm:"default:0" json:"latency_threshold"`    // Latency SLOs: requests slower than this (ms) are bad
+	WindowDays       int       `gorm:"default:30" json:"window_days"`         // Rolling window for the error budget
+	Enabled          bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
+// AlertHistory records each alert from firing to resolution
+type AlertHistory struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Key         string     `gorm:"type:varchar(255);not null;index" json:"key"`
+	Rule        string     `gorm:"type:varchar(50);not null;index" json:"rule"`
+	Severity    string     `gorm:"type:varchar(20)" json:"severity"`
+	Status      string     `gorm:"type:varchar(20);index" json:"status"` // "firing" or "resolved"
+	Summary     string     `gorm:"type:text" json:"summary"`
+	Description string     `gorm:"type:text" json:"description"`
+	Labels      string     `gorm:"type:text" json:"labels"` // JSON object
+	Value       float64    `json:"value"`
+	Notified    bool       `json:"notified"` // False when suppressed by the cooldown
+	StartsAt    time.Time  `gorm:"index" json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+}
+
+// HealthCheckResult records one health probe of a collection
+type HealthCheckResult struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CollectionID string    `gorm:"type:varchar(255);not null;index:idx_health_check_results_collection_time,priority:1" json:"collection_id"`
+	Success      bool      `json:"success"`     // Whether this probe passed
+	Healthy      bool      `json:"healthy"`     // Collection state after applying rise/fall thresholds
+	StatusCode   int       `json:"status_code"` // 0 when no response was received
+	Latency      int64     `json:"latency"`     // in milliseconds
+	Error        string    `gorm:"type:text" json:"error"`
+	CheckedAt    time.Time `gorm:"index;index:idx_health_check_results_collection_time,priority:2" json:"checked_at"`
+}
@@ -1,136 +1,456 @@
 package health
 
 import (
-	"fmt"
-	"net/http"
+	"context"
+	"errors"
+	"log"
 	"sync"
 	"time"
 
+	"github.com/midgard/gateway/config"
 	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
 )
 
-// HealthChecker manages health checks for collections
+// Health states
+const (
+	StateUnknown   = "unknown" // No probe has completed yet
+	StateHealthy   = "healthy"
+	StateUnhealthy = "unhealthy"
+)
+
+// TransitionFunc is called when a collection's health state changes
+type TransitionFunc func(collectionID string, healthy bool, url string)
+
+// HealthChecker manages health checks for collections. All check state is
+// guarded by mu; probes run without holding it.
 type HealthChecker struct {
-	checks map[string]*HealthCheck
-	mu     sync.RWMutex
+	checks        map[string]*HealthCheck
+	mu            sync.RWMutex
+	onTransition  TransitionFunc
+	db            *gorm.DB
+	retention     time.Duration
+	failOpen      bool
+	restoreMaxAge time.Duration
+	stopped       bool
+	pending       []transition  // Transitions waiting to be delivered, in order
+	wake          chan struct{} // Signals the dispatcher that transitions are pending
+	wg            sync.WaitGroup
+	stopChan      chan struct{}
+	stopOnce      sync.Once
 }
 
-// HealthCheck represents a health check for a collection
+type transition struct {
+	collectionID string
+	healthy      bool
+	url          string
+}
+
+// HealthCheck represents a health check for a collection. Fields are guarded by HealthChecker.mu.
 type HealthCheck struct {
 	CollectionID string
 	URL          string
 	Interval     time.Duration
+	State        string
 	LastCheck    time.Time
-	IsHealthy    bool
+	LastResult   Result
+	Rise         int // Consecutive successes needed to become healthy
+	Fall         int // Consecutive failures needed to become unhealthy
+	successes    int
+	failures     int
+	probe        Prober
 	stopChan     chan struct{}
 }
 
-// NewHealthChecker creates a new health checker
-func NewHealthChecker() *HealthChecker {
-	return &HealthChecker{
-		checks: make(map[string]*HealthCheck),
+// Status is a snapshot of a collection's health check
+type Status struct {
+	CollectionID         string    `json:"collection_id"`
+	Type                 string    `json:"type"`
+	URL                  string    `json:"url"`
+	Interval             int       `json:"interval"` // in seconds
+	State                string    `json:"state"`
+	Healthy              bool      `json:"healthy"` // Whether traffic is routed; unknown follows the fail-open setting
+	LastCheck            time.Time `json:"last_check"`
+	LastResult           Result    `json:"last_result"`
+	LastLatency          int64     `json:"last_latency"` // in milliseconds
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	Rise                 int       `json:"rise"`
+	Fall                 int       `json:"fall"`
+}
+
+// NewHealthChecker creates a new health checker that records check results in db
+func NewHealthChecker(db *gorm.DB, cfg config.HealthConfig) *HealthChecker {
+	hc := &HealthChecker{
+		checks:        make(map[string]*HealthCheck),
+		db:            db,
+		retention:     time.Duration(cfg.HistoryRetentionDays) * 24 * time.Hour,
+		failOpen:      cfg.FailOpen,
+		restoreMaxAge: cfg.RestoreMaxAge,
+		wake:          make(chan struct{}, 1),
+		stopChan:      make(chan struct{}),
+	}
+	hc.wg.Add(1)
+	go hc.dispatchTransitions()
+	return hc
+}
+
+// Start starts pruning check results older than the retention period
+func (hc *HealthChecker) Start() {
+	if hc.retention <= 0 {
+		return
+	}
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		hc.pruneHistory()
+		for {
+			select {
+			case <-ticker.C:
+				hc.pruneHistory()
+			case <-hc.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops all checks and background loops and waits for them to exit.
+// Pending transitions are delivered before it returns.
+func (hc *HealthChecker) Stop() {
+	hc.stopOnce.Do(func() {
+		hc.mu.Lock()
+		hc.stopped = true
+		for id, check := range hc.checks {
+			close(check.stopChan)
+			delete(hc.checks, id)
+		}
+		hc.mu.Unlock()
+		close(hc.stopChan)
+	})
+	hc.wg.Wait()
+}
+
+func (hc *HealthChecker) pruneHistory() {
+	result := hc.db.Where("checked_at < ?", time.Now().Add(-hc.retention)).Delete(&database.HealthCheckResult{})
+	if result.Error != nil {
+		log.Printf("Failed to prune health check history: %v", result.Error)
 	}
 }
 
-// StartHealthCheck starts health checking for a collection
+// StartHealthCheck starts health checking for a collection. A running check keeps
+// its state when restarted; otherwise the state is restored from a recent check
+// result, or starts unknown.
 func (hc *HealthChecker) StartHealthCheck(coll *database.Collection) {
+	hc.mu.RLock()
+	_, running := hc.checks[coll.ID]
+	hc.mu.RUnlock()
+	restored := StateUnknown
+	if !running && Enabled(coll) {
+		restored = hc.restoreState(coll.ID)
+	}
+
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
+	if hc.stopped {
+		return
+	}
 
-	// Stop existing check if any
+	state, fromHistory := restored, true
 	if existing, exists := hc.checks[coll.ID]; exists {
-		select {
-		case <-existing.stopChan:
-			// Already closed
-		default:
-			close(existing.stopChan)
-		}
+		state, fromHistory = existing.State, false
+		close(existing.stopChan)
 		delete(hc.checks, coll.ID)
 	}
 
-	if coll.HealthPath == "" {
+	if !Enabled(coll) {
+		if state == StateUnhealthy {
+			hc.notifyTransition(coll.ID, true, "")
+		}
 		return
 	}
 
-	healthURL := fmt.Sprintf("%s%s", coll.BaseURL, coll.HealthPath)
+	probe, err := NewProbe(coll)
+	if err != nil {
+		log.Printf("Invalid health check for collection %s: %v", coll.ID, err)
+		if state == StateUnhealthy {
+			hc.notifyTransition(coll.ID, true, "")
+		}
+		return
+	}
 	interval := time.Duration(coll.HealthInterval) * time.Second
-	if interval == 0 {
+	if interval <= 0 {
 		interval = 30 * time.Second
 	}
 
 	check := &HealthCheck{
 		CollectionID: coll.ID,
-		URL:          healthURL,
+		URL:          probe.Target(),
 		Interval:     interval,
-		IsHealthy:    true,
+		State:        state,
+		Rise:         max(coll.HealthRise, 1),
+		Fall:         max(coll.HealthFall, 1),
+		probe:        probe,
 		stopChan:     make(chan struct{}),
 	}
-
 	hc.checks[coll.ID] = check
 
-	// Start checking
+	// A collection restored as unhealthy is reported again, since alerts do not survive restarts
+	if state == StateUnhealthy && fromHistory {
+		hc.notifyTransition(coll.ID, false, check.URL)
+	}
+
+	hc.wg.Add(1)
 	go hc.runHealthCheck(check)
 }
 
+// restoreState returns the state recorded by the latest check result if it is
+// recent enough, and unknown otherwise
+func (hc *HealthChecker) restoreState(collectionID string) string {
+	if hc.restoreMaxAge <= 0 {
+		return StateUnknown
+	}
+	var last database.HealthCheckResult
+	err := hc.db.Where("collection_id = ? AND checked_at >= ?", collectionID, time.Now().Add(-hc.restoreMaxAge)).
+		Order("checked_at DESC").First(&last).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to restore health state for collection %s: %v", collectionID, err)
+		}
+		return StateUnknown
+	}
+	if last.Healthy {
+		return StateHealthy
+	}
+	return StateUnhealthy
+}
+
 // StopHealthCheck stops health checking for a collection
 func (hc *HealthChecker) StopHealthCheck(collectionID string) {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
 
 	if check, exists := hc.checks[collectionID]; exists {
+		close(check.stopChan)
+		delete(hc.checks, collectionID)
+		if check.State == StateUnhealthy {
+			hc.notifyTransition(collectionID, true, "")
+		}
+	}
+}
+
+// OnTransition registers a function called when a check becomes unhealthy, or healthy
+// again after being unhealthy. Stopping the check of an unhealthy collection is
+// reported as a recovery with an empty URL.
+func (hc *HealthChecker) OnTransition(fn TransitionFunc) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.onTransition = fn
+}
+
+// notifyTransition queues a transition for the dispatcher; callers hold hc.mu
+func (hc *HealthChecker) notifyTransition(collectionID string, healthy bool, url string) {
+	if hc.onTransition == nil {
+		return
+	}
+	hc.pending = append(hc.pending, transition{collectionID: collectionID, healthy: healthy, url: url})
+	select {
+	case hc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchTransitions delivers transitions one at a time and in order, without holding hc.mu
+func (hc *HealthChecker) dispatchTransitions() {
+	defer hc.wg.Done()
+	for {
 		select {
-		case <-check.stopChan:
-			// Already closed
+		case <-hc.wake:
+		case <-hc.stopChan:
+		}
+
+		hc.mu.Lock()
+		pending, fn := hc.pending, hc.onTransition
+		hc.pending = nil
+		hc.mu.Unlock()
+		for _, t := range pending {
+			fn(t.collectionID, t.healthy, t.url)
+		}
+
+		select {
+		case <-hc.stopChan:
+			return
 		default:
-			close(check.stopChan)
 		}
-		delete(hc.checks, collectionID)
 	}
 }
 
-// IsHealthy checks if a collection is healthy
+// recordResult applies a probe result to the check state and reports state changes.
+// The first result decides an unknown state; after that the state flips only after
+// Rise consecutive successes or Fall consecutive failures. It returns the resulting
+// state, and false if the check was stopped or replaced while the probe ran.
+func (hc *HealthChecker) recordResult(check *HealthCheck, result Result) (string, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if hc.checks[check.CollectionID] != check {
+		return "", false
+	}
+	if result.Success {
+		check.successes++
+		check.failures = 0
+	} else {
+		check.failures++
+		check.successes = 0
+	}
+	check.LastResult = result
+	check.LastCheck = time.Now()
+
+	previous := check.State
+	switch {
+	case previous == StateUnknown && result.Success:
+		check.State = StateHealthy
+	case previous == StateUnknown:
+		check.State = StateUnhealthy
+	case previous == StateUnhealthy && check.successes >= check.Rise:
+		check.State = StateHealthy
+	case previous == StateHealthy && check.failures >= check.Fall:
+		check.State = StateUnhealthy
+	}
+
+	if check.State == StateUnhealthy && previous != StateUnhealthy {
+		hc.notifyTransition(check.CollectionID, false, check.URL)
+	} else if check.State == StateHealthy && previous == StateUnhealthy {
+		hc.notifyTransition(check.CollectionID, true, check.URL)
+	}
+	return check.State, true
+}
+
+// routable reports whether traffic may be sent in a state; callers hold hc.mu
+func (hc *HealthChecker) routable(state string) bool {
+	return state == StateHealthy || (state == StateUnknown && hc.failOpen)
+}
+
+// IsHealthy checks if a collection is healthy. While the state is unknown the
+// result follows the fail-open setting.
 func (hc *HealthChecker) IsHealthy(collectionID string) bool {
 	hc.mu.RLock()
 	defer hc.mu.RUnlock()
 
 	if check, exists := hc.checks[collectionID]; exists {
-		return check.IsHealthy
+		return hc.routable(check.State)
 	}
 	return true // Default to healthy if no check configured
 }
 
+// Statuses returns the health of every collection with a configured check whose state is known
+func (hc *HealthChecker) Statuses() map[string]bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	statuses := make(map[string]bool, len(hc.checks))
+	for id, check := range hc.checks {
+		if check.State != StateUnknown {
+			statuses[id] = check.State == StateHealthy
+		}
+	}
+	return statuses
+}
+
+// Status returns a snapshot of a collection's health check
+func (hc *HealthChecker) Status(collectionID string) (Status, bool) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	check, exists := hc.checks[collectionID]
+	if !exists {
+		return Status{}, false
+	}
+	return hc.snapshot(check), true
+}
+
+// snapshot copies the state of a check; callers hold hc.mu
+func (hc *HealthChecker) snapshot(check *HealthCheck) Status {
+	return Status{
+		CollectionID:         check.CollectionID,
+		Type:                 check.probe.Type(),
+		URL:                  check.URL,
+		Interval:             int(check.Interval / time.Second),
+		State:                check.State,
+		Healthy:              hc.routable(check.State),
+		LastCheck:            check.LastCheck,
+		LastResult:           check.LastResult,
+		LastLatency:          check.LastResult.Latency.Milliseconds(),
+		ConsecutiveSuccesses: check.successes,
+		ConsecutiveFailures:  check.failures,
+		Rise:                 check.Rise,
+		Fall:                 check.Fall,
+	}
+}
+
+// CheckNow probes a collection immediately and returns the resulting status
+func (hc *HealthChecker) CheckNow(collectionID string) (Status, bool) {
+	hc.mu.RLock()
+	check, exists := hc.checks[collectionID]
+	hc.mu.RUnlock()
+	if !exists {
+		return Status{}, false
+	}
+
+	hc.performCheck(check)
+	return hc.Status(collectionID)
+}
+
 // runHealthCheck runs the health check loop
 func (hc *HealthChecker) runHealthCheck(check *HealthCheck) {
+	defer hc.wg.Done()
 	ticker := time.NewTicker(check.Interval)
 	defer ticker.Stop()
 
 	// Initial check
-	check.IsHealthy = hc.performCheck(check.URL)
-	check.LastCheck = time.Now()
+	hc.performCheck(check)
 
 	for {
 		select {
 		case <-ticker.C:
-			check.IsHealthy = hc.performCheck(check.URL)
-			check.LastCheck = time.Now()
+			hc.performCheck(check)
 		case <-check.stopChan:
 			return
 		}
 	}
 }
 
-// performCheck performs a single health check
-func (hc *HealthChecker) performCheck(url string) bool {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
+// performCheck runs the probe once and records the result
+func (hc *HealthChecker) performCheck(check *HealthCheck) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-check.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	resp, err := client.Get(url)
-	if err != nil {
-		return false
+	result := check.probe.Run(ctx)
+	state, ok := hc.recordResult(check, result)
+	if !ok {
+		return
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode >= 200 && resp.StatusCode < 300
+	entry := database.HealthCheckResult{
+		CollectionID: check.CollectionID,
+		Success:      result.Success,
+		Healthy:      state == StateHealthy,
+		StatusCode:   result.StatusCode,
+		Latency:      result.Latency.Milliseconds(),
+		Error:        result.Error,
+		CheckedAt:    time.Now(),
+	}
+	if err := hc.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record health check result for collection %s: %v", check.CollectionID, err)
+	}
 }
-
@@ -0,0 +1,375 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// testDB opens a fresh SQLite database for check history
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "health.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newTestChecker(t *testing.T, db *gorm.DB, cfg config.HealthConfig) *HealthChecker {
+	t.Helper()
+	hc := NewHealthChecker(db, cfg)
+	t.Cleanup(hc.Stop)
+	return hc
+}
+
+// toggleServer answers 200 while up and 503 otherwise
+type toggleServer struct {
+	*httptest.Server
+	up atomic.Bool
+}
+
+func newToggleServer(t *testing.T, up bool) *toggleServer {
+	t.Helper()
+	s := &toggleServer{}
+	s.up.Store(up)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.up.Load() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// blockingServer holds every probe until release is closed or the probe is cancelled
+func blockingServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		s.Close()
+	})
+	return s, release
+}
+
+func testCollection(id, baseURL string) *database.Collection {
+	return &database.Collection{
+		ID:             id,
+		BaseURL:        baseURL,
+		HealthPath:     "/health",
+		HealthInterval: 3600, // Probes after the first one are driven by CheckNow
+		HealthRise:     1,
+		HealthFall:     1,
+	}
+}
+
+// waitForState polls until the check of a collection reaches state
+func waitForState(t *testing.T, hc *HealthChecker, id, state string) Status {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, ok := hc.Status(id)
+		if ok && status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("collection %s: state %q, want %q", id, status.State, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUnknownStateFollowsFailOpen(t *testing.T) {
+	for _, failOpen := range []bool{true, false} {
+		hc := newTestChecker(t, testDB(t), config.HealthConfig{FailOpen: failOpen})
+		server, release := blockingServer(t)
+		hc.StartHealthCheck(testCollection("c1", server.URL))
+
+		status, ok := hc.Status("c1")
+		if !ok || status.State != StateUnknown {
+			t.Fatalf("fail_open=%v: state before first probe = %q, want unknown", failOpen, status.State)
+		}
+		if got := hc.IsHealthy("c1"); got != failOpen {
+			t.Errorf("fail_open=%v: IsHealthy while unknown = %v", failOpen, got)
+		}
+		if _, ok := hc.Statuses()["c1"]; ok {
+			t.Errorf("fail_open=%v: unknown state reported in Statuses", failOpen)
+		}
+
+		close(release)
+		waitForState(t, hc, "c1", StateHealthy)
+		if !hc.IsHealthy("c1") {
+			t.Errorf("fail_open=%v: IsHealthy after successful probe = false", failOpen)
+		}
+	}
+}
+
+func TestFirstFailedProbeMarksUnhealthy(t *testing.T) {
+	hc := newTestChecker(t, testDB(t), config.HealthConfig{FailOpen: true})
+	server := newToggleServer(t, false)
+	coll := testCollection("c1", server.URL)
+	coll.HealthFall = 3
+	hc.StartHealthCheck(coll)
+
+	waitForState(t, hc, "c1", StateUnhealthy)
+	if hc.IsHealthy("c1") {
+		t.Error("IsHealthy = true for an unhealthy collection")
+	}
+}
+
+func TestRiseAndFallThresholds(t *testing.T) {
+	hc := newTestChecker(t, testDB(t), config.HealthConfig{})
+	server := newToggleServer(t, true)
+	coll := testCollection("c1", server.URL)
+	coll.HealthRise = 2
+	coll.HealthFall = 3
+	hc.StartHealthCheck(coll)
+	waitForState(t, hc, "c1", StateHealthy)
+
+	server.up.Store(false)
+	for i, want := range []string{StateHealthy, StateHealthy, StateUnhealthy} {
+		status, _ := hc.CheckNow("c1")
+		if status.State != want {
+			t.Fatalf("failure %d: state %q, want %q", i+1, status.State, want)
+		}
+	}
+
+	server.up.Store(true)
+	for i, want := range []string{StateUnhealthy, StateHealthy} {
+		status, _ := hc.CheckNow("c1")
+		if status.State != want {
+			t.Fatalf("success %d: state %q, want %q", i+1, status.State, want)
+		}
+	}
+}
+
+func TestTransitionsAreReported(t *testing.T) {
+	hc := newTestChecker(t, testDB(t), config.HealthConfig{})
+	transitions := make(chan bool, 10)
+	hc.OnTransition(func(id string, healthy bool, url string) {
+		transitions <- healthy
+	})
+	server := newToggleServer(t, true)
+	hc.StartHealthCheck(testCollection("c1", server.URL))
+	waitForState(t, hc, "c1", StateHealthy)
+
+	server.up.Store(false)
+	hc.CheckNow("c1")
+	server.up.Store(true)
+	hc.CheckNow("c1")
+	server.up.Store(false)
+	hc.CheckNow("c1")
+	hc.StopHealthCheck("c1")
+
+	// Unknown to healthy is not a transition; stopping an unhealthy check reports a recovery
+	for i, want := range []bool{false, true, false, true} {
+		select {
+		case got := <-transitions:
+			if got != want {
+				t.Fatalf("transition %d: healthy=%v, want %v", i+1, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("transition %d not reported", i+1)
+		}
+	}
+	select {
+	case got := <-transitions:
+		t.Fatalf("unexpected transition healthy=%v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHistoryIsRecorded(t *testing.T) {
+	db := testDB(t)
+	hc := newTestChecker(t, db, config.HealthConfig{})
+	server := newToggleServer(t, true)
+	hc.StartHealthCheck(testCollection("c1", server.URL))
+	waitForState(t, hc, "c1", StateHealthy)
+	server.up.Store(false)
+	hc.CheckNow("c1")
+
+	var results []database.HealthCheckResult
+	db.Where("collection_id = ?", "c1").Order("id ASC").Find(&results)
+	if len(results) != 2 {
+		t.Fatalf("recorded %d results, want 2", len(results))
+	}
+	if !results[0].Success || !results[0].Healthy || results[0].StatusCode != http.StatusOK {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if results[1].Success || results[1].Healthy || results[1].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second result = %+v", results[1])
+	}
+}
+
+func TestStateIsRestoredFromHistory(t *testing.T) {
+	db := testDB(t)
+	cfg := config.HealthConfig{FailOpen: true, RestoreMaxAge: time.Minute}
+
+	down := newToggleServer(t, false)
+	first := NewHealthChecker(db, cfg)
+	first.StartHealthCheck(testCollection("c1", down.URL))
+	waitForState(t, first, "c1", StateUnhealthy)
+	first.Stop()
+
+	// After a restart the recorded state applies until the first probe completes
+	server, release := blockingServer(t)
+	second := newTestChecker(t, db, cfg)
+	transitions := make(chan bool, 1)
+	second.OnTransition(func(id string, healthy bool, url string) {
+		transitions <- healthy
+	})
+	second.StartHealthCheck(testCollection("c1", server.URL))
+	if status, _ := second.Status("c1"); status.State != StateUnhealthy {
+		t.Fatalf("restored state %q, want unhealthy", status.State)
+	}
+	if second.IsHealthy("c1") {
+		t.Error("restored unhealthy collection is routable")
+	}
+	select {
+	case healthy := <-transitions:
+		if healthy {
+			t.Error("restored state reported as healthy")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("restored unhealthy state not reported")
+	}
+
+	close(release)
+	waitForState(t, second, "c1", StateHealthy)
+
+	// Results older than restore_max_age are ignored
+	third := newTestChecker(t, db, config.HealthConfig{RestoreMaxAge: time.Nanosecond})
+	blocked, _ := blockingServer(t)
+	third.StartHealthCheck(testCollection("c1", blocked.URL))
+	if status, _ := third.Status("c1"); status.State != StateUnknown {
+		t.Errorf("state from stale history %q, want unknown", status.State)
+	}
+}
+
+func TestRestartKeepsState(t *testing.T) {
+	hc := newTestChecker(t, testDB(t), config.HealthConfig{})
+	server := newToggleServer(t, false)
+	transitions := make(chan bool, 10)
+	hc.OnTransition(func(id string, healthy bool, url string) {
+		transitions <- healthy
+	})
+	coll := testCollection("c1", server.URL)
+	hc.StartHealthCheck(coll)
+	waitForState(t, hc, "c1", StateUnhealthy)
+	<-transitions
+
+	blocked, _ := blockingServer(t)
+	coll.BaseURL = blocked.URL
+	hc.StartHealthCheck(coll)
+	if status, _ := hc.Status("c1"); status.State != StateUnhealthy {
+		t.Fatalf("state after restart %q, want unhealthy", status.State)
+	}
+	select {
+	case got := <-transitions:
+		t.Fatalf("restart reported transition healthy=%v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStopWaitsForChecks(t *testing.T) {
+	hc := NewHealthChecker(testDB(t), config.HealthConfig{HistoryRetentionDays: 1})
+	hc.Start()
+	server, _ := blockingServer(t)
+	hc.StartHealthCheck(testCollection("c1", server.URL))
+	hc.StartHealthCheck(testCollection("c2", server.URL))
+
+	done := make(chan struct{})
+	go func() {
+		hc.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not cancel in-flight probes")
+	}
+
+	hc.StartHealthCheck(testCollection("c3", server.URL))
+	if _, ok := hc.Status("c3"); ok {
+		t.Error("check started after Stop")
+	}
+}
+
+// TestConcurrentAccess exercises every method concurrently; run with -race
+func TestConcurrentAccess(t *testing.T) {
+	hc := newTestChecker(t, testDB(t), config.HealthConfig{FailOpen: true, RestoreMaxAge: time.Minute})
+	hc.OnTransition(func(string, bool, string) {})
+	server := newToggleServer(t, true)
+	ids := []string{"c1", "c2", "c3"}
+	for _, id := range ids {
+		hc.StartHealthCheck(testCollection(id, server.URL))
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					fn(i)
+				}
+			}
+		}()
+	}
+
+	run(func(i int) { server.up.Store(i%2 == 0); time.Sleep(time.Millisecond) })
+	for _, id := range ids {
+		id := id
+		run(func(int) { hc.IsHealthy(id) })
+		run(func(int) { hc.Status(id) })
+		run(func(int) { hc.CheckNow(id) })
+	}
+	run(func(int) { hc.Statuses() })
+	run(func(i int) {
+		coll := testCollection(ids[i%len(ids)], server.URL)
+		if i%5 == 0 {
+			hc.StopHealthCheck(coll.ID)
+		} else {
+			hc.StartHealthCheck(coll)
+		}
+		time.Sleep(time.Millisecond)
+	})
+
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
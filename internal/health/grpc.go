@@ -0,0 +1,190 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/midgard/gateway/internal/database"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcHealthPath is the method of the gRPC health checking protocol (grpc.health.v1)
+const grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+// Serving states of grpc.health.v1.HealthCheckResponse
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// GRPCProbe calls grpc.health.v1.Health/Check and succeeds when the service is SERVING.
+// Plaintext backends are reached over HTTP/2 with prior knowledge (h2c).
+type GRPCProbe struct {
+	Address string
+	Service string // Empty checks the server as a whole
+	TLS     bool
+	Timeout time.Duration
+	client  *http.Client
+}
+
+func newGRPCProbe(coll *database.Collection, timeout time.Duration) (*GRPCProbe, error) {
+	addr, secure, err := probeAddress(coll)
+	if err != nil {
+		return nil, err
+	}
+	p := &GRPCProbe{
+		Address: addr,
+		Service: coll.HealthGRPCService,
+		TLS:     secure,
+		Timeout: timeout,
+	}
+
+	transport := &http2.Transport{}
+	if !secure {
+		dialer := &net.Dialer{Timeout: timeout}
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	p.client = &http.Client{Transport: transport, Timeout: timeout}
+	return p, nil
+}
+
+// Type returns the probe type
+func (p *GRPCProbe) Type() string { return TypeGRPC }
+
+// Target returns the probed address and service
+func (p *GRPCProbe) Target() string {
+	scheme := "grpc"
+	if p.TLS {
+		scheme = "grpcs"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, p.Address, p.Service)
+}
+
+// Run performs one health check call
+func (p *GRPCProbe) Run(ctx context.Context) Result {
+	start := time.Now()
+
+	// HealthCheckRequest{service = 1} in a length-prefixed, uncompressed gRPC message
+	var msg []byte
+	if p.Service != "" {
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendString(msg, p.Service)
+	}
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	scheme := "http"
+	if p.TLS {
+		scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+p.Address+grpcHealthPath, bytes.NewReader(body))
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Result{Latency: time.Since(start), Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	result := Result{StatusCode: resp.StatusCode}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = "reading response: " + err.Error()
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("unexpected HTTP status %d", resp.StatusCode)
+		return result
+	}
+
+	// Trailers-only responses carry the status in the headers
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if status == "" {
+			result.Error = "response has no grpc-status"
+			return result
+		}
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+		result.Error = fmt.Sprintf("grpc-status %s: %s", status, message)
+		return result
+	}
+
+	serving, err := parseHealthResponse(respBody)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if serving != 1 {
+		name, ok := grpcServingStatus[serving]
+		if !ok {
+			name = fmt.Sprint(serving)
+		}
+		result.Error = "service status is " + name
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// parseHealthResponse extracts the status of a length-prefixed HealthCheckResponse
+func parseHealthResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, fmt.Errorf("empty gRPC response")
+	}
+	if body[0] != 0 {
+		return 0, fmt.Errorf("compressed gRPC responses are not supported")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(size) {
+		return 0, fmt.Errorf("truncated gRPC response")
+	}
+	msg := body[5 : 5+size]
+
+	var status uint64 // Absent field means UNKNOWN
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return 0, fmt.Errorf("invalid HealthCheckResponse: %v", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(msg)
+			if n < 0 {
+				return 0, fmt.Errorf("invalid HealthCheckResponse: %v", protowire.ParseError(n))
+			}
+			status, msg = v, msg[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, msg)
+		if n < 0 {
+			return 0, fmt.Errorf("invalid HealthCheckResponse: %v", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+	}
+	return status, nil
+}
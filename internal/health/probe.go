@@ -0,0 +1,332 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/jsonpath"
+)
+
+// maxProbeBody limits how much of a probe response is read for body assertions
+const maxProbeBody = 1 << 20
+
+// Probe types
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeGRPC = "grpc"
+)
+
+// Prober checks one backend. All probe types share thresholds, history and status reporting.
+type Prober interface {
+	Type() string
+	Target() string // Display form of what is probed, e.g. http://host/health or tcp://host:port
+	Run(ctx context.Context) Result
+}
+
+// Result is the outcome of one probe
+type Result struct {
+	Success    bool          `json:"success"`
+	StatusCode int           `json:"status_code"` // HTTP status, or 0 for TCP
+	Latency    time.Duration `json:"-"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Enabled reports whether a collection has a health check configured. HTTP checks
+// need a health path; TCP and gRPC checks only need the type.
+func Enabled(coll *database.Collection) bool {
+	switch strings.ToLower(coll.HealthType) {
+	case TypeTCP, TypeGRPC:
+		return true
+	default:
+		return coll.HealthPath != ""
+	}
+}
+
+// NewProbe builds the probe configured on a collection
+func NewProbe(coll *database.Collection) (Prober, error) {
+	timeout := time.Duration(coll.HealthTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	switch strings.ToLower(coll.HealthType) {
+	case "", TypeHTTP:
+		return newHTTPProbe(coll, timeout)
+	case TypeTCP:
+		addr, _, err := probeAddress(coll)
+		if err != nil {
+			return nil, err
+		}
+		return &TCPProbe{Address: addr, Timeout: timeout}, nil
+	case TypeGRPC:
+		return newGRPCProbe(coll, timeout)
+	default:
+		return nil, fmt.Errorf("health_type must be %q, %q or %q", TypeHTTP, TypeTCP, TypeGRPC)
+	}
+}
+
+// probeAddress returns the host:port probed by TCP and gRPC checks, taken from
+// HealthTarget when set and from BaseURL otherwise, and whether TLS is used
+func probeAddress(coll *database.Collection) (string, bool, error) {
+	target := coll.HealthTarget
+	if target == "" {
+		target = coll.BaseURL
+	}
+	if !strings.Contains(target, "://") {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return "", false, fmt.Errorf("invalid health_target %q: use host:port or a URL", target)
+		}
+		return target, false, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return "", false, fmt.Errorf("invalid health target %q", target)
+	}
+	secure := u.Scheme == "https" || u.Scheme == "grpcs"
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if secure {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), secure, nil
+}
+
+// TCPProbe succeeds when a TCP connection can be established
+type TCPProbe struct {
+	Address string
+	Timeout time.Duration
+}
+
+// Type returns the probe type
+func (p *TCPProbe) Type() string { return TypeTCP }
+
+// Target returns the probed address
+func (p *TCPProbe) Target() string { return "tcp://" + p.Address }
+
+// Run connects and immediately closes the connection
+func (p *TCPProbe) Run(ctx context.Context) Result {
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: p.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	result := Result{Latency: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Success = true
+	return result
+}
+
+// HTTPProbe requests a URL and asserts on the status and body
+type HTTPProbe struct {
+	Method       string
+	URL          string
+	Headers      map[string]string
+	Expected     []StatusRange
+	BodyContains string
+	JSONPath     jsonpath.Path
+	JSONValue    string
+	Timeout      time.Duration
+	client       *http.Client
+}
+
+// StatusRange is an inclusive range of accepted status codes
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// newHTTPProbe builds an HTTP probe. HealthTarget replaces the scheme, host and port
+// of BaseURL, e.g. to reach a separate management port.
+func newHTTPProbe(coll *database.Collection, timeout time.Duration) (*HTTPProbe, error) {
+	base := coll.BaseURL
+	if coll.HealthTarget != "" {
+		base = coll.HealthTarget
+		if !strings.Contains(base, "://") {
+			scheme := "http"
+			if u, err := url.Parse(coll.BaseURL); err == nil && u.Scheme != "" {
+				scheme = u.Scheme
+			}
+			base = scheme + "://" + base
+		}
+		if u, err := url.Parse(base); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid health_target %q: use host:port or a URL", coll.HealthTarget)
+		}
+	}
+
+	p := &HTTPProbe{
+		Method:       strings.ToUpper(coll.HealthMethod),
+		URL:          strings.TrimSuffix(base, "/") + coll.HealthPath,
+		BodyContains: coll.HealthBodyContains,
+		JSONValue:    coll.HealthJSONValue,
+		Timeout:      timeout,
+	}
+	if p.Method == "" {
+		p.Method = http.MethodGet
+	}
+
+	if coll.HealthHeaders != "" {
+		if err := json.Unmarshal([]byte(coll.HealthHeaders), &p.Headers); err != nil {
+			return nil, fmt.Errorf("health_headers must be a JSON object of strings: %v", err)
+		}
+	}
+
+	var err error
+	if p.Expected, err = ParseStatusRanges(coll.HealthExpectedStatus); err != nil {
+		return nil, err
+	}
+	if coll.HealthJSONPath != "" {
+		p.JSONPath, err = jsonpath.Parse(coll.HealthJSONPath)
+		if err == nil && p.JSONPath.HasWildcard() {
+			err = fmt.Errorf("wildcards are not supported")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid health_json_path %q: %v; use e.g. $.status or $.checks[0].state", coll.HealthJSONPath, err)
+		}
+	}
+
+	p.client = &http.Client{Timeout: p.Timeout}
+	return p, nil
+}
+
+// Type returns the probe type
+func (p *HTTPProbe) Type() string { return TypeHTTP }
+
+// Target returns the probed URL
+func (p *HTTPProbe) Target() string { return p.URL }
+
+// ParseStatusRanges parses a list such as "200-299,301". An empty list accepts 2xx.
+func ParseStatusRanges(spec string) ([]StatusRange, error) {
+	if strings.TrimSpace(spec) == "" {
+		return []StatusRange{{Min: 200, Max: 299}}, nil
+	}
+	var ranges []StatusRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		min, err1 := strconv.Atoi(lo)
+		max, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("invalid expected status %q: use codes or ranges such as 200-299,301", part)
+		}
+		ranges = append(ranges, StatusRange{Min: min, Max: max})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("invalid expected status %q", spec)
+	}
+	return ranges, nil
+}
+
+// Run performs the probe once
+func (p *HTTPProbe) Run(ctx context.Context) Result {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, p.Method, p.URL, nil)
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	for k, v := range p.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Result{Latency: time.Since(start), Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	result := Result{StatusCode: resp.StatusCode}
+	var body []byte
+	if p.BodyContains != "" || p.JSONPath != nil {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	} else {
+		_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBody))
+	}
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = "reading body: " + err.Error()
+		return result
+	}
+
+	if !p.statusExpected(resp.StatusCode) {
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return result
+	}
+	if p.BodyContains != "" && !bytes.Contains(body, []byte(p.BodyContains)) {
+		result.Error = fmt.Sprintf("body does not contain %q", p.BodyContains)
+		return result
+	}
+	if p.JSONPath != nil {
+		if err := p.checkJSON(body); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	result.Success = true
+	return result
+}
+
+func (p *HTTPProbe) statusExpected(code int) bool {
+	for _, r := range p.Expected {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// checkJSON asserts that the JSON path exists and, when JSONValue is set, equals it.
+// Without an expected value the path must not be null or false.
+func (p *HTTPProbe) checkJSON(body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("body is not JSON: %v", err)
+	}
+	value, ok := p.JSONPath.Lookup(doc)
+	if !ok {
+		return fmt.Errorf("JSON path not found in body")
+	}
+	if p.JSONValue == "" {
+		if value == nil || value == false {
+			return fmt.Errorf("JSON value is %v", value)
+		}
+		return nil
+	}
+	if actual := jsonString(value); actual != p.JSONValue {
+		return fmt.Errorf("JSON value is %q, expected %q", actual, p.JSONValue)
+	}
+	return nil
+}
+
+// jsonString renders a decoded JSON value for comparison: strings as-is, everything else as JSON
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,158 @@
+// Package jsonpath implements the small JSON path subset used in configuration:
+// $.card.number, $.items[0].id, $["account-id"] and the wildcards $.*.secret and $.items[*].token
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment is one step of a path: an object key, an array index or a wildcard
+// matching every key or element
+type Segment struct {
+	Key      string
+	Index    int
+	IsIndex  bool
+	Wildcard bool
+}
+
+// Path is a parsed JSON path
+type Path []Segment
+
+// Parse parses a path. Keys containing dots or brackets are written quoted in
+// brackets, e.g. $['api-key'] or $.headers["x.auth"].
+func Parse(path string) (Path, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "$") {
+		return nil, errors.New("must start with $")
+	}
+	p = p[1:]
+
+	var segments Path
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			key := p[:end]
+			if key == "" {
+				return nil, errors.New("empty key")
+			}
+			segments = append(segments, Segment{Key: key, Wildcard: key == "*"})
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end == -1 {
+				return nil, errors.New("unclosed bracket")
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+			switch {
+			case inner == "*":
+				segments = append(segments, Segment{Wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, Segment{Key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index %q: use a number, * or a quoted key", inner)
+				}
+				segments = append(segments, Segment{Index: idx, IsIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q", p[0])
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.New("no segments")
+	}
+	return segments, nil
+}
+
+// HasWildcard reports whether the path can address more than one value
+func (p Path) HasWildcard() bool {
+	for _, seg := range p {
+		if seg.Wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the value addressed by the path in a document decoded into
+// interface{}. Wildcard segments match nothing; paths that address a single value
+// should be checked with HasWildcard when they are parsed.
+func (p Path) Lookup(doc interface{}) (interface{}, bool) {
+	current := doc
+	for _, seg := range p {
+		switch v := current.(type) {
+		case []interface{}:
+			if !seg.IsIndex || seg.Index >= len(v) {
+				return nil, false
+			}
+			current = v[seg.Index]
+		case map[string]interface{}:
+			if seg.IsIndex || seg.Wildcard {
+				return nil, false
+			}
+			var ok bool
+			if current, ok = v[seg.Key]; !ok {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Replace sets every value addressed by the path in a decoded document to value and
+// reports whether anything was replaced
+func (p Path) Replace(doc interface{}, value interface{}) bool {
+	if len(p) == 0 {
+		return false
+	}
+	seg := p[0]
+	last := len(p) == 1
+	replaced := false
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if seg.IsIndex {
+			return false
+		}
+		for k, child := range v {
+			if !seg.Wildcard && k != seg.Key {
+				continue
+			}
+			if last {
+				v[k] = value
+				replaced = true
+			} else if p[1:].Replace(child, value) {
+				replaced = true
+			}
+		}
+	case []interface{}:
+		if !seg.IsIndex && !seg.Wildcard {
+			return false
+		}
+		for i, child := range v {
+			if !seg.Wildcard && i != seg.Index {
+				continue
+			}
+			if last {
+				v[i] = value
+				replaced = true
+			} else if p[1:].Replace(child, value) {
+				replaced = true
+			}
+		}
+	}
+	return replaced
+}
@@ -0,0 +1,85 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path string
+		want Path
+	}{
+		{"$.card.number", Path{{Key: "card"}, {Key: "number"}}},
+		{" $.items[0].id ", Path{{Key: "items"}, {Index: 0, IsIndex: true}, {Key: "id"}}},
+		{`$['api-key']`, Path{{Key: "api-key"}}},
+		{`$.headers["x.auth"]`, Path{{Key: "headers"}, {Key: "x.auth"}}},
+		{`$["0"]`, Path{{Key: "0"}}},
+		{"$[*].pin", Path{{Wildcard: true}, {Key: "pin"}}},
+		{"$.*.secret", Path{{Key: "*", Wildcard: true}, {Key: "secret"}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.path)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"", "password", "$", "$.", "$.a..b", "$.items[0", "$items", "$.items[-1]", "$.items[id]"} {
+		if _, err := Parse(path); err == nil {
+			t.Errorf("Parse(%q) accepted", path)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"items":[{"id":7}],"a.b":true,"n":null}`), &doc)
+	tests := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{"$.items[0].id", float64(7), true},
+		{`$["a.b"]`, true, true},
+		{"$.n", nil, true},
+		{"$.items[1]", nil, false},
+		{"$.items.id", nil, false},
+		{"$.items[0][0]", nil, false},
+		{"$.items[*].id", nil, false},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, found := p.Lookup(doc)
+		if found != tt.found || got != tt.want {
+			t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.path, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"items":[{"token":"a"},{"token":"b"}],"card":{"0":"x"}}`), &doc)
+
+	p, _ := Parse("$.items[*].token")
+	if !p.Replace(doc, "X") {
+		t.Fatal("nothing replaced")
+	}
+	// An index does not address object keys
+	p, _ = Parse("$.card[0]")
+	if p.Replace(doc, "X") {
+		t.Fatal("index replaced an object key")
+	}
+	out, _ := json.Marshal(doc)
+	if string(out) != `{"card":{"0":"x"},"items":[{"token":"X"},{"token":"X"}]}` {
+		t.Fatalf("document %s", out)
+	}
+}
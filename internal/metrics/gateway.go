@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// UnmatchedEndpoint is the endpoint label for requests that match no imported endpoint
+const UnmatchedEndpoint = "unmatched"
+
+// DefaultBuckets are latency histogram buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Gateway holds the metrics recorded for proxied traffic
+type Gateway struct {
+	Registry *prometheus.Registry
+
+	Requests        *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	InFlight        *prometheus.GaugeVec
+	WebSockets      *prometheus.GaugeVec
+	CacheLookups    *prometheus.CounterVec
+	LogWrites       prometheus.Gauge
+
+	cacheResults sync.Map // Cache lookup counts per collection (*cacheResults), for the hit ratio
+}
+
+// cacheResults counts the cache lookups of one collection
+type cacheResults struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewGateway creates the gateway metrics in a new registry, together with the Go
+// runtime and process metrics
+func NewGateway() *Gateway {
+	g := &Gateway{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "midgard_requests_total",
+			Help: "Total proxied requests.",
+		}, []string{"collection", "endpoint", "method", "status_class"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "midgard_request_duration_seconds",
+			Help:    "Proxied request latency in seconds.",
+			Buckets: DefaultBuckets,
+		}, []string{"collection", "endpoint", "method", "status_class"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "midgard_requests_in_flight",
+			Help: "Proxied requests currently being served.",
+		}, []string{"collection"}),
+		WebSockets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "midgard_websocket_connections",
+			Help: "WebSocket connections currently open.",
+		}, []string{"collection"}),
+		CacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "midgard_cache_lookups_total",
+			Help: "Response cache lookups by result.",
+		}, []string{"collection", "result"}),
+		LogWrites: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "midgard_log_writes_pending",
+			Help: "Request logs being written, including those waiting for a database connection.",
+		}),
+	}
+	g.Registry.MustRegister(
+		g.Requests, g.RequestDuration, g.InFlight, g.WebSockets, g.CacheLookups, g.LogWrites,
+		&hitRatioCollector{gateway: g},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return g
+}
+
+// Handler returns an HTTP handler serving the metrics in the Prometheus exposition format
+func (g *Gateway) Handler() http.Handler {
+	return promhttp.HandlerFor(g.Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exports the connection pool statistics of the database, such as open
+// connections and the cumulative wait count and duration
+func (g *Gateway) RegisterDB(db *sql.DB) {
+	g.Registry.MustRegister(collectors.NewDBStatsCollector(db, "midgard"))
+}
+
+// RegisterCollectionHealth exports the health state of collections, read from states
+// on every scrape. states maps collection prefixes to whether they are healthy and
+// leaves out collections whose state is unknown.
+func (g *Gateway) RegisterCollectionHealth(states func() map[string]bool) {
+	g.Registry.MustRegister(&healthCollector{states: states})
+}
+
+// ObserveRequest records a completed proxied request
+func (g *Gateway) ObserveRequest(collection, endpoint, method string, status int, seconds float64) {
+	if g == nil {
+		return
+	}
+	labels := prometheus.Labels{
+		"collection":   collection,
+		"endpoint":     endpoint,
+		"method":       normalizeMethod(method),
+		"status_class": StatusClass(status),
+	}
+	g.Requests.With(labels).Inc()
+	g.RequestDuration.With(labels).Observe(seconds)
+}
+
+// ObserveCache records a cache lookup result
+func (g *Gateway) ObserveCache(collection string, hit bool) {
+	if g == nil {
+		return
+	}
+	v, _ := g.cacheResults.LoadOrStore(collection, &cacheResults{})
+	results := v.(*cacheResults)
+	if hit {
+		results.hits.Add(1)
+		g.CacheLookups.WithLabelValues(collection, "hit").Inc()
+	} else {
+		results.misses.Add(1)
+		g.CacheLookups.WithLabelValues(collection, "miss").Inc()
+	}
+}
+
+// CacheResults returns the cache hits and misses of a collection since start
+func (g *Gateway) CacheResults(collection string) (hits, misses int64) {
+	if g == nil {
+		return 0, 0
+	}
+	if v, ok := g.cacheResults.Load(collection); ok {
+		results := v.(*cacheResults)
+		return results.hits.Load(), results.misses.Load()
+	}
+	return 0, 0
+}
+
+// TrackInFlight increments the in-flight gauge and returns a function that decrements it
+func (g *Gateway) TrackInFlight(collection string) func() {
+	if g == nil {
+		return func() {}
+	}
+	gauge := g.InFlight.WithLabelValues(collection)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// TrackWebSocket increments the open WebSocket connections gauge and returns a function that decrements it
+func (g *Gateway) TrackWebSocket(collection string) func() {
+	if g == nil {
+		return func() {}
+	}
+	gauge := g.WebSockets.WithLabelValues(collection)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// TrackLogWrite increments the pending log writes gauge and returns a function that decrements it
+func (g *Gateway) TrackLogWrite() func() {
+	if g == nil {
+		return func() {}
+	}
+	g.LogWrites.Inc()
+	return g.LogWrites.Dec
+}
+
+// hitRatioCollector derives the cache hit ratio of each collection at scrape time
+type hitRatioCollector struct {
+	gateway *Gateway
+}
+
+var hitRatioDesc = prometheus.NewDesc("midgard_cache_hit_ratio",
+	"Ratio of cache hits to cache lookups since start.", []string{"collection"}, nil)
+
+func (c *hitRatioCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hitRatioDesc
+}
+
+func (c *hitRatioCollector) Collect(ch chan<- prometheus.Metric) {
+	c.gateway.cacheResults.Range(func(key, value any) bool {
+		results := value.(*cacheResults)
+		hits, misses := results.hits.Load(), results.misses.Load()
+		if hits+misses > 0 {
+			ch <- prometheus.MustNewConstMetric(hitRatioDesc, prometheus.GaugeValue,
+				float64(hits)/float64(hits+misses), key.(string))
+		}
+		return true
+	})
+}
+
+// healthCollector reports the health state of collections at scrape time
+type healthCollector struct {
+	states func() map[string]bool
+}
+
+var healthDesc = prometheus.NewDesc("midgard_collection_healthy",
+	"Health check state per collection (1 = healthy, 0 = unhealthy).", []string{"collection"}, nil)
+
+func (c *healthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- healthDesc
+}
+
+func (c *healthCollector) Collect(ch chan<- prometheus.Metric) {
+	for collection, healthy := range c.states() {
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(healthDesc, prometheus.GaugeValue, value, collection)
+	}
+}
+
+// normalizeMethod keeps arbitrary client-supplied methods from creating new series
+func normalizeMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+// StatusClass maps a status code to its class label, e.g. 404 -> "4xx"
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	_ "modernc.org/sqlite"
+)
+
+func TestObserveRequestLabels(t *testing.T) {
+	g := NewGateway()
+	g.ObserveRequest("shop", "/items/{id}", "GET", 404, 0.02)
+	g.ObserveRequest("shop", "/items/{id}", "BREW", 200, 0.02)
+
+	if v := testutil.ToFloat64(g.Requests.WithLabelValues("shop", "/items/{id}", "GET", "4xx")); v != 1 {
+		t.Fatalf("GET 4xx requests = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(g.Requests.WithLabelValues("shop", "/items/{id}", "OTHER", "2xx")); v != 1 {
+		t.Fatalf("unknown methods are not grouped: %v", v)
+	}
+	if n := testutil.CollectAndCount(g.RequestDuration); n != 2 {
+		t.Fatalf("%d latency series, want 2", n)
+	}
+}
+
+func TestCacheHitRatio(t *testing.T) {
+	g := NewGateway()
+	for _, hit := range []bool{true, true, true, false} {
+		g.ObserveCache("shop", hit)
+	}
+	if hits, misses := g.CacheResults("shop"); hits != 3 || misses != 1 {
+		t.Fatalf("cache results %d hits, %d misses", hits, misses)
+	}
+
+	expected := `
+# HELP midgard_cache_hit_ratio Ratio of cache hits to cache lookups since start.
+# TYPE midgard_cache_hit_ratio gauge
+midgard_cache_hit_ratio{collection="shop"} 0.75
+`
+	if err := testutil.GatherAndCompare(g.Registry, strings.NewReader(expected), "midgard_cache_hit_ratio"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectionHealthAndDBStats(t *testing.T) {
+	g := NewGateway()
+	g.RegisterCollectionHealth(func() map[string]bool { return map[string]bool{"shop": true, "billing": false} })
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	g.RegisterDB(db)
+
+	expected := `
+# HELP midgard_collection_healthy Health check state per collection (1 = healthy, 0 = unhealthy).
+# TYPE midgard_collection_healthy gauge
+midgard_collection_healthy{collection="billing"} 0
+midgard_collection_healthy{collection="shop"} 1
+`
+	if err := testutil.GatherAndCompare(g.Registry, strings.NewReader(expected), "midgard_collection_healthy"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cumulative pool statistics are counters
+	rec := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		"# TYPE go_sql_wait_count_total counter",
+		"# TYPE go_sql_wait_duration_seconds_total counter",
+		`go_sql_open_connections{db_name="midgard"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("exposition lacks %q", want)
+		}
+	}
+}
+
+func TestTrackGauges(t *testing.T) {
+	g := NewGateway()
+	done := g.TrackInFlight("shop")
+	doneLog := g.TrackLogWrite()
+	if testutil.ToFloat64(g.InFlight.WithLabelValues("shop")) != 1 || testutil.ToFloat64(g.LogWrites) != 1 {
+		t.Fatal("gauges not incremented")
+	}
+	done()
+	doneLog()
+	if testutil.ToFloat64(g.InFlight.WithLabelValues("shop")) != 0 || testutil.ToFloat64(g.LogWrites) != 0 {
+		t.Fatal("gauges not decremented")
+	}
+
+	// A nil gateway records nothing, as in tests that run without metrics
+	var none *Gateway
+	none.ObserveRequest("shop", UnmatchedEndpoint, "GET", 200, 1)
+	none.TrackInFlight("shop")()
+	if hits, misses := none.CacheResults("shop"); hits != 0 || misses != 0 {
+		t.Fatal("nil gateway reports cache results")
+	}
+}
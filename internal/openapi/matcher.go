@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"strings"
+
+	"github.com/midgard/gateway/internal/database"
+)
+
+// MatchEndpoint finds the endpoint whose path template matches a request path.
+// Templates use OpenAPI syntax, e.g. /users/{id}. When several templates match,
+// the one with the most literal segments wins, so /users/me beats /users/{id}.
+func MatchEndpoint(endpoints []database.Endpoint, method, path string) *database.Endpoint {
+	segments := splitPath(path)
+
+	var best *database.Endpoint
+	bestScore := -1
+	for i := range endpoints {
+		ep := &endpoints[i]
+		if !strings.EqualFold(ep.Method, method) {
+			continue
+		}
+		score, ok := matchTemplate(splitPath(ep.Path), segments)
+		if ok && score > bestScore {
+			best = ep
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// matchTemplate reports whether path segments match template segments and
+// returns the number of literal segments matched
+func matchTemplate(template, segments []string) (int, bool) {
+	if len(template) != len(segments) {
+		return 0, false
+	}
+	score := 0
+	for i, t := range template {
+		if isTemplateParam(t) {
+			if segments[i] == "" {
+				return 0, false
+			}
+			continue
+		}
+		if t != segments[i] {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// isTemplateParam reports whether a segment is a path parameter such as {id}
+func isTemplateParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,48 @@
+package openapi
+
+import (
+	"testing"
+
+	"github.com/midgard/gateway/internal/database"
+)
+
+func TestMatchEndpoint(t *testing.T) {
+	endpoints := []database.Endpoint{
+		{ID: 1, Method: "GET", Path: "/users/{id}"},
+		{ID: 2, Method: "GET", Path: "/users/me"},
+		{ID: 3, Method: "post", Path: "/users"},
+		{ID: 4, Method: "GET", Path: "/users/{id}/posts/{postId}"},
+		{ID: 5, Method: "GET", Path: "/users/{id}/posts/latest"},
+		{ID: 6, Method: "GET", Path: "/"},
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   uint // 0 for no match
+	}{
+		{"parameter", "GET", "/users/42", 1},
+		{"literal beats parameter", "GET", "/users/me", 2},
+		{"literal beats parameter in a longer path", "GET", "/users/42/posts/latest", 5},
+		{"several parameters", "GET", "/users/42/posts/7", 4},
+		{"trailing slash", "GET", "/users/me/", 2},
+		{"method is case-insensitive", "POST", "/users", 3},
+		{"lowercase request method", "get", "/users/42", 1},
+		{"method mismatch", "DELETE", "/users/42", 0},
+		{"empty parameter segment", "GET", "/users//posts/7", 0},
+		{"too many segments", "GET", "/users/42/extra", 0},
+		{"literal mismatch", "GET", "/accounts/42", 0},
+		{"root", "GET", "/", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got uint
+			if ep := MatchEndpoint(endpoints, tt.method, tt.path); ep != nil {
+				got = ep.ID
+			}
+			if got != tt.want {
+				t.Fatalf("MatchEndpoint(%s %s) = endpoint %d, want %d", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package protoset
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/midgard/gateway/internal/database"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Field numbers used to locate the comments of services and methods in SourceCodeInfo
+const (
+	fileServiceField   = 6 // FileDescriptorProto.service
+	serviceMethodField = 2 // ServiceDescriptorProto.method
+)
+
+// ParseDescriptorSet parses a serialized FileDescriptorSet, as written by
+// protoc --descriptor_set_out or buf build -o
+func ParseDescriptorSet(data []byte) (*descriptorpb.FileDescriptorSet, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set: %w", err)
+	}
+	return &set, nil
+}
+
+// ExtractEndpoints extracts one endpoint per RPC method. The endpoint path is the
+// method's HTTP/2 path, /package.Service/Method, and its method is POST.
+func ExtractEndpoints(set *descriptorpb.FileDescriptorSet) ([]database.Endpoint, error) {
+	var endpoints []database.Endpoint
+	for _, file := range set.GetFile() {
+		comments := leadingComments(file)
+		for si, service := range file.GetService() {
+			serviceName := service.GetName()
+			if pkg := file.GetPackage(); pkg != "" {
+				serviceName = pkg + "." + serviceName
+			}
+			for mi, method := range service.GetMethod() {
+				endpoint := database.Endpoint{
+					Path:    "/" + serviceName + "/" + method.GetName(),
+					Method:  "POST",
+					Summary: signature(method),
+				}
+				endpoint.Description = comments[fmt.Sprint([]int32{fileServiceField, int32(si), serviceMethodField, int32(mi)})]
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("descriptor set defines no services")
+	}
+	return endpoints, nil
+}
+
+// signature describes a method in proto syntax, e.g.
+// rpc Watch(pkg.WatchRequest) returns (stream pkg.Event)
+func signature(method *descriptorpb.MethodDescriptorProto) string {
+	typeName := func(name string, stream bool) string {
+		name = strings.TrimPrefix(name, ".")
+		if stream {
+			return "stream " + name
+		}
+		return name
+	}
+	return fmt.Sprintf("rpc %s(%s) returns (%s)", method.GetName(),
+		typeName(method.GetInputType(), method.GetClientStreaming()),
+		typeName(method.GetOutputType(), method.GetServerStreaming()))
+}
+
+// leadingComments maps the source paths of a file's elements to their leading comments.
+// Descriptor sets built without --include_source_info have none.
+func leadingComments(file *descriptorpb.FileDescriptorProto) map[string]string {
+	comments := make(map[string]string)
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		if c := strings.TrimSpace(loc.GetLeadingComments()); c != "" {
+			comments[fmt.Sprint(loc.GetPath())] = c
+		}
+	}
+	return comments
+}
+
+// ImportDescriptorSet parses a descriptor set and returns its methods as endpoints
+func ImportDescriptorSet(data []byte) ([]database.Endpoint, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("descriptor set is empty")
+	}
+	set, err := ParseDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractEndpoints(set)
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/cache"
+	"github.com/midgard/gateway/internal/collection"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/redact"
+	"gorm.io/gorm"
+)
+
+// testGateway proxies /proxy/:prefix/*path to collections stored in a fresh database,
+// caching in memory
+type testGateway struct {
+	router *gin.Engine
+	db     *gorm.DB
+	cm     *collection.CollectionManager
+	cache  *cache.Memory
+	pm     *ProxyManager
+}
+
+func newTestGateway(t *testing.T) *testGateway {
+	t.Helper()
+	return newTestGatewayWithConfig(t, config.ProxyConfig{})
+}
+
+func newTestGatewayWithConfig(t *testing.T, proxyConfig config.ProxyConfig) *testGateway {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "proxy.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	redactor, err := redact.NewRedactor(&config.RedactConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &testGateway{
+		router: gin.New(),
+		db:     db,
+		cm:     collection.NewCollectionManager(db),
+		cache:  cache.NewMemory(100, 1<<20),
+	}
+	g.pm = NewProxyManager(g.cm, nil, g.cache, config.CacheConfig{LockTimeout: 2 * time.Second, ConsumerHeaders: config.DefaultConsumerHeaders}, proxyConfig, db, redactor, nil, nil, nil)
+	g.router.Any("/proxy/:prefix/*path", g.pm.HandleProxyRequest)
+	return g
+}
+
+// addCollection registers a cached collection in front of upstream
+func (g *testGateway) addCollection(t *testing.T, prefix, upstream string, configure func(*database.Collection)) *database.Collection {
+	t.Helper()
+	coll := &database.Collection{
+		Name:          prefix,
+		Prefix:        prefix,
+		BaseURL:       upstream,
+		CacheEnabled:  true,
+		CacheTTL:      60,
+		CacheMode:     cache.ModeHTTP,
+		LogEnabled:    false,
+		LogMaxEntries: 10,
+	}
+	if configure != nil {
+		configure(coll)
+	}
+	if err := g.cm.CreateCollection(coll); err != nil {
+		t.Fatalf("create collection: %v", err)
+	}
+	return coll
+}
+
+func (g *testGateway) do(method, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	g.router.ServeHTTP(w, req)
+	return w
+}
+
+// waitForLog waits for the first request log of a collection, which is written after the response
+func (g *testGateway) waitForLog(t *testing.T, collectionID string) database.RequestLog {
+	t.Helper()
+	var entry database.RequestLog
+	deadline := time.Now().Add(2 * time.Second)
+	for g.db.Where("collection_id = ?", collectionID).First(&entry).Error != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("request was not logged")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return entry
+}
+
+// countingUpstream counts requests and answers with handler
+func countingUpstream(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestHTTPCacheReplaysStoredResponse(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("a,b\n"))
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, nil)
+
+	if w := g.do(http.MethodGet, "/proxy/svc/report"); w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request X-Cache = %q, want MISS", w.Header().Get("X-Cache"))
+	}
+	w := g.do(http.MethodGet, "/proxy/svc/report")
+	if w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "a,b\n" {
+		t.Fatalf("second request: X-Cache %q, body %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("cached Content-Type = %q, want text/csv", ct)
+	}
+	if w := g.do(http.MethodGet, "/proxy/svc/report", "If-None-Match", `"v1"`); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("conditional request: status %d, %d body bytes", w.Code, w.Body.Len())
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hit %d times, want 1", hits.Load())
+	}
+}
+
+func TestHTTPCacheRespectsDirectivesAndMethods(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}
+		w.Write([]byte(r.Method))
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, nil)
+
+	g.do(http.MethodGet, "/proxy/svc/private")
+	g.do(http.MethodGet, "/proxy/svc/private")
+	g.do(http.MethodPost, "/proxy/svc/orders")
+	g.do(http.MethodPost, "/proxy/svc/orders")
+	if hits.Load() != 4 {
+		t.Fatalf("upstream hit %d times, want 4 (private and POST responses are not cached)", hits.Load())
+	}
+}
+
+func TestCacheCoalescesConcurrentMisses(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("slow"))
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := g.do(http.MethodGet, "/proxy/svc/hot"); w.Body.String() != "slow" {
+				t.Errorf("body = %q", w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hit %d times, want 1", hits.Load())
+	}
+}
+
+func TestCacheServesStaleOnUpstreamError(t *testing.T) {
+	var failing atomic.Bool
+	upstream, _ := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+		w.Write([]byte("good"))
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, nil)
+
+	g.do(http.MethodGet, "/proxy/svc/data")
+	failing.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+
+	w := g.do(http.MethodGet, "/proxy/svc/data")
+	if w.Code != http.StatusOK || w.Body.String() != "good" || w.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("got %d %q (X-Cache %q), want the stale response", w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheRulesKeyPerConsumer(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte(r.Header.Get("X-Api-Key") + " " + r.URL.Path))
+	})
+	g := newTestGateway(t)
+	coll := g.addCollection(t, "svc", upstream.URL, nil)
+	rules := []database.CacheRule{
+		{CollectionID: coll.ID, PathPattern: "/me/**", KeyConsumer: true, KeyQueryIgnore: "utm_source"},
+		{CollectionID: coll.ID, PathPattern: "/me/live", Bypass: true, Priority: 10},
+	}
+	if err := g.db.Create(&rules).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"alice", "bob", "alice"} {
+		w := g.do(http.MethodGet, "/proxy/svc/me/profile?utm_source="+key, "X-Api-Key", key)
+		if want := key + " /me/profile"; w.Body.String() != want {
+			t.Fatalf("consumer %s got %q, want %q", key, w.Body.String(), want)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("upstream hit %d times, want 2 (one per consumer)", hits.Load())
+	}
+
+	// Private responses stay uncached for anonymous requests and bypassed paths
+	g.do(http.MethodGet, "/proxy/svc/me/profile")
+	g.do(http.MethodGet, "/proxy/svc/me/profile")
+	g.do(http.MethodGet, "/proxy/svc/me/live", "X-Api-Key", "alice")
+	g.do(http.MethodGet, "/proxy/svc/me/live", "X-Api-Key", "alice")
+	if hits.Load() != 6 {
+		t.Fatalf("upstream hit %d times, want 6", hits.Load())
+	}
+}
+
+func TestCacheSkipsResponsesOverMaxSize(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) { c.CacheMaxSize = 4 })
+
+	for i := 0; i < 2; i++ {
+		g.do(http.MethodGet, "/proxy/svc/a")
+		g.do(http.MethodGet, "/proxy/svc/large")
+	}
+	if hits.Load() != 3 {
+		t.Fatalf("upstream hit %d times, want 3 (only the small response is cached)", hits.Load())
+	}
+}
+
+func TestCacheMaxSizeZeroCachesAnySize(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 100<<10)
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	g := newTestGateway(t)
+	coll := g.addCollection(t, "svc", upstream.URL, nil)
+	// The column defaults to 1 MiB, so 0 is set after creating the collection
+	g.db.Model(coll).Update("cache_max_size", 0)
+
+	for i := 0; i < 2; i++ {
+		if w := g.do(http.MethodGet, "/proxy/svc/big"); !bytes.Equal(w.Body.Bytes(), large) {
+			t.Fatalf("got %d bytes, want %d", w.Body.Len(), len(large))
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("upstream hit %d times, want 1", hits.Load())
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/midgard/gateway/internal/cache"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/openapi"
+)
+
+// cachePlan is how the response cache handles one request
+type cachePlan struct {
+	key         string
+	ttl         time.Duration // Freshness lifetime, or the default lifetime in HTTP mode
+	perConsumer bool          // The key includes the consumer's identity
+}
+
+// planCache resolves the cache key and lifetime of a request from the collection's cache
+// settings and its first matching cache rule. path is relative to the collection prefix.
+// It returns nil when a rule bypasses the cache.
+func (pm *ProxyManager) planCache(coll *database.Collection, method, path string, r *http.Request, body []byte) *cachePlan {
+	spec := cache.KeySpec{
+		Query: coll.CacheKeyStrategy == "params" || coll.CacheKeyStrategy == "all",
+		Body:  coll.CacheKeyStrategy == "body" || coll.CacheKeyStrategy == "all",
+	}
+	ttl := time.Duration(coll.CacheTTL) * time.Second
+
+	if rule := matchCacheRule(coll, method, path); rule != nil {
+		if rule.Bypass {
+			return nil
+		}
+		if rule.TTL > 0 {
+			ttl = time.Duration(rule.TTL) * time.Second
+		}
+		spec.QueryParams = splitList(rule.KeyQuery)
+		spec.QueryIgnore = splitList(rule.KeyQueryIgnore)
+		if len(spec.QueryParams) > 0 || len(spec.QueryIgnore) > 0 {
+			spec.Query = true
+		}
+		spec.BodyFields = splitList(rule.KeyBodyFields)
+		spec.Headers = splitList(rule.KeyHeaders)
+		// Anonymous requests keep the shared key and the shared cache restrictions
+		if rule.KeyConsumer {
+			spec.Consumer = cache.ConsumerID(r, pm.cacheConfig.ConsumerHeaders)
+		}
+	}
+
+	return &cachePlan{
+		key:         spec.Key(coll.ID, method, r, body),
+		ttl:         ttl,
+		perConsumer: spec.Consumer != "",
+	}
+}
+
+// matchCacheRule returns the first cache rule of the collection, in priority order, that
+// matches the request's endpoint, path and method
+func matchCacheRule(coll *database.Collection, method, path string) *database.CacheRule {
+	if len(coll.CacheRules) == 0 {
+		return nil
+	}
+	var endpointID *uint
+	if endpoint := openapi.MatchEndpoint(coll.Endpoints, method, path); endpoint != nil {
+		endpointID = &endpoint.ID
+	}
+
+	for i := range coll.CacheRules {
+		rule := &coll.CacheRules[i]
+		if rule.EndpointID != nil && (endpointID == nil || *rule.EndpointID != *endpointID) {
+			continue
+		}
+		if rule.Methods != "" && !cache.MethodAllowed(cache.Methods(rule.Methods), method) {
+			continue
+		}
+		if rule.PathPattern != "" {
+			match, err := cache.PathMatcher(rule.PathPattern)
+			if err != nil || !match("/"+strings.TrimPrefix(path, "/")) {
+				continue
+			}
+		}
+		return rule
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
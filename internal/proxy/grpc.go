@@ -0,0 +1,320 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+)
+
+// Collection protocols
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc" // HTTP/2 to the upstream, h2c for http:// base URLs
+)
+
+// gRPC status codes the gateway produces itself
+const (
+	grpcUnimplemented = 12
+	grpcUnavailable   = 14
+)
+
+// grpcHTTPStatus maps gRPC status codes to their HTTP equivalents, as in
+// google.rpc.Code, so gRPC failures count as errors in logs, metrics and analytics
+var grpcHTTPStatus = map[int]int{
+	0:  http.StatusOK,                  // OK
+	1:  499,                            // CANCELLED (client closed request)
+	2:  http.StatusInternalServerError, // UNKNOWN
+	3:  http.StatusBadRequest,          // INVALID_ARGUMENT
+	4:  http.StatusGatewayTimeout,      // DEADLINE_EXCEEDED
+	5:  http.StatusNotFound,            // NOT_FOUND
+	6:  http.StatusConflict,            // ALREADY_EXISTS
+	7:  http.StatusForbidden,           // PERMISSION_DENIED
+	8:  http.StatusTooManyRequests,     // RESOURCE_EXHAUSTED
+	9:  http.StatusBadRequest,          // FAILED_PRECONDITION
+	10: http.StatusConflict,            // ABORTED
+	11: http.StatusBadRequest,          // OUT_OF_RANGE
+	12: http.StatusNotImplemented,      // UNIMPLEMENTED
+	13: http.StatusInternalServerError, // INTERNAL
+	14: http.StatusServiceUnavailable,  // UNAVAILABLE
+	15: http.StatusInternalServerError, // DATA_LOSS
+	16: http.StatusUnauthorized,        // UNAUTHENTICATED
+}
+
+// grpcHTTPStatusOf returns the HTTP equivalent of a gRPC status code
+func grpcHTTPStatusOf(code int) int {
+	if status, ok := grpcHTTPStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// isGRPCRequest reports whether the request is a gRPC or gRPC-Web call
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// isGRPCWebRequest reports whether the request is a gRPC-Web call
+func isGRPCWebRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web")
+}
+
+// isGRPCWebText reports whether a gRPC-Web call uses the base64 text encoding
+func isGRPCWebText(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web-text")
+}
+
+// IsGRPCMethodCall reports whether a request is a gRPC call of /package.Service/Method
+// made without a gateway prefix
+func IsGRPCMethodCall(r *http.Request) bool {
+	if r.Method != http.MethodPost || !isGRPCRequest(r) {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// HandleGRPCRequest proxies a gRPC call made without a gateway prefix to the gRPC
+// collection whose imported descriptor set declares the method
+func (pm *ProxyManager) HandleGRPCRequest(c *gin.Context) {
+	method := c.Request.URL.Path
+	coll, err := pm.collectionManager.GetCollectionByGRPCMethod(method)
+	if err != nil {
+		contentType := "application/grpc"
+		if isGRPCWebRequest(c.Request) {
+			contentType = grpcWebContentType("application/grpc", isGRPCWebText(c.Request))
+		}
+		writeGRPCError(c.Writer, contentType, grpcUnimplemented, "unknown method "+method)
+		return
+	}
+	pm.proxyRequest(c, coll.Prefix, strings.TrimPrefix(method, "/"))
+}
+
+// newGRPCTransports creates the HTTP/2 transports of gRPC collections: one with TLS and
+// one with prior knowledge over plaintext (h2c)
+func newGRPCTransports() (h2, h2c *http2.Transport) {
+	h2 = &http2.Transport{}
+	h2c = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	return h2, h2c
+}
+
+// grpcTransport returns the transport for a gRPC upstream URL scheme
+func (pm *ProxyManager) grpcTransport(scheme string) http.RoundTripper {
+	if scheme == "https" {
+		return pm.h2Transport
+	}
+	return pm.h2cTransport
+}
+
+// grpcStatus reads the status of a gRPC call from response headers, where trailers-only
+// responses carry it, or from the trailers the reverse proxy merged into them
+func grpcStatus(header http.Header) (int, string, bool) {
+	for _, prefix := range []string{"", http.TrailerPrefix} {
+		if v := header.Get(prefix + "Grpc-Status"); v != "" {
+			code, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, "", false
+			}
+			message := header.Get(prefix + "Grpc-Message")
+			if m, err := url.PathUnescape(message); err == nil {
+				message = m
+			}
+			return code, message, true
+		}
+	}
+	return 0, "", false
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a UTF-8 sequence
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	n := limit
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// writeGRPCError answers a gRPC call with a trailers-only response carrying a status
+func writeGRPCError(w http.ResponseWriter, contentType string, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes a status message as the gRPC protocol requires
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// grpcWebContentType converts a gRPC content type, such as application/grpc+proto, to
+// its gRPC-Web form
+func grpcWebContentType(contentType string, text bool) string {
+	suffix := strings.TrimPrefix(contentType, "application/grpc")
+	if text {
+		return "application/grpc-web-text" + suffix
+	}
+	return "application/grpc-web" + suffix
+}
+
+// translateGRPCWebRequest turns an outgoing gRPC-Web request into a native gRPC request.
+// Message framing is the same in both protocols; text-encoded bodies are decoded by
+// decodeGRPCWebText before they reach the proxy.
+func translateGRPCWebRequest(req *http.Request) {
+	contentType := req.Header.Get("Content-Type")
+	suffix := strings.TrimPrefix(strings.TrimPrefix(contentType, "application/grpc-web-text"), "application/grpc-web")
+	req.Header.Set("Content-Type", "application/grpc"+suffix)
+	req.Header.Del("X-Grpc-Web")
+	req.Header.Del("Content-Length")
+}
+
+// decodeGRPCWebText replaces a gRPC-Web text request body with its base64-decoded form
+func decodeGRPCWebText(req *http.Request) {
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{&base64ChunkReader{src: req.Body}, req.Body}
+	req.ContentLength = -1
+}
+
+// base64ChunkReader decodes a stream of concatenated base64 chunks, each of which may
+// be padded, one four-character quantum at a time
+type base64ChunkReader struct {
+	src     io.Reader
+	pending []byte
+	quantum [4]byte
+}
+
+func (r *base64ChunkReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if _, err := io.ReadFull(r.src, r.quantum[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("truncated base64 gRPC-Web body")
+			}
+			return 0, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(r.quantum[:]))
+		if err != nil {
+			return 0, err
+		}
+		r.pending = decoded
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// grpcWebBody converts a native gRPC response body to gRPC-Web: the messages pass
+// through and the trailers follow as a final frame flagged 0x80. In text mode every
+// chunk is sent as padded base64.
+type grpcWebBody struct {
+	resp    *http.Response
+	body    io.ReadCloser // The upstream body
+	text    bool
+	pending bytes.Buffer
+	buf     []byte
+	done    bool
+	trailer http.Header // The upstream trailers, once the body has been read
+}
+
+// translateGRPCWebResponse rewrites an upstream gRPC response for a gRPC-Web client
+func translateGRPCWebResponse(resp *http.Response, text bool) *grpcWebBody {
+	body := &grpcWebBody{resp: resp, body: resp.Body, text: text, buf: make([]byte, 32<<10)}
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "application/grpc") {
+		resp.Header.Set("Content-Type", grpcWebContentType(contentType, text))
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	// The trailers are sent in the body, not as HTTP trailers
+	resp.Trailer = nil
+	resp.Body = body
+	return body
+}
+
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	for b.pending.Len() == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		n, err := b.body.Read(b.buf)
+		if n > 0 {
+			b.write(b.buf[:n])
+		}
+		if err == io.EOF {
+			// The transport fills in the trailers when the body ends
+			b.trailer, b.resp.Trailer = b.resp.Trailer, nil
+			if len(b.trailer) > 0 {
+				b.write(trailerFrame(b.trailer))
+			}
+			b.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return b.pending.Read(p)
+}
+
+func (b *grpcWebBody) write(data []byte) {
+	if b.text {
+		enc := base64.NewEncoder(base64.StdEncoding, &b.pending)
+		enc.Write(data)
+		enc.Close()
+		return
+	}
+	b.pending.Write(data)
+}
+
+func (b *grpcWebBody) Close() error {
+	return b.body.Close()
+}
+
+// trailerFrame encodes trailers as a gRPC-Web trailer frame of lowercase
+// "name: value" lines
+func trailerFrame(trailer http.Header) []byte {
+	names := make([]string, 0, len(trailer))
+	for name := range trailer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block bytes.Buffer
+	for _, name := range names {
+		for _, v := range trailer[name] {
+			fmt.Fprintf(&block, "%s: %s\r\n", strings.ToLower(name), v)
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	return append(frame, block.Bytes()...)
+}
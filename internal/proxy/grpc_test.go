@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// grpcFrame wraps a message in gRPC length-prefixed framing
+func grpcFrame(msg string) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// readGRPCFrame reads one length-prefixed frame and returns its flags and payload
+func readGRPCFrame(r io.Reader) (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(h[1:]))
+	_, err := io.ReadFull(r, payload)
+	return h[0], payload, err
+}
+
+// startH2C starts a test server that accepts HTTP/2 with prior knowledge
+func startH2C(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// h2cClient speaks HTTP/2 with prior knowledge, like a gRPC client without TLS
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// grpcUpstream serves echo.Echo: Say echoes the request, Fail answers NOT_FOUND in a
+// trailers-only response and Chat echoes each message of a stream as it arrives
+func grpcUpstream(t *testing.T) *httptest.Server {
+	return startH2C(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc+proto" || r.Header.Get("Te") != "trailers" {
+			http.Error(w, "not a gRPC call", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		switch r.URL.Path {
+		case "/echo.Echo/Say":
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		case "/echo.Echo/Fail":
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "no such item")
+		case "/echo.Echo/Chat":
+			for {
+				_, msg, err := readGRPCFrame(r.Body)
+				if err != nil {
+					break
+				}
+				w.Write(grpcFrame(string(msg)))
+				w.(http.Flusher).Flush()
+			}
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		default:
+			w.Header().Set("Grpc-Status", "12")
+		}
+	}))
+}
+
+func newGRPCRequest(t *testing.T, url string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("Te", "trailers")
+	return req
+}
+
+func TestGRPCProxyPreservesTrailersAndLogsStatus(t *testing.T) {
+	upstream := grpcUpstream(t)
+	g := newTestGateway(t)
+	coll := g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) {
+		c.Protocol = ProtocolGRPC
+		c.LogEnabled = true
+	})
+	gateway := startH2C(t, g.router)
+	client := h2cClient()
+
+	resp, err := client.Do(newGRPCRequest(t, gateway.URL+"/proxy/svc/echo.Echo/Say", bytes.NewReader(grpcFrame("hello"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := readGRPCFrame(resp.Body)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil || string(msg) != "hello" {
+		t.Fatalf("reply %q, %v", msg, err)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("trailers %v, want grpc-status 0", resp.Trailer)
+	}
+	if entry := g.waitForLog(t, coll.ID); entry.GRPCStatus == nil || *entry.GRPCStatus != 0 || entry.Status != http.StatusOK {
+		t.Fatalf("log: status %d, grpc status %v", entry.Status, entry.GRPCStatus)
+	}
+
+	// Failed calls are logged with the HTTP equivalent of their status
+	g.db.Where("collection_id = ?", coll.ID).Delete(&database.RequestLog{})
+	resp, err = client.Do(newGRPCRequest(t, gateway.URL+"/proxy/svc/echo.Echo/Fail", bytes.NewReader(grpcFrame("x"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Grpc-Status") != "5" {
+		t.Fatalf("Fail: grpc-status %q", resp.Header.Get("Grpc-Status"))
+	}
+	entry := g.waitForLog(t, coll.ID)
+	if entry.GRPCStatus == nil || *entry.GRPCStatus != 5 || entry.Status != http.StatusNotFound || entry.GRPCMessage != "no such item" {
+		t.Fatalf("log: status %d, grpc status %v, message %q", entry.Status, entry.GRPCStatus, entry.GRPCMessage)
+	}
+}
+
+func TestGRPCBidirectionalStream(t *testing.T) {
+	upstream := grpcUpstream(t)
+	// The stream sends more than the request body limit, which does not apply to gRPC
+	g := newTestGatewayWithConfig(t, config.ProxyConfig{MaxRequestBodySize: 16})
+	g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) { c.Protocol = ProtocolGRPC })
+	gateway := startH2C(t, g.router)
+
+	// Each message is only sent after the previous reply arrived, so the gateway must
+	// not wait for more of the request body before calling the upstream
+	pr, pw := io.Pipe()
+	go pw.Write(grpcFrame("ping 1"))
+	resp, err := h2cClient().Do(newGRPCRequest(t, gateway.URL+"/proxy/svc/echo.Echo/Chat", pr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for i := 1; i <= 3; i++ {
+		done := make(chan struct{})
+		var msg []byte
+		go func() {
+			_, msg, err = readGRPCFrame(resp.Body)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no reply to message %d", i)
+		}
+		if err != nil || string(msg) != "ping "+string(rune('0'+i)) {
+			t.Fatalf("reply %d: %q, %v", i, msg, err)
+		}
+		if i < 3 {
+			go pw.Write(grpcFrame("ping " + string(rune('0'+i+1))))
+		}
+	}
+	pw.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("trailers %v", resp.Trailer)
+	}
+}
+
+func TestGRPCRoutesImportedMethods(t *testing.T) {
+	upstream := grpcUpstream(t)
+	g := newTestGateway(t)
+	coll := g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) { c.Protocol = ProtocolGRPC })
+	g.router.NoRoute(func(c *gin.Context) {
+		if IsGRPCMethodCall(c.Request) {
+			g.pm.HandleGRPCRequest(c)
+		}
+	})
+	gateway := startH2C(t, g.router)
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("echo.proto"),
+		Package: proto.String("echo"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Say"), InputType: proto.String(".echo.Message"), OutputType: proto.String(".echo.Message")},
+				{Name: proto.String("Chat"), InputType: proto.String(".echo.Message"), OutputType: proto.String(".echo.Message"),
+					ClientStreaming: proto.Bool(true), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.cm.ImportDescriptorSet(coll.ID, data); err != nil {
+		t.Fatal(err)
+	}
+	imported, _ := g.cm.GetCollection(coll.ID)
+	summaries := map[string]string{}
+	for _, ep := range imported.Endpoints {
+		summaries[ep.Method+" "+ep.Path] = ep.Summary
+	}
+	if summaries["POST /echo.Echo/Chat"] != "rpc Chat(stream echo.Message) returns (stream echo.Message)" || len(summaries) != 2 {
+		t.Fatalf("imported endpoints: %v", summaries)
+	}
+
+	client := h2cClient()
+	resp, err := client.Do(newGRPCRequest(t, gateway.URL+"/echo.Echo/Say", bytes.NewReader(grpcFrame("routed"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := readGRPCFrame(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(msg) != "routed" {
+		t.Fatalf("routed call: %q, %v", msg, err)
+	}
+
+	// Methods missing from the descriptor set are not routed
+	resp, err = client.Do(newGRPCRequest(t, gateway.URL+"/echo.Echo/Fail", bytes.NewReader(grpcFrame("x"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Grpc-Status") != "12" {
+		t.Fatalf("unknown method: grpc-status %q, want 12", resp.Header.Get("Grpc-Status"))
+	}
+}
+
+func TestGRPCWebTranslation(t *testing.T) {
+	upstream := grpcUpstream(t)
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) {
+		c.Protocol = ProtocolGRPC
+		c.GRPCWeb = true
+	})
+
+	for _, text := range []bool{false, true} {
+		body := grpcFrame("from browser")
+		contentType := "application/grpc-web+proto"
+		if text {
+			body = []byte(base64.StdEncoding.EncodeToString(body))
+			contentType = "application/grpc-web-text+proto"
+		}
+		req := httptest.NewRequest(http.MethodPost, "/proxy/svc/echo.Echo/Say", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		w := httptest.NewRecorder()
+		g.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != contentType {
+			t.Fatalf("text=%v: status %d, content type %q, body %q", text, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+		var reply io.Reader = w.Body
+		if text {
+			reply = &base64ChunkReader{src: w.Body}
+		}
+		if flags, msg, err := readGRPCFrame(reply); err != nil || flags != 0 || string(msg) != "from browser" {
+			t.Fatalf("text=%v: message frame %q, flags %x, %v", text, msg, flags, err)
+		}
+		flags, trailers, err := readGRPCFrame(reply)
+		if err != nil || flags != 0x80 || !strings.Contains(string(trailers), "grpc-status: 0\r\n") {
+			t.Fatalf("text=%v: trailer frame %q, flags %x, %v", text, trailers, flags, err)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"ab✗cd", 3, "ab"},
+		{"ab✗cd", 5, "ab✗"},
+	} {
+		if got := truncateUTF8(tt.s, tt.limit); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -2,62 +2,188 @@ package proxy
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
 
 	"context"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/alert"
+	"github.com/midgard/gateway/internal/cache"
 	"github.com/midgard/gateway/internal/collection"
-	"github.com/redis/go-redis/v9"
 	"github.com/midgard/gateway/internal/database"
 	"github.com/midgard/gateway/internal/health"
+	"github.com/midgard/gateway/internal/metrics"
+	"github.com/midgard/gateway/internal/openapi"
+	"github.com/midgard/gateway/internal/redact"
+	"github.com/midgard/gateway/internal/requestid"
+	"github.com/midgard/gateway/internal/tracing"
+	"golang.org/x/net/http2"
 	"gorm.io/gorm"
 )
 
+const (
+	lockPollInterval  = 50 * time.Millisecond // How often a request waiting for another instance's fetch checks the cache
+	revalidateTimeout = 30 * time.Second      // Upper bound on a background cache refresh
+)
+
+// ErrCacheUnavailable is returned by cache administration when caching is disabled
+var ErrCacheUnavailable = errors.New("response cache is not configured")
+
+// CacheStats are the cache statistics of a collection
+type CacheStats struct {
+	CollectionID string `json:"collection_id"`
+	cache.Stats
+	Hits     int64    `json:"hits"`
+	Misses   int64    `json:"misses"`
+	HitRatio *float64 `json:"hit_ratio"` // nil before the first lookup
+}
+
 // ProxyManager manages proxy requests
 type ProxyManager struct {
 	collectionManager *collection.CollectionManager
 	healthChecker     *health.HealthChecker
-	redisClient       *redis.Client
+	cache             cache.Backend // nil when caching is disabled
+	locker            cache.Locker  // Coordinates fetches across instances, nil unless distributed locking is enabled
+	cacheConfig       config.CacheConfig
+	proxyConfig       config.ProxyConfig
+	flights           *cache.Flights
+	revalidateClient  *http.Client
+	h2Transport       *http2.Transport // gRPC upstreams over TLS
+	h2cTransport      *http2.Transport // gRPC upstreams over plaintext HTTP/2
 	db                *gorm.DB
+	redactor          *redact.Redactor
+	metrics           *metrics.Gateway
+	tracer            *tracing.Tracer
+	monitor           *alert.Monitor
+	webSockets        sync.Map // Open WebSocket connections per collection ID (*atomic.Int64)
 	ctx               context.Context
 }
 
 // NewProxyManager creates a new proxy manager
-func NewProxyManager(cm *collection.CollectionManager, hc *health.HealthChecker, redisClient *redis.Client, db *gorm.DB) *ProxyManager {
-	return &ProxyManager{
+func NewProxyManager(cm *collection.CollectionManager, hc *health.HealthChecker, cacheBackend cache.Backend, cacheConfig config.CacheConfig, proxyConfig config.ProxyConfig, db *gorm.DB, redactor *redact.Redactor, gatewayMetrics *metrics.Gateway, tracer *tracing.Tracer, monitor *alert.Monitor) *ProxyManager {
+	if cacheConfig.LockTimeout <= 0 {
+		cacheConfig.LockTimeout = 5 * time.Second
+	}
+	if proxyConfig.RequestBufferSize <= 0 {
+		proxyConfig.RequestBufferSize = 64 << 10
+	}
+	pm := &ProxyManager{
 		collectionManager: cm,
 		healthChecker:     hc,
-		redisClient:       redisClient,
-		db:                db,
-		ctx:               context.Background(),
+		cache:             cacheBackend,
+		cacheConfig:       cacheConfig,
+		proxyConfig:       proxyConfig,
+		flights:           cache.NewFlights(),
+		// Background refreshes return redirects as-is, like the reverse proxy
+		revalidateClient: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		db:       db,
+		redactor: redactor,
+		metrics:  gatewayMetrics,
+		tracer:   tracer,
+		monitor:  monitor,
+		ctx:      context.Background(),
+	}
+	if cacheConfig.DistributedLock {
+		pm.locker, _ = cacheBackend.(cache.Locker)
 	}
+	pm.h2Transport, pm.h2cTransport = newGRPCTransports()
+	return pm
 }
 
 // HandleProxyRequest handles a proxy request
 func (pm *ProxyManager) HandleProxyRequest(c *gin.Context) {
-	prefix := c.Param("prefix")
-	path := c.Param("path")
-	
+	pm.proxyRequest(c, c.Param("prefix"), c.Param("path"))
+}
+
+// proxyRequest proxies a request to path of the collection with prefix
+func (pm *ProxyManager) proxyRequest(c *gin.Context, prefix, path string) {
 	// Remove leading slash from path if present
 	path = strings.TrimPrefix(path, "/")
 
+	// Request ID assigned by the request ID middleware
+	requestID := requestid.Get(c)
+
+	// Upgraded WebSocket connections bypass the gin writer and gRPC calls report failures
+	// in their status, so the effective status is tracked here
+	var ws *webSocketSession
+	var grpcCode *int
+	responseStatus := func() int {
+		switch {
+		case ws != nil && ws.upgraded():
+			return http.StatusSwitchingProtocols
+		case grpcCode != nil:
+			return grpcHTTPStatusOf(*grpcCode)
+		}
+		return c.Writer.Status()
+	}
+
+	// Accept or start a trace for this request
+	span := pm.tracer.StartRequest(c.Request.Method+" /proxy/"+prefix, c.Request.Header)
+	defer func() {
+		status := responseStatus()
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(status))
+		}
+		span.End()
+	}()
+	span.SetAttribute("http.request.method", c.Request.Method)
+	span.SetAttribute("url.path", c.Request.URL.Path)
+	span.SetAttribute("client.address", c.ClientIP())
+	span.SetAttribute("midgard.request_id", requestID)
+
 	// Get collection by prefix
+	routeSpan := span.StartChild("route lookup", tracing.KindInternal)
 	coll, err := pm.collectionManager.GetCollectionByPrefix(prefix)
 	if err != nil {
+		routeSpan.SetError("collection not found")
+		routeSpan.End()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
 		return
 	}
 
+	// Match the request to its endpoint template; metrics are labeled by template to bound cardinality
+	endpointLabel := metrics.UnmatchedEndpoint
+	var endpointID *uint
+	if endpoint := openapi.MatchEndpoint(coll.Endpoints, c.Request.Method, path); endpoint != nil {
+		endpointLabel = endpoint.Path
+		endpointID = &endpoint.ID
+	}
+	routeSpan.SetAttribute("midgard.collection", coll.Prefix)
+	routeSpan.SetAttribute("http.route", endpointLabel)
+	routeSpan.End()
+	if endpointLabel != metrics.UnmatchedEndpoint {
+		span.SetName(c.Request.Method + " /proxy/" + prefix + "/" + strings.TrimPrefix(endpointLabel, "/"))
+	}
+	span.SetAttribute("midgard.collection", coll.Prefix)
+	span.SetAttribute("http.route", endpointLabel)
+
+	requestStart := time.Now()
+	doneInFlight := pm.metrics.TrackInFlight(coll.Prefix)
+	defer func() {
+		doneInFlight()
+		// The latency of a WebSocket connection is its handshake, not its lifetime
+		elapsed := time.Since(requestStart)
+		if ws != nil && ws.upgraded() {
+			elapsed = ws.upgradedAt.Sub(requestStart)
+		}
+		pm.metrics.ObserveRequest(coll.Prefix, endpointLabel, c.Request.Method, responseStatus(), elapsed.Seconds())
+	}()
+
 	// Check if collection is active
 	if !coll.Active {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Collection is not active"})
@@ -65,66 +191,177 @@ func (pm *ProxyManager) HandleProxyRequest(c *gin.Context) {
 	}
 
 	// Check health if configured
-	if coll.HealthPath != "" {
+	if health.Enabled(coll) {
 		if !pm.healthChecker.IsHealthy(coll.ID) {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service is unhealthy"})
 			return
 		}
 	}
 
+	// A WebSocket connection holds one of the collection's connection slots until it closes
+	upgrade := isWebSocketUpgrade(c.Request)
+	if upgrade {
+		release, ok := pm.acquireWebSocket(coll.ID, coll.MaxWebSocketConnections)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many WebSocket connections"})
+			return
+		}
+		defer release()
+		defer pm.metrics.TrackWebSocket(coll.Prefix)()
+	}
+
 	// Build target URL
 	targetURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(coll.BaseURL, "/"), path)
 	if c.Request.URL.RawQuery != "" {
 		targetURL += "?" + c.Request.URL.RawQuery
 	}
 
-	// Capture request body and params before processing
-	requestBody, _ := io.ReadAll(c.Request.Body)
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	requestParamsJSON, _ := json.Marshal(c.Request.URL.Query())
+	// gRPC collections may translate gRPC-Web calls from browsers to native gRPC
+	grpcCall := coll.Protocol == ProtocolGRPC
+	grpcWeb := grpcCall && coll.GRPCWeb && isGRPCWebRequest(c.Request)
+	grpcWebText := grpcWeb && isGRPCWebText(c.Request)
+
+	// Reject request bodies over the size limit and buffer the start of the body for
+	// logging and cache keys; the rest streams to the upstream. gRPC streams may send
+	// messages for as long as the call lasts, so their bodies are not limited.
+	maxBodySize := pm.proxyConfig.MaxRequestBodySize
+	if coll.MaxRequestBodySize > 0 {
+		maxBodySize = coll.MaxRequestBodySize
+	}
+	if maxBodySize > 0 && !grpcCall {
+		if c.Request.ContentLength > maxBodySize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+	}
+	if grpcWeb {
+		// The reverse proxy only forwards "TE: trailers" when the client sent it, which
+		// browsers cannot, and native gRPC upstreams require it
+		c.Request.Header.Set("Te", "trailers")
+	}
+	if grpcWebText {
+		decodeGRPCWebText(c.Request)
+	}
+	// gRPC streams stay open in both directions, so their bodies are captured as they
+	// pass instead of being buffered ahead of the upstream call
+	var capture *capturedBody
+	if grpcCall {
+		capture = teeBody(c.Request, pm.proxyConfig.RequestBufferSize)
+	} else if capture, err = captureBody(c.Request, pm.proxyConfig.RequestBufferSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		}
+		return
+	}
+	requestBody := capture.head
+	requestParamsJSON, _ := json.Marshal(pm.redactor.Query(c.Request.URL.Query()))
 	fromCache := false
 
-	// Generate cache key early (before body is consumed by proxy)
-	var cacheKey string
-	if coll.CacheEnabled && pm.redisClient != nil {
-		cacheKey = pm.generateCacheKey(coll.ID, c.Request, coll.CacheKeyStrategy, requestBody)
-		cachedData, err := pm.redisClient.Get(pm.ctx, cacheKey).Result()
-		if err != nil && err != redis.Nil {
-			log.Printf("Cache GET error for key %s: %v", cacheKey, err)
-		}
-		if err == nil && len(cachedData) > 0 {
-			// Serve from cache
-			var cachedResponse map[string]interface{}
-			if err := json.Unmarshal([]byte(cachedData), &cachedResponse); err == nil {
-				// Set response headers if available
-				if headers, ok := cachedResponse["headers"].(map[string]interface{}); ok {
-					for k, v := range headers {
-						if str, ok := v.(string); ok {
-							c.Header(k, str)
-						}
-					}
-				}
-				// Set status code and write body
-				status := http.StatusOK
-				if statusVal, ok := cachedResponse["status"].(float64); ok {
-					status = int(statusVal)
-				}
-				if body, ok := cachedResponse["body"].(string); ok {
-					c.Header("X-Cache", "HIT")
-					fromCache = true
-					// Log cached request
-					if coll.LogEnabled {
-						pm.logRequest(coll.ID, path, c.Request.Method, targetURL, status, 0, len(requestBody), len(body), c.ClientIP(), c.Request.Header, c.Writer.Header(), coll.LogMaxEntries, coll.LogRolling, string(requestBody), string(requestParamsJSON), fromCache)
-					}
-					c.Data(status, "application/json", []byte(body))
-					return
-				}
+	// serveEntry answers the request from a cached response, replaying its stored headers.
+	// cacheStatus is reported in X-Cache: HIT for fresh and STALE for expired responses.
+	httpCache := coll.CacheMode == cache.ModeHTTP
+	serveEntry := func(entry *cache.Entry, cacheStatus string) {
+		now := time.Now()
+		status, body := entry.Status, entry.Body
+		if httpCache && entry.NotModified(c.Request) {
+			for k, v := range entry.NotModifiedHeaders(now) {
+				c.Writer.Header()[k] = v
 			}
+			status, body = http.StatusNotModified, nil
+		} else {
+			entry.WriteHeaders(c.Writer.Header(), now)
+		}
+		c.Header("X-Cache", cacheStatus)
+		fromCache = true
+
+		// Log cached request
+		if coll.LogEnabled {
+			logSpan := span.StartChild("logging", tracing.KindInternal)
+			pm.logRequest(coll, &database.RequestLog{
+				Path:          path,
+				EndpointID:    endpointID,
+				Method:        c.Request.Method,
+				TargetURL:     targetURL,
+				Status:        status,
+				RequestSize:   len(requestBody),
+				ResponseSize:  len(body),
+				ClientIP:      c.ClientIP(),
+				RequestParams: string(requestParamsJSON),
+				FromCache:     fromCache,
+				RequestID:     requestID,
+				TraceID:       span.TraceID(),
+			}, c.Request.Header, c.Writer.Header(), requestBody, body, true, true)
+			logSpan.End()
+		}
+		c.Status(status)
+		if c.Request.Method != http.MethodHead && len(body) > 0 {
+			c.Writer.Write(body)
 		}
 	}
 
-	// Start timer
+	// Look up the response cache. In HTTP mode only the collection's cache methods are
+	// cached, HEAD is answered from GET responses and clients can bypass the cache.
+	// Cache rules can bypass the cache or change the key and TTL per endpoint or path.
+	// Requests with bodies too large to buffer, WebSocket upgrades and gRPC calls are
+	// not cached.
+	cacheMethods := cache.Methods(coll.CacheMethods)
+	var plan *cachePlan
+	var cacheKey string
+	var staleEntry *cache.Entry // Served in place of upstream failures (stale-if-error)
+	if coll.CacheEnabled && pm.cache != nil && capture.complete && !upgrade && !grpcCall && (!httpCache || cache.MethodAllowed(cacheMethods, c.Request.Method)) {
+		keyMethod := c.Request.Method
+		if httpCache && keyMethod == http.MethodHead {
+			keyMethod = http.MethodGet
+		}
+		if plan = pm.planCache(coll, keyMethod, path, c.Request, requestBody); plan != nil {
+			cacheKey = plan.key
+		}
+	}
+	if cacheKey != "" && (!httpCache || cache.LookupAllowed(c.Request)) {
+		cacheSpan := span.StartChild("cache lookup", tracing.KindClient)
+		entry, err := pm.cache.Lookup(pm.ctx, cacheKey, c.Request)
+		if err != nil {
+			log.Printf("[request_id=%s] Cache GET error for key %s: %v", requestID, cacheKey, err)
+			pm.monitor.CacheError("GET", err)
+			cacheSpan.SetError(err.Error())
+		}
+		now := time.Now()
+		hit := entry != nil && (entry.Fresh(now) || entry.Revalidatable(now))
+		cacheSpan.SetAttribute("midgard.cache.hit", hit)
+		cacheSpan.End()
+		pm.metrics.ObserveCache(coll.Prefix, hit)
+
+		switch {
+		case entry != nil && entry.Fresh(now):
+			serveEntry(entry, "HIT")
+			return
+		case entry != nil && entry.Revalidatable(now):
+			// Serve the expired response while a background fetch refreshes it
+			serveEntry(entry, "STALE")
+			pm.revalidate(coll, c.Request, plan, targetURL, requestBody, entry, requestID)
+			return
+		case entry != nil && entry.UsableOnError(now):
+			staleEntry = entry
+		}
+
+		// Coalesce concurrent misses so only one request per key goes to the upstream
+		entry, release := pm.coalesce(c.Request.Context(), cacheKey, c.Request, requestID)
+		if entry != nil {
+			serveEntry(entry, "HIT")
+			return
+		}
+		defer release()
+		c.Header("X-Cache", "MISS")
+	}
+
+	// Start timer and trace upstream connection phases
 	start := time.Now()
+	timing := newRequestTiming()
+	c.Request = c.Request.WithContext(httptrace.WithClientTrace(c.Request.Context(), timing.clientTrace()))
 
 	// Create reverse proxy
 	target, err := url.Parse(targetURL)
@@ -135,6 +372,51 @@ func (pm *ProxyManager) HandleProxyRequest(c *gin.Context) {
 
 	// Create proxy
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorLog = log.New(log.Writer(), fmt.Sprintf("[request_id=%s] ", requestID), log.LstdFlags|log.Lmsgprefix)
+	// The middleware already echoes our request ID; drop the upstream's copy so the header isn't duplicated
+	var webBody *grpcWebBody
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if requestID != "" {
+			resp.Header.Del(requestid.Header)
+		}
+		if grpcWeb {
+			webBody = translateGRPCWebResponse(resp, grpcWebText)
+		}
+		if staleEntry != nil && resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("upstream returned %s", resp.Status)
+		}
+		return nil
+	}
+	// Answer request bodies over the size limit with 413, replace upstream errors and 5xx
+	// responses with the expired cached response when there is one, and report upstream
+	// errors of gRPC calls as UNAVAILABLE
+	servedStale := false
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(`{"error":"Request body too large"}`))
+		case staleEntry != nil:
+			log.Printf("[request_id=%s] Upstream failed, serving stale response for key %s: %v", requestID, cacheKey, err)
+			servedStale = true
+			serveEntry(staleEntry, "STALE")
+		case grpcCall:
+			proxy.ErrorLog.Printf("http: proxy error: %v", err)
+			contentType := "application/grpc"
+			if grpcWeb {
+				contentType = grpcWebContentType(contentType, grpcWebText)
+			}
+			writeGRPCError(w, contentType, grpcUnavailable, "upstream unavailable")
+		default:
+			proxy.ErrorLog.Printf("http: proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	upstreamSpan := span.StartChild("upstream "+c.Request.Method, tracing.KindClient)
+	upstreamSpan.SetAttribute("server.address", target.Host)
+	upstreamSpan.SetAttribute("url.full", pm.redactor.URL(targetURL))
 
 	// Modify the request to use the correct path
 	originalDirector := proxy.Director
@@ -147,100 +429,400 @@ func (pm *ProxyManager) HandleProxyRequest(c *gin.Context) {
 		if c.Request.URL.RawQuery != "" {
 			req.URL.RawQuery = c.Request.URL.RawQuery
 		}
+		if grpcWeb {
+			translateGRPCWebRequest(req)
+		}
+		// Forward the request ID for correlation with upstream logs
+		if requestID != "" {
+			req.Header.Set(requestid.Header, requestID)
+		}
+		// Propagate the trace with the upstream span as parent
+		if upstreamSpan != nil {
+			req.Header.Set(tracing.TraceparentHeader, upstreamSpan.Traceparent())
+			if state := upstreamSpan.Tracestate(); state != "" {
+				req.Header.Set(tracing.TracestateHeader, state)
+			}
+		}
 	}
 
-	// Capture response
+	// Pass the response through, keeping as much of it as logging and caching need
+	logLimit := 0
+	if coll.LogEnabled && coll.LogResponseBody {
+		logLimit = coll.LogResponseBodyMaxSize
+	}
+	captureLimit := logLimit
+	if plan != nil {
+		// A maximum cacheable size of 0 caches responses of any size
+		if coll.CacheMaxSize > 0 {
+			captureLimit = max(captureLimit, coll.CacheMaxSize)
+		} else {
+			captureLimit = -1
+		}
+	}
 	responseRecorder := &responseRecorder{
 		ResponseWriter: c.Writer,
 		body:           &bytes.Buffer{},
 		status:         http.StatusOK,
+		limit:          captureLimit,
+		streamLimit:    logLimit,
 	}
 
-	// Serve the request
+	// Count the traffic of WebSocket connections and close them when idle or open too long
+	if upgrade {
+		ws = newWebSocketSession(pm.proxyConfig.WebSocketIdleTimeout, pm.proxyConfig.WebSocketMaxDuration)
+		proxy.Transport = ws.transport(http.DefaultTransport)
+		responseRecorder.hijacked = ws.hijacked
+	}
+	if grpcCall {
+		proxy.Transport = pm.grpcTransport(target.Scheme)
+	}
+
+	// Serve the request; upgraded connections are proxied until either side closes them
 	proxy.ServeHTTP(responseRecorder, c.Request)
+	if ws != nil {
+		if reason := ws.finish(); reason != "" {
+			log.Printf("[request_id=%s] Closed WebSocket connection: %s", requestID, reason)
+		}
+	}
+	upstreamSpan.SetAttribute("http.response.status_code", responseRecorder.status)
+
+	// The status of a gRPC call is in the trailers, or the headers of trailers-only responses
+	var grpcMessage string
+	if grpcCall {
+		header := responseRecorder.Header()
+		if webBody != nil && webBody.trailer != nil {
+			header = webBody.trailer
+		}
+		if code, message, ok := grpcStatus(header); ok {
+			grpcCode, grpcMessage = &code, message
+			upstreamSpan.SetAttribute("rpc.grpc.status_code", code)
+		}
+	}
+	if responseRecorder.status >= http.StatusInternalServerError {
+		upstreamSpan.SetError(http.StatusText(responseRecorder.status))
+	}
+	upstreamSpan.End()
+	if servedStale {
+		return
+	}
 
 	// Calculate duration
+	timing.finish()
 	duration := time.Since(start).Milliseconds()
 
 	// Log the request if enabled
 	if coll.LogEnabled {
-		pm.logRequest(coll.ID, path, c.Request.Method, targetURL, responseRecorder.status, duration, len(requestBody), responseRecorder.body.Len(), c.ClientIP(), c.Request.Header, responseRecorder.Header(), coll.LogMaxEntries, coll.LogRolling, string(requestBody), string(requestParamsJSON), fromCache)
+		logSpan := span.StartChild("logging", tracing.KindInternal)
+		entry := &database.RequestLog{
+			Path:          path,
+			EndpointID:    endpointID,
+			Method:        c.Request.Method,
+			TargetURL:     targetURL,
+			Status:        responseRecorder.status,
+			Duration:      duration,
+			RequestSize:   int(capture.size()),
+			ResponseSize:  int(responseRecorder.size),
+			ClientIP:      c.ClientIP(),
+			RequestParams: string(requestParamsJSON),
+			FromCache:     fromCache,
+			RequestID:     requestID,
+			TraceID:       span.TraceID(),
+		}
+		entry.DNSTime, entry.ConnectTime, entry.TLSTime, entry.TTFB, entry.TransferTime = timing.breakdown()
+		if ws != nil && ws.upgraded() {
+			entry.RequestSize, entry.ResponseSize = int(ws.sent.bytes.Load()), int(ws.received.bytes.Load())
+			entry.MessagesSent, entry.MessagesReceived = ws.sent.messages.Load(), ws.received.messages.Load()
+		}
+		if grpcCode != nil {
+			entry.Status = grpcHTTPStatusOf(*grpcCode)
+			entry.GRPCStatus = grpcCode
+			entry.GRPCMessage = truncateUTF8(grpcMessage, 500)
+		}
+		pm.logRequest(coll, entry, c.Request.Header, responseRecorder.Header(), capture.head, responseRecorder.body.Bytes(), capture.complete, !responseRecorder.truncated)
+		logSpan.End()
 	}
 
-	// Cache the response if enabled
-	if coll.CacheEnabled && pm.redisClient != nil && responseRecorder.status == http.StatusOK {
-		// Use the same cache key generated earlier
-		if cacheKey == "" {
-			cacheKey = pm.generateCacheKey(coll.ID, c.Request, coll.CacheKeyStrategy, requestBody)
+	// Cache the response if enabled and it was captured whole
+	if plan != nil && !responseRecorder.truncated {
+		pm.storeResponse(coll, c.Request, plan, responseRecorder.status, responseRecorder.Header(), responseRecorder.body.Bytes(), requestID)
+	} else if httpCache && coll.CacheEnabled && pm.cache != nil && !grpcCall && cache.Invalidates(c.Request.Method, responseRecorder.status) {
+		// A successful unsafe request invalidates the cached GET response of its URL
+		if get := pm.planCache(coll, http.MethodGet, path, c.Request, nil); get != nil {
+			if err := pm.cache.Invalidate(pm.ctx, coll.ID, get.key); err != nil {
+				log.Printf("[request_id=%s] Failed to invalidate cache key %s: %v", requestID, get.key, err)
+				pm.monitor.CacheError("DEL", err)
+			}
 		}
-		responseData := map[string]interface{}{
-			"status":  responseRecorder.status,
-			"body":    responseRecorder.body.String(),
-			"headers": responseRecorder.Header(),
+	}
+}
+
+// storeResponse caches an upstream response. In TTL mode successful responses are kept
+// for the planned TTL; in HTTP mode the response's caching headers decide, with the
+// planned TTL as the default freshness lifetime. Either way the entry is kept past its
+// freshness for the collection's stale-while-revalidate and stale-if-error windows.
+// Bodies larger than the collection's maximum cacheable size and event streams are not
+// stored.
+func (pm *ProxyManager) storeResponse(coll *database.Collection, req *http.Request, plan *cachePlan, status int, header http.Header, body []byte, requestID string) {
+	if coll.CacheMaxSize > 0 && len(body) > coll.CacheMaxSize {
+		return
+	}
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	now := time.Now()
+	entry := cache.NewEntry(status, header, body, now)
+	key, ttl := plan.key, plan.ttl
+	staleWhileRevalidate := time.Duration(coll.CacheStaleWhileRevalidate) * time.Second
+	staleIfError := time.Duration(coll.CacheStaleIfError) * time.Second
+
+	if coll.CacheMode == cache.ModeHTTP {
+		if req.Method == http.MethodHead {
+			return
 		}
-		if data, err := json.Marshal(responseData); err == nil {
-			err := pm.redisClient.Set(pm.ctx, cacheKey, string(data), time.Duration(coll.CacheTTL)*time.Second).Err()
-			if err != nil {
-				log.Printf("Failed to set cache for key %s: %v", cacheKey, err)
+		var reason string
+		if ttl, reason = cache.Freshness(req, status, header, ttl, plan.perConsumer, now); reason != "" {
+			return
+		}
+		staleWhileRevalidate, staleIfError = cache.StaleWindows(header, staleWhileRevalidate, staleIfError)
+	} else {
+		if status != http.StatusOK {
+			return
+		}
+		entry.Vary = nil
+	}
+
+	ttl = entry.SetLifetime(now, ttl, staleWhileRevalidate, staleIfError)
+	entry.Meta = cache.Meta{
+		Collection: coll.ID,
+		Method:     req.Method,
+		Path:       strings.TrimPrefix(req.URL.Path, "/proxy/"+coll.Prefix),
+		Tags:       cache.ParseTags(header, pm.cacheConfig.TagHeader),
+	}
+	if err := pm.cache.Store(pm.ctx, key, req, entry, ttl); err != nil {
+		log.Printf("[request_id=%s] Failed to set cache for key %s: %v", requestID, key, err)
+		pm.monitor.CacheError("SET", err)
+	}
+}
+
+// coalesce waits for a fetch of key that is already in flight on this instance, or on
+// another instance when distributed locking is enabled. It returns the fresh entry that
+// fetch stored, or a release function when the request has to go to the upstream
+// itself; the release function must be called once its response is stored.
+func (pm *ProxyManager) coalesce(ctx context.Context, key string, req *http.Request, requestID string) (*cache.Entry, func()) {
+	timeout := pm.cacheConfig.LockTimeout
+	wait, done := pm.flights.Begin(key)
+	if done == nil {
+		select {
+		case <-wait:
+		case <-time.After(timeout):
+		case <-ctx.Done():
+		}
+		if entry := pm.lookupFresh(ctx, key, req); entry != nil {
+			return entry, nil
+		}
+		return nil, func() {}
+	}
+	if pm.locker == nil {
+		return nil, done
+	}
+
+	token, err := pm.locker.Lock(ctx, key, timeout)
+	if err != nil {
+		log.Printf("[request_id=%s] Failed to lock cache key %s: %v", requestID, key, err)
+		pm.monitor.CacheError("LOCK", err)
+		return nil, done
+	}
+	if token != "" {
+		return nil, func() {
+			if err := pm.locker.Unlock(pm.ctx, key, token); err != nil {
+				log.Printf("[request_id=%s] Failed to unlock cache key %s: %v", requestID, key, err)
 			}
-		} else {
-			log.Printf("Failed to marshal response data for caching: %v", err)
+			done()
 		}
 	}
+
+	// Another instance is fetching the response; poll until it is stored
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(lockPollInterval)
+		if entry := pm.lookupFresh(ctx, key, req); entry != nil {
+			done()
+			return entry, nil
+		}
+	}
+	return nil, done
 }
 
-// generateCacheKey generates a cache key based on strategy
-func (pm *ProxyManager) generateCacheKey(collectionID string, r *http.Request, strategy string, requestBody []byte) string {
-	key := fmt.Sprintf("%s:%s:%s", collectionID, r.Method, r.URL.Path)
+// lookupFresh returns the fresh entry stored for key, or nil
+func (pm *ProxyManager) lookupFresh(ctx context.Context, key string, req *http.Request) *cache.Entry {
+	entry, err := pm.cache.Lookup(ctx, key, req)
+	if err != nil {
+		pm.monitor.CacheError("GET", err)
+		return nil
+	}
+	if entry == nil || !entry.Fresh(time.Now()) {
+		return nil
+	}
+	return entry
+}
 
-	// Add query params
-	if strategy == "params" || strategy == "all" {
-		key += fmt.Sprintf(":%s", r.URL.RawQuery)
+// revalidate refreshes an expired entry in the background. At most one refresh per key
+// runs on this instance, and across instances when distributed locking is enabled. The
+// upstream is asked to validate the entry so an unchanged response costs no body transfer.
+func (pm *ProxyManager) revalidate(coll *database.Collection, req *http.Request, plan *cachePlan, targetURL string, body []byte, stale *cache.Entry, requestID string) {
+	key := plan.key
+	_, done := pm.flights.Begin(key)
+	if done == nil {
+		return
 	}
+	// The request is reused once the handler returns
+	req = req.Clone(context.Background())
+
+	go func() {
+		defer done()
+		if pm.locker != nil {
+			token, err := pm.locker.Lock(pm.ctx, key, pm.cacheConfig.LockTimeout)
+			if err != nil {
+				log.Printf("[request_id=%s] Failed to lock cache key %s: %v", requestID, key, err)
+				pm.monitor.CacheError("LOCK", err)
+				return
+			}
+			if token == "" {
+				return
+			}
+			defer pm.locker.Unlock(pm.ctx, key, token)
+		}
+
+		ctx, cancel := context.WithTimeout(pm.ctx, revalidateTimeout)
+		defer cancel()
+		method := req.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		upstreamReq, err := http.NewRequestWithContext(ctx, method, targetURL, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		upstreamReq.Header = req.Header.Clone()
+		for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range"} {
+			upstreamReq.Header.Del(name)
+		}
+		if etag := stale.Header.Get("ETag"); etag != "" {
+			upstreamReq.Header.Set("If-None-Match", etag)
+		}
+		if modified := stale.Header.Get("Last-Modified"); modified != "" {
+			upstreamReq.Header.Set("If-Modified-Since", modified)
+		}
+		if requestID != "" {
+			upstreamReq.Header.Set(requestid.Header, requestID)
+		}
 
-	// Add body hash (use the provided requestBody instead of reading from r.Body)
-	if (strategy == "body" || strategy == "all") && len(requestBody) > 0 {
-		hash := md5.Sum(requestBody)
-		key += fmt.Sprintf(":%x", hash)
+		resp, err := pm.revalidateClient.Do(upstreamReq)
+		if err != nil {
+			log.Printf("[request_id=%s] Background refresh of cache key %s failed: %v", requestID, key, err)
+			return
+		}
+		defer resp.Body.Close()
+		// Read one byte past the cacheable size so oversized responses are recognized
+		reader := io.Reader(resp.Body)
+		if coll.CacheMaxSize > 0 {
+			reader = io.LimitReader(resp.Body, int64(coll.CacheMaxSize)+1)
+		}
+		respBody, err := io.ReadAll(reader)
+		if err != nil {
+			log.Printf("[request_id=%s] Background refresh of cache key %s failed: %v", requestID, key, err)
+			return
+		}
+
+		status, header := resp.StatusCode, resp.Header
+		if status == http.StatusNotModified {
+			status, header, respBody = stale.Status, stale.Freshened(resp.Header), stale.Body
+		}
+		pm.storeResponse(coll, req, plan, status, header, respBody, requestID)
+	}()
+}
+
+// CacheStats summarizes a collection's cached responses and the cache lookups this
+// instance has made for it since start
+func (pm *ProxyManager) CacheStats(ctx context.Context, coll *database.Collection) (*CacheStats, error) {
+	if pm.cache == nil {
+		return nil, ErrCacheUnavailable
 	}
+	stored, err := pm.cache.Stats(ctx, coll.ID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &CacheStats{CollectionID: coll.ID, Stats: stored}
+	stats.Hits, stats.Misses = pm.metrics.CacheResults(coll.Prefix)
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		ratio := float64(stats.Hits) / float64(lookups)
+		stats.HitRatio = &ratio
+	}
+	return stats, nil
+}
 
-	return key
+// PurgeCache removes a collection's cached responses for which match returns true, or
+// all of them when match is nil, and returns how many were removed
+func (pm *ProxyManager) PurgeCache(ctx context.Context, collectionID string, match func(cache.Meta) bool) (int, error) {
+	if pm.cache == nil {
+		return 0, ErrCacheUnavailable
+	}
+	return pm.cache.Purge(ctx, collectionID, match)
 }
 
-// logRequest logs a request to the database
-func (pm *ProxyManager) logRequest(collectionID, path, method, targetURL string, status int, duration int64, requestSize, responseSize int, clientIP string, requestHeaders, responseHeaders http.Header, maxEntries int, rolling bool, requestBody, requestParams string, fromCache bool) {
-	reqHeadersJSON, _ := json.Marshal(requestHeaders)
-	respHeadersJSON, _ := json.Marshal(responseHeaders)
-
-	log := database.RequestLog{
-		CollectionID:    collectionID,
-		Path:            path,
-		Method:          method,
-		TargetURL:       targetURL,
-		Status:          status,
-		Duration:        duration,
-		RequestSize:     requestSize,
-		ResponseSize:    responseSize,
-		ClientIP:        clientIP,
-		RequestHeaders:  string(reqHeadersJSON),
-		ResponseHeaders: string(respHeadersJSON),
-		RequestBody:     requestBody,
-		RequestParams:   requestParams,
-		FromCache:       fromCache,
-		Timestamp:       time.Now(),
+// PurgeCacheTags removes a collection's cached responses tagged with any of tags
+func (pm *ProxyManager) PurgeCacheTags(ctx context.Context, collectionID string, tags []string) (int, error) {
+	if pm.cache == nil {
+		return 0, ErrCacheUnavailable
+	}
+	return pm.cache.PurgeTags(ctx, collectionID, tags)
 }
 
+// logRequest logs a request to the database.
+// Sensitive headers, query parameters and body fields are redacted before anything is stored.
+// The response body is only stored when the collection enables it, capped at its configured size.
+func (pm *ProxyManager) logRequest(coll *database.Collection, entry *database.RequestLog, requestHeaders, responseHeaders http.Header, requestBody, responseBody []byte, requestComplete, responseComplete bool) {
+	reqHeadersJSON, _ := json.Marshal(pm.redactor.Headers(requestHeaders))
+	respHeadersJSON, _ := json.Marshal(pm.redactor.Headers(responseHeaders))
+
+	entry.CollectionID = coll.ID
+	entry.TargetURL = pm.redactor.URL(entry.TargetURL)
+	entry.RequestHeaders = string(reqHeadersJSON)
+	entry.ResponseHeaders = string(respHeadersJSON)
+	// Bodies larger than what was captured are stored as a marked prefix, the sizes in
+	// entry being their full sizes
+	if requestComplete {
+		entry.RequestBody = pm.redactor.Body(requestBody)
+	} else {
+		entry.RequestBody = pm.redactor.PartialBody(requestBody, int64(entry.RequestSize), 0)
+	}
+	if coll.LogResponseBody {
+		if responseComplete {
+			entry.ResponseBody = pm.redactor.BodyLimit(responseBody, coll.LogResponseBodyMaxSize)
+		} else {
+			entry.ResponseBody = pm.redactor.PartialBody(responseBody, int64(entry.ResponseSize), coll.LogResponseBodyMaxSize)
+		}
+	}
+	// Without the monotonic clock reading, which SQLite would store as part of the text,
+	// so that keyset pagination can match a timestamp exactly
+	entry.Timestamp = time.Now().Round(0)
+
+	defer pm.metrics.TrackLogWrite()()
+
 	// Insert log
-	pm.db.Create(&log)
+	if err := pm.db.Create(entry).Error; err != nil {
+		log.Printf("[request_id=%s] Failed to write request log for collection %s: %v", entry.RequestID, coll.ID, err)
+		return
+	}
 
 	// Handle rolling logs
-	if rolling {
+	if coll.LogRolling {
 		var count int64
-		pm.db.Model(&database.RequestLog{}).Where("collection_id = ?", collectionID).Count(&count)
-		if count > int64(maxEntries) {
+		pm.db.Model(&database.RequestLog{}).Where("collection_id = ?", coll.ID).Count(&count)
+		if count > int64(coll.LogMaxEntries) {
 			// Delete oldest logs in batch to reduce database locks
 			// Use a subquery to find the IDs of logs to delete, then delete them in one operation
-			excessCount := count - int64(maxEntries)
+			excessCount := count - int64(coll.LogMaxEntries)
 			pm.db.Exec(`
 				DELETE FROM request_logs 
 				WHERE id IN (
@@ -249,24 +831,7 @@ func (pm *ProxyManager) logRequest(collectionID, path, method, targetURL string,
 					ORDER BY timestamp ASC 
 					LIMIT ?
 				)
-			`, collectionID, excessCount)
+			`, coll.ID, excessCount)
 		}
 	}
 }
-
-// responseRecorder captures the response for logging and caching
-type responseRecorder struct {
-	http.ResponseWriter
-	body   *bytes.Buffer
-	status int
-}
-
-func (r *responseRecorder) WriteHeader(status int) {
-	r.status = status
-	r.ResponseWriter.WriteHeader(status)
-}
-
-func (r *responseRecorder) Write(b []byte) (int, error) {
-	r.body.Write(b)
-	return r.ResponseWriter.Write(b)
-}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// capturedBody is a request body whose first bytes are buffered for logging, cache keys
+// and background refreshes while the rest streams to the upstream
+type capturedBody struct {
+	io.Reader
+	io.Closer
+	head     []byte // The buffered start of the body, all of it when complete
+	complete bool   // head holds the whole body
+	read     int64  // Bytes read from the body, including the buffered ones
+	tee      int    // When set, head collects up to this many bytes as the body is read
+}
+
+// captureBody buffers up to limit bytes of the request body and replaces the body with
+// a reader that replays them before the rest. A read error, such as exceeding the
+// request size limit, is returned.
+func captureBody(req *http.Request, limit int) (*capturedBody, error) {
+	body := &capturedBody{Closer: io.NopCloser(nil)}
+	if req.Body == nil || req.Body == http.NoBody {
+		body.Reader, body.complete = bytes.NewReader(nil), true
+		return body, nil
+	}
+
+	head, err := io.ReadAll(io.LimitReader(req.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) <= limit {
+		req.Body.Close()
+		body.head, body.complete = head, true
+		body.Reader = bytes.NewReader(head)
+	} else {
+		body.head = head[:limit]
+		body.Reader = io.MultiReader(bytes.NewReader(head), req.Body)
+		body.Closer = req.Body
+	}
+	req.Body = body
+	return body, nil
+}
+
+// teeBody keeps the first limit bytes of the request body as they are read, without
+// reading ahead. Streams that wait for responses before sending more use it.
+func teeBody(req *http.Request, limit int) *capturedBody {
+	body := &capturedBody{Reader: bytes.NewReader(nil), Closer: io.NopCloser(nil), tee: limit, complete: true}
+	if req.Body != nil && req.Body != http.NoBody {
+		body.Reader, body.Closer, body.complete = req.Body, req.Body, false
+		req.Body = body
+	}
+	return body
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if room := b.tee - len(b.head); room > 0 {
+		b.head = append(b.head, p[:min(room, n)]...)
+	}
+	b.read += int64(n)
+	// A teed body is known to be complete once it has been read to the end within the limit
+	if err == io.EOF && b.read == int64(len(b.head)) {
+		b.complete = true
+	}
+	return n, err
+}
+
+// size is the number of body bytes received so far
+func (b *capturedBody) size() int64 {
+	return max(b.read, int64(len(b.head)))
+}
+
+// responseRecorder passes the response through to the client and keeps its first
+// limit bytes for logging and caching. Flushes are forwarded so streamed responses
+// such as Server-Sent Events reach the client as they are produced, and the connection
+// can be hijacked for protocol upgrades.
+type responseRecorder struct {
+	http.ResponseWriter
+	body        *bytes.Buffer
+	status      int
+	limit       int                     // Bytes of the body kept in body, or all of it when negative
+	streamLimit int                     // Bytes kept of event streams, which are never cached
+	size        int64                   // Bytes written to the client
+	truncated   bool                    // The body was larger than limit
+	hijacked    func(net.Conn) net.Conn // Wraps the connection taken over by Hijack, if set
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	// Event streams may never end, so they are not kept whole
+	if r.limit < 0 && strings.HasPrefix(r.Header().Get("Content-Type"), "text/event-stream") {
+		r.limit = r.streamLimit
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.limit < 0 {
+		r.body.Write(b)
+	} else if room := r.limit - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(room, len(b))])
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	if r.limit >= 0 && r.size > int64(r.limit) {
+		r.truncated = true
+	}
+	return n, err
+}
+
+// Flush sends buffered data to the client
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack takes over the client connection for a protocol switch, which the reverse
+// proxy answers with 101 Switching Protocols on the connection itself
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.status = http.StatusSwitchingProtocols
+	if r.hijacked != nil {
+		// Bytes the client sent right after its request may already be buffered; they
+		// are read back through the wrapped connection so they are counted too
+		if n := brw.Reader.Buffered(); n > 0 {
+			buffered, _ := brw.Reader.Peek(n)
+			conn = &bufferedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), conn)}
+		}
+		conn = r.hijacked(conn)
+		brw.Reader.Reset(conn)
+	}
+	return conn, brw, nil
+}
+
+// bufferedConn is a connection whose reads start with data buffered before it was hijacked
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"github.com/midgard/gateway/internal/redact"
+)
+
+func TestRequestBodyLimit(t *testing.T) {
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, n)
+	})
+	g := newTestGatewayWithConfig(t, config.ProxyConfig{MaxRequestBodySize: 100, RequestBufferSize: 16})
+	g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) { c.CacheEnabled = false })
+
+	post := func(body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/proxy/svc/upload", body)
+		req.ContentLength = contentLength
+		w := httptest.NewRecorder()
+		g.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A declared length over the limit is rejected before the upstream is contacted
+	if w := post(strings.NewReader(strings.Repeat("x", 101)), 101); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared oversized body: status %d", w.Code)
+	}
+	if hits.Load() != 0 {
+		t.Fatal("oversized request reached the upstream")
+	}
+
+	// A chunked body is streamed past the buffer and cut off at the limit
+	if w := post(io.MultiReader(strings.NewReader(strings.Repeat("x", 200))), -1); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed oversized body: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	// Bodies within the limit but larger than the buffer reach the upstream intact
+	if w := post(io.MultiReader(strings.NewReader(strings.Repeat("x", 90))), -1); w.Code != http.StatusOK || w.Body.String() != "90" {
+		t.Fatalf("streamed body: status %d, upstream read %q bytes", w.Code, w.Body.String())
+	}
+}
+
+func TestPartlyCapturedBodiesAreRedactedAndMarked(t *testing.T) {
+	upstream, _ := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+	g := newTestGatewayWithConfig(t, config.ProxyConfig{RequestBufferSize: 32})
+	var err error
+	if g.pm.redactor, err = redact.NewRedactor(&config.RedactConfig{BodyPaths: []string{"$.password"}}); err != nil {
+		t.Fatal(err)
+	}
+	logged := func(c *database.Collection) {
+		c.CacheEnabled = false
+		c.LogEnabled = true
+		c.LogResponseBody = true
+		c.LogResponseBodyMaxSize = 32
+	}
+	jsonColl := g.addCollection(t, "json", upstream.URL, logged)
+	textColl := g.addCollection(t, "text", upstream.URL, logged)
+
+	post := func(path, body string) {
+		w := httptest.NewRecorder()
+		g.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		if w.Body.String() != body {
+			t.Fatalf("upstream echoed %d bytes, want %d", w.Body.Len(), len(body))
+		}
+	}
+
+	// A cut-off JSON document cannot be masked, so it is not stored
+	secret := `{"password":"hunter2","data":"` + strings.Repeat("x", 100) + `"}`
+	post("/proxy/json/login", secret)
+	entry := g.waitForLog(t, jsonColl.ID)
+	want := fmt.Sprintf("[REDACTED]...[truncated %d bytes]", len(secret))
+	if entry.RequestBody != want || entry.ResponseBody != want {
+		t.Fatalf("logged request body %q, response body %q, want %q", entry.RequestBody, entry.ResponseBody, want)
+	}
+
+	// Other bodies keep their captured start, marked even when cut exactly at the limit
+	text := strings.Repeat("t", 40)
+	post("/proxy/text/upload", text)
+	entry = g.waitForLog(t, textColl.ID)
+	want = strings.Repeat("t", 32) + "...[truncated 8 bytes]"
+	if entry.RequestBody != want || entry.ResponseBody != want {
+		t.Fatalf("logged request body %q, response body %q, want %q", entry.RequestBody, entry.ResponseBody, want)
+	}
+}
+
+func TestLargeResponseIsStreamedAndNotCached(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 100<<10)
+	upstream, hits := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, func(c *database.Collection) {
+		c.CacheMode = "ttl"
+		c.CacheMaxSize = 1024
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := g.do(http.MethodGet, "/proxy/svc/big"); !bytes.Equal(w.Body.Bytes(), large) {
+			t.Fatalf("got %d bytes, want %d", w.Body.Len(), len(large))
+		}
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("upstream hit %d times, want 2 (oversized responses are not cached)", hits.Load())
+	}
+}
+
+func TestServerSentEventsAreFlushed(t *testing.T) {
+	release := make(chan struct{})
+	upstream, _ := countingUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: second\n\n")
+	})
+	g := newTestGateway(t)
+	g.addCollection(t, "svc", upstream.URL, nil)
+	gateway := httptest.NewServer(g.router)
+	defer gateway.Close()
+	defer close(release)
+
+	resp, err := http.Get(gateway.URL + "/proxy/svc/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	line := make(chan string, 1)
+	go func() {
+		l, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		if l != "data: first\n" {
+			t.Fatalf("first event = %q", l)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("first event was not flushed before the stream ended")
+	}
+}
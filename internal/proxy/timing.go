@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTiming records the phases of an upstream request via httptrace
+type requestTiming struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+// newRequestTiming creates a timing recorder starting now
+func newRequestTiming() *requestTiming {
+	return &requestTiming{start: time.Now()}
+}
+
+// clientTrace returns the httptrace hooks that fill in the timing
+func (t *requestTiming) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart, true) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone, false) },
+		// Dialing may race several addresses; keep the first start and the last completion
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte, true) },
+	}
+}
+
+// finish marks the end of the response transfer
+func (t *requestTiming) finish() {
+	t.mark(&t.done, false)
+}
+
+func (t *requestTiming) mark(field *time.Time, firstOnly bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if firstOnly && !field.IsZero() {
+		return
+	}
+	*field = time.Now()
+}
+
+// breakdown returns DNS, connect, TLS, time-to-first-byte and transfer durations in microseconds
+func (t *requestTiming) breakdown() (dns, connect, tlsTime, ttfb, transfer int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dns = between(t.dnsStart, t.dnsDone)
+	connect = between(t.connectStart, t.connectDone)
+	tlsTime = between(t.tlsStart, t.tlsDone)
+	sent := t.wroteRequest
+	if sent.IsZero() {
+		sent = t.start
+	}
+	ttfb = between(sent, t.firstByte)
+	transfer = between(t.firstByte, t.done)
+	return
+}
+
+func between(from, to time.Time) int64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from).Microseconds()
+}
@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// isWebSocketUpgrade reports whether the request asks to switch to the WebSocket protocol
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acquireWebSocket reserves one of a collection's WebSocket connections. It returns a
+// function releasing it, or false when the collection is at its limit (limit <= 0 means
+// unlimited).
+func (pm *ProxyManager) acquireWebSocket(collectionID string, limit int) (func(), bool) {
+	v, _ := pm.webSockets.LoadOrStore(collectionID, new(atomic.Int64))
+	open := v.(*atomic.Int64)
+	if n := open.Add(1); limit > 0 && n > int64(limit) {
+		open.Add(-1)
+		return nil, false
+	}
+	return func() { open.Add(-1) }, true
+}
+
+// webSocketSession tracks a proxied WebSocket connection: the bytes and data messages
+// passing each way and the idle and maximum duration timers that close it
+type webSocketSession struct {
+	idleTimeout time.Duration
+	maxDuration time.Duration
+
+	mu         sync.Mutex
+	client     net.Conn
+	upstream   io.Closer
+	upgradedAt time.Time
+	idle       *time.Timer
+	deadline   *time.Timer
+	closed     bool
+	reason     string // Why the gateway closed the connection, empty when a peer closed it
+
+	sent     wsCounter // Client to upstream
+	received wsCounter // Upstream to client
+}
+
+func newWebSocketSession(idleTimeout, maxDuration time.Duration) *webSocketSession {
+	return &webSocketSession{idleTimeout: idleTimeout, maxDuration: maxDuration}
+}
+
+// transport wraps the upstream transport so the upgraded upstream connection is counted
+func (s *webSocketSession) transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+			return resp, err
+		}
+		if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+			s.mu.Lock()
+			s.upstream = conn
+			s.mu.Unlock()
+			resp.Body = &wsUpstreamConn{ReadWriteCloser: conn, session: s}
+		}
+		return resp, nil
+	})
+}
+
+// hijacked starts the session on the client connection taken over for the upgrade and
+// returns it wrapped for counting
+func (s *webSocketSession) hijacked(conn net.Conn) net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Deadlines set by the server for the request must not cut the connection short
+	conn.SetDeadline(time.Time{})
+	s.client = conn
+	s.upgradedAt = time.Now()
+	if s.idleTimeout > 0 {
+		s.idle = time.AfterFunc(s.idleTimeout, func() { s.close("idle timeout") })
+	}
+	if s.maxDuration > 0 {
+		s.deadline = time.AfterFunc(s.maxDuration, func() { s.close("max duration") })
+	}
+	return &wsClientConn{Conn: conn, session: s}
+}
+
+// upgraded reports whether the connection was switched to WebSocket
+func (s *webSocketSession) upgraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client != nil
+}
+
+// activity postpones the idle timeout
+func (s *webSocketSession) activity() {
+	if s.idle != nil {
+		s.idle.Reset(s.idleTimeout)
+	}
+}
+
+// close ends the connection on both sides, which stops the reverse proxy's copy loops
+func (s *webSocketSession) close(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.reason = reason
+	if s.client != nil {
+		s.client.Close()
+	}
+	if s.upstream != nil {
+		s.upstream.Close()
+	}
+}
+
+// finish stops the timers once the connection has ended and returns why the gateway
+// closed it, if it did
+func (s *webSocketSession) finish() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	if s.deadline != nil {
+		s.deadline.Stop()
+	}
+	return s.reason
+}
+
+// wsClientConn counts what the client sends
+type wsClientConn struct {
+	net.Conn
+	session *webSocketSession
+}
+
+func (c *wsClientConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.session.sent.observe(p[:n])
+		c.session.activity()
+	}
+	return n, err
+}
+
+// wsUpstreamConn counts what the upstream sends
+type wsUpstreamConn struct {
+	io.ReadWriteCloser
+	session *webSocketSession
+}
+
+func (c *wsUpstreamConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.session.received.observe(p[:n])
+		c.session.activity()
+	}
+	return n, err
+}
+
+// wsCounter counts the bytes and data messages of one direction of a WebSocket
+// connection by following the frame headers in the byte stream (RFC 6455 section 5.2).
+// A message is counted when its final text, binary or continuation frame begins;
+// control frames are not counted.
+type wsCounter struct {
+	bytes    atomic.Int64
+	messages atomic.Int64
+
+	header  []byte // Partial frame header
+	payload uint64 // Payload bytes of the current frame still to skip
+}
+
+// observe follows the bytes read from one side. Each direction is read by a single
+// goroutine; only the totals are read concurrently.
+func (c *wsCounter) observe(p []byte) {
+	c.bytes.Add(int64(len(p)))
+	for len(p) > 0 {
+		if c.payload > 0 {
+			skip := min(c.payload, uint64(len(p)))
+			c.payload -= skip
+			p = p[skip:]
+			continue
+		}
+
+		c.header = append(c.header, p[0])
+		p = p[1:]
+		size, ok := wsHeaderSize(c.header)
+		if !ok || len(c.header) < size {
+			continue
+		}
+
+		fin, opcode := c.header[0]&0x80 != 0, c.header[0]&0x0f
+		if fin && opcode <= 0x2 {
+			c.messages.Add(1)
+		}
+		c.payload = wsPayloadLength(c.header)
+		c.header = c.header[:0]
+	}
+}
+
+// wsHeaderSize returns the length of a frame header once enough of it is known to tell
+func wsHeaderSize(h []byte) (int, bool) {
+	if len(h) < 2 {
+		return 0, false
+	}
+	size := 2
+	switch h[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if h[1]&0x80 != 0 {
+		size += 4 // Masking key
+	}
+	return size, true
+}
+
+// wsPayloadLength decodes the payload length of a complete frame header
+func wsPayloadLength(h []byte) uint64 {
+	switch n := h[1] & 0x7f; n {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(h[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(h[2:10])
+	default:
+		return uint64(n)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
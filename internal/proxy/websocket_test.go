@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+)
+
+// Frame opcodes used by the tests
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+)
+
+// writeWSFrame writes a single final frame, masked as clients must
+func writeWSFrame(w io.Writer, opcode byte, payload []byte, masked bool) error {
+	frame := []byte{0x80 | opcode}
+	lengthByte := byte(0)
+	if masked {
+		lengthByte = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, lengthByte|byte(len(payload)))
+	default:
+		frame = append(frame, lengthByte|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	if masked {
+		key := []byte{1, 2, 3, 4}
+		frame = append(frame, key...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWSFrame reads a single frame and unmasks its payload
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	length := uint64(h[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var key [4]byte
+	masked := h[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return h[0] & 0x0f, payload, nil
+}
+
+// echoWebSocketUpstream accepts WebSocket upgrades and echoes every text message
+func echoWebSocketUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		for {
+			opcode, payload, err := readWSFrame(brw.Reader)
+			if err != nil {
+				return
+			}
+			if opcode == wsClose {
+				writeWSFrame(conn, wsClose, payload, false)
+				return
+			}
+			writeWSFrame(conn, opcode, payload, false)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialWebSocket opens a WebSocket connection through the gateway and returns the
+// handshake response status with the connection. Early bytes are sent in the same
+// write as the handshake request.
+func dialWebSocket(t *testing.T, gatewayURL, path string, early ...byte) (int, net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gatewayURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	handshake := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", path)
+	conn.Write(append([]byte(handshake), early...))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+	}
+	return resp.StatusCode, conn, r
+}
+
+func TestWebSocketProxyLogsConnection(t *testing.T) {
+	upstream := echoWebSocketUpstream(t)
+	g := newTestGateway(t)
+	coll := g.addCollection(t, "ws", upstream.URL, func(c *database.Collection) { c.LogEnabled = true })
+	gateway := httptest.NewServer(g.router)
+	defer gateway.Close()
+
+	// The first message follows the handshake immediately, so the gateway has already
+	// buffered it when the connection is upgraded
+	var first bytes.Buffer
+	writeWSFrame(&first, wsText, []byte("one"), true)
+	status, conn, r := dialWebSocket(t, gateway.URL, "/proxy/ws/socket", first.Bytes()...)
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d", status)
+	}
+	for i, msg := range []string{"one", "two", strings.Repeat("x", 300)} {
+		if i > 0 {
+			if err := writeWSFrame(conn, wsText, []byte(msg), true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, payload, err := readWSFrame(r); err != nil || string(payload) != msg {
+			t.Fatalf("echo of %q: %q, %v", msg, payload, err)
+		}
+	}
+	writeWSFrame(conn, wsClose, []byte{0x03, 0xe8}, true)
+	if opcode, _, err := readWSFrame(r); err != nil || opcode != wsClose {
+		t.Fatalf("close reply: opcode %d, %v", opcode, err)
+	}
+	conn.Close()
+
+	var entry database.RequestLog
+	deadline := time.Now().Add(2 * time.Second)
+	for g.db.Where("collection_id = ?", coll.ID).First(&entry).Error != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("connection was not logged")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if entry.Status != http.StatusSwitchingProtocols || entry.MessagesSent != 3 || entry.MessagesReceived != 3 {
+		t.Fatalf("log: status %d, sent %d, received %d messages", entry.Status, entry.MessagesSent, entry.MessagesReceived)
+	}
+	// Client frames carry a 4-byte masking key the echoed frames lack
+	if entry.RequestSize != entry.ResponseSize+4*4 || entry.ResponseSize < 300 {
+		t.Fatalf("log: request size %d, response size %d", entry.RequestSize, entry.ResponseSize)
+	}
+}
+
+func TestWebSocketConnectionLimit(t *testing.T) {
+	upstream := echoWebSocketUpstream(t)
+	g := newTestGateway(t)
+	g.addCollection(t, "ws", upstream.URL, func(c *database.Collection) { c.MaxWebSocketConnections = 1 })
+	gateway := httptest.NewServer(g.router)
+	defer gateway.Close()
+
+	status, first, _ := dialWebSocket(t, gateway.URL, "/proxy/ws/socket")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("first connection: status %d", status)
+	}
+	if status, _, _ := dialWebSocket(t, gateway.URL, "/proxy/ws/socket"); status != http.StatusServiceUnavailable {
+		t.Fatalf("second connection: status %d, want 503", status)
+	}
+
+	// Closing the first connection frees its slot
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, _, _ := dialWebSocket(t, gateway.URL, "/proxy/ws/socket")
+		if status == http.StatusSwitchingProtocols {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection after close: status %d", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWebSocketIdleTimeout(t *testing.T) {
+	upstream := echoWebSocketUpstream(t)
+	g := newTestGatewayWithConfig(t, config.ProxyConfig{WebSocketIdleTimeout: 100 * time.Millisecond})
+	g.addCollection(t, "ws", upstream.URL, nil)
+	gateway := httptest.NewServer(g.router)
+	defer gateway.Close()
+
+	status, conn, r := dialWebSocket(t, gateway.URL, "/proxy/ws/socket")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d", status)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := readWSFrame(r); err != io.EOF {
+		t.Fatalf("idle connection read: %v, want EOF", err)
+	}
+}
+
+func TestWSCounterFollowsSplitFrames(t *testing.T) {
+	var stream []byte
+	// A fragmented message: text frame without FIN, then a final continuation frame
+	stream = append(stream, 0x01, 0x83, 0, 0, 0, 0, 'a', 'b', 'c')
+	stream = append(stream, 0x80, 0x82, 0, 0, 0, 0, 'd', 'e')
+	// A ping, which is not a message
+	stream = append(stream, 0x89, 0x80, 0, 0, 0, 0)
+	// A message with a 16-bit length
+	stream = append(stream, 0x82, 0x80|126, 0x01, 0x00, 0, 0, 0, 0)
+	stream = append(stream, make([]byte, 256)...)
+
+	var c wsCounter
+	for i := 0; i < len(stream); i += 3 {
+		c.observe(stream[i:min(i+3, len(stream))])
+	}
+	if c.messages.Load() != 2 || c.bytes.Load() != int64(len(stream)) {
+		t.Fatalf("counted %d messages and %d bytes, want 2 and %d", c.messages.Load(), c.bytes.Load(), len(stream))
+	}
+}
@@ -0,0 +1,225 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/jsonpath"
+)
+
+// DefaultMask is used when no mask value is configured
+const DefaultMask = "[REDACTED]"
+
+// Redactor masks sensitive data in request logs before they are persisted
+type Redactor struct {
+	headers     map[string]bool
+	bodyPaths   []jsonpath.Path
+	queryParams []*regexp.Regexp
+	maxBodySize int
+	mask        string
+}
+
+// NewRedactor creates a redactor from configuration
+func NewRedactor(cfg *config.RedactConfig) (*Redactor, error) {
+	r := &Redactor{
+		headers:     make(map[string]bool),
+		maxBodySize: cfg.MaxBodySize,
+		mask:        cfg.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultMask
+	}
+
+	for _, h := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+	}
+
+	for _, p := range cfg.BodyPaths {
+		path, err := jsonpath.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body path %q: %v", p, err)
+		}
+		r.bodyPaths = append(r.bodyPaths, path)
+	}
+
+	for _, expr := range cfg.QueryParams {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter pattern %q: %w", expr, err)
+		}
+		r.queryParams = append(r.queryParams, re)
+	}
+
+	return r, nil
+}
+
+// Headers returns a copy of the headers with deny-listed values masked
+func (r *Redactor) Headers(h http.Header) http.Header {
+	if r == nil || h == nil {
+		return h
+	}
+	out := make(http.Header, len(h))
+	for k, values := range h {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = r.mask
+			}
+			out[k] = masked
+			continue
+		}
+		out[k] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// Query returns a copy of the query values with matching parameters masked
+func (r *Redactor) Query(values url.Values) url.Values {
+	if r == nil || values == nil {
+		return values
+	}
+	out := make(url.Values, len(values))
+	for k, v := range values {
+		if r.matchQueryParam(k) {
+			masked := make([]string, len(v))
+			for i := range masked {
+				masked[i] = r.mask
+			}
+			out[k] = masked
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+// URL masks matching query parameters in a raw URL
+func (r *Redactor) URL(rawURL string) string {
+	if r == nil || len(r.queryParams) == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = r.Query(query).Encode()
+	return u.String()
+}
+
+// Body masks configured JSON paths and truncates the body to the maximum stored size
+func (r *Redactor) Body(body []byte) string {
+	return r.BodyLimit(body, 0)
+}
+
+// BodyLimit is like Body but additionally caps the stored size at limit bytes when limit > 0
+func (r *Redactor) BodyLimit(body []byte, limit int) string {
+	if r == nil {
+		return truncate(body, limit)
+	}
+	if len(r.bodyPaths) > 0 && len(body) > 0 {
+		body = r.maskJSON(body)
+	}
+	if r.maxBodySize > 0 && (limit <= 0 || r.maxBodySize < limit) {
+		limit = r.maxBodySize
+	}
+	return truncate(body, limit)
+}
+
+func (r *Redactor) matchQueryParam(name string) bool {
+	for _, re := range r.queryParams {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskJSON applies the body path masks; non-JSON bodies are returned unchanged
+func (r *Redactor) maskJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return body
+	}
+
+	masked := false
+	for _, path := range r.bodyPaths {
+		if path.Replace(doc, r.mask) {
+			masked = true
+		}
+	}
+	if !masked {
+		return body
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// PartialBody stores the start of a body of total bytes that was only partly captured.
+// Body paths cannot be masked in a cut-off JSON document, so when any are configured
+// such a body is replaced by the mask. The result always ends with the truncation marker.
+func (r *Redactor) PartialBody(head []byte, total int64, limit int) string {
+	total = max(total, int64(len(head)))
+	if r == nil {
+		return cut(head, limit, total)
+	}
+	if len(r.bodyPaths) > 0 && looksLikeJSON(head) {
+		return fmt.Sprintf("%s...[truncated %d bytes]", r.mask, total)
+	}
+	if r.maxBodySize > 0 && (limit <= 0 || r.maxBodySize < limit) {
+		limit = r.maxBodySize
+	}
+	return cut(head, limit, total)
+}
+
+// looksLikeJSON reports whether a body starts like a JSON object or array
+func looksLikeJSON(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	return len(body) > 0 && (body[0] == '{' || body[0] == '[')
+}
+
+// truncate cuts the body at limit bytes on a UTF-8 boundary and appends a marker
+func truncate(body []byte, limit int) string {
+	if limit <= 0 || len(body) <= limit {
+		return string(body)
+	}
+	return cut(body, limit, int64(len(body)))
+}
+
+// cut keeps up to limit bytes of body (all of it when limit <= 0) on a UTF-8 boundary
+// and appends a marker counting the bytes of the total size that were left out
+func cut(body []byte, limit int, total int64) string {
+	n := len(body)
+	if limit > 0 && limit < n {
+		n = limit
+		for n > 0 && !utf8.RuneStart(body[n]) {
+			n--
+		}
+	} else {
+		// A captured prefix may itself end inside a rune
+		i := n
+		for i > 0 && n-i < utf8.UTFMax && !utf8.RuneStart(body[i-1]) {
+			i--
+		}
+		if i > 0 && !utf8.FullRune(body[i-1:]) {
+			n = i - 1
+		}
+	}
+	return fmt.Sprintf("%s...[truncated %d bytes]", body[:n], total-int64(n))
+}
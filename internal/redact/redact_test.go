@@ -0,0 +1,137 @@
+package redact
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/midgard/gateway/config"
+)
+
+func newTestRedactor(t *testing.T, cfg config.RedactConfig) *Redactor {
+	t.Helper()
+	r, err := NewRedactor(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestBodyMasksJSONPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"top-level key", "$.password", `{"user":"a","password":"p"}`, `{"password":"X","user":"a"}`},
+		{"nested key", "$.card.number", `{"card":{"number":"4111","exp":"12/30"}}`, `{"card":{"exp":"12/30","number":"X"}}`},
+		{"array index", "$.items[1].token", `{"items":[{"token":"a"},{"token":"b"}]}`, `{"items":[{"token":"a"},{"token":"X"}]}`},
+		{"nested arrays", "$.orders[*].items[*].card",
+			`{"orders":[{"items":[{"card":"1"},{"card":"2"}]},{"items":[{"card":"3","qty":1}]}]}`,
+			`{"orders":[{"items":[{"card":"X"},{"card":"X"}]},{"items":[{"card":"X","qty":1}]}]}`},
+		{"array of arrays", "$.matrix[*][0]", `{"matrix":[[1,2],[3,4]]}`, `{"matrix":[["X",2],["X",4]]}`},
+		{"wildcard key", "$.*.secret", `{"a":{"secret":1},"b":{"secret":2,"id":3}}`, `{"a":{"secret":"X"},"b":{"id":3,"secret":"X"}}`},
+		{"quoted key", "$['api-key']", `{"api-key":"k","id":1}`, `{"api-key":"X","id":1}`},
+		{"double-quoted key with dot", `$.headers["x.auth"]`, `{"headers":{"x.auth":"t","x":{"auth":"u"}}}`, `{"headers":{"x":{"auth":"u"},"x.auth":"X"}}`},
+		{"root array", "$[*].pin", `[{"pin":"1"},{"pin":"2"}]`, `[{"pin":"X"},{"pin":"X"}]`},
+		{"large numbers keep their precision", "$.pin", `{"id":12345678901234567890,"pin":1}`, `{"id":12345678901234567890,"pin":"X"}`},
+		{"no match keeps the original bytes", "$.password", `{ "user": "a" }`, `{ "user": "a" }`},
+		{"index on an object", "$.card[0]", `{"card":{"0":"a"}}`, `{"card":{"0":"a"}}`},
+		{"not JSON", "$.password", `password=p`, `password=p`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRedactor(t, config.RedactConfig{BodyPaths: []string{tt.path}, Mask: "X"})
+			if got := r.Body([]byte(tt.body)); got != tt.want {
+				t.Fatalf("Body(%s) with %s = %s, want %s", tt.body, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRedactorRejectsInvalidPaths(t *testing.T) {
+	for _, path := range []string{"password", "$.", "$.a..b", "$.items[0", "$items"} {
+		if _, err := NewRedactor(&config.RedactConfig{BodyPaths: []string{path}}); err == nil {
+			t.Errorf("path %q accepted", path)
+		}
+	}
+}
+
+func TestBodyLimitTruncatesOnRuneBoundaries(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		limit int
+		want  string
+	}{
+		{"within limit", "héllo", 6, "héllo"},
+		{"no limit", "héllo", 0, "héllo"},
+		{"ASCII cut", "hello", 3, "hel...[truncated 2 bytes]"},
+		{"inside a 2-byte rune", "héllo", 2, "h...[truncated 5 bytes]"},
+		{"after a 2-byte rune", "héllo", 3, "hé...[truncated 3 bytes]"},
+		{"inside a 4-byte rune", "a😀b", 4, "a...[truncated 5 bytes]"},
+		{"before a 4-byte rune", "a😀b", 1, "a...[truncated 5 bytes]"},
+		{"after a 4-byte rune", "a😀b", 5, "a😀...[truncated 1 bytes]"},
+		{"inside the first rune", "😀", 3, "...[truncated 4 bytes]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRedactor(t, config.RedactConfig{})
+			if got := r.BodyLimit([]byte(tt.body), tt.limit); got != tt.want {
+				t.Fatalf("BodyLimit(%q, %d) = %q, want %q", tt.body, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyLimitUsesTheSmallerLimit(t *testing.T) {
+	r := newTestRedactor(t, config.RedactConfig{MaxBodySize: 4})
+	if got := r.BodyLimit([]byte("abcdefgh"), 6); got != "abcd...[truncated 4 bytes]" {
+		t.Fatalf("configured limit: %q", got)
+	}
+	if got := r.BodyLimit([]byte("abcdefgh"), 2); got != "ab...[truncated 6 bytes]" {
+		t.Fatalf("caller limit: %q", got)
+	}
+	// Masking happens before truncation so a cut cannot expose part of a secret
+	r = newTestRedactor(t, config.RedactConfig{BodyPaths: []string{"$.pin"}, Mask: "X", MaxBodySize: 11})
+	if got := r.Body([]byte(`{"pin":"123456"}`)); got != `{"pin":"X"}` {
+		t.Fatalf("masked body: %q", got)
+	}
+}
+
+func TestHeadersAndQueryMasking(t *testing.T) {
+	r := newTestRedactor(t, config.RedactConfig{Headers: []string{"authorization"}, QueryParams: []string{"(?i)token"}})
+	h := r.Headers(http.Header{"Authorization": {"Bearer x"}, "Accept": {"*/*"}})
+	if h.Get("Authorization") != DefaultMask || h.Get("Accept") != "*/*" {
+		t.Fatalf("headers: %v", h)
+	}
+	if got := r.URL("/items?accessToken=abc&page=2"); got != "/items?accessToken=%5BREDACTED%5D&page=2" {
+		t.Fatalf("URL: %q", got)
+	}
+}
+
+func TestPartialBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.RedactConfig
+		head  string
+		total int64
+		limit int
+		want  string
+	}{
+		{"marked at the capture limit", config.RedactConfig{}, "abcd", 10, 0, "abcd...[truncated 6 bytes]"},
+		{"caller limit", config.RedactConfig{}, "abcd", 10, 2, "ab...[truncated 8 bytes]"},
+		{"configured limit", config.RedactConfig{MaxBodySize: 3}, "abcd", 10, 0, "abc...[truncated 7 bytes]"},
+		{"captured inside a rune", config.RedactConfig{}, "hé"[:2], 10, 0, "h...[truncated 9 bytes]"},
+		{"JSON with body paths", config.RedactConfig{BodyPaths: []string{"$.pin"}}, ` {"pin":"1234`, 40, 0, "[REDACTED]...[truncated 40 bytes]"},
+		{"other bodies with body paths", config.RedactConfig{BodyPaths: []string{"$.pin"}}, "pin=1234", 40, 0, "pin=1234...[truncated 32 bytes]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRedactor(t, tt.cfg)
+			if got := r.PartialBody([]byte(tt.head), tt.total, tt.limit); got != tt.want {
+				t.Fatalf("PartialBody(%q, %d, %d) = %q, want %q", tt.head, tt.total, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package requestid
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Header is the header used to carry the request ID
+const Header = "X-Request-ID"
+
+// contextKey is the gin context key holding the request ID
+const contextKey = "request_id"
+
+// maxLength bounds accepted incoming IDs so clients cannot inject huge values into logs
+const maxLength = 128
+
+// Middleware accepts a valid incoming X-Request-ID or generates a new one,
+// stores it in the context and echoes it in the response
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !isValid(id) {
+			id = uuid.New().String()
+		}
+		c.Set(contextKey, id)
+		c.Request.Header.Set(Header, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the request ID stored by Middleware, or "" if none
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// LogFormatter is gin's default access log format with the request ID appended
+func LogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v | request_id=%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		param.Request.Header.Get(Header),
+		param.ErrorMessage,
+	)
+}
+
+// isValid accepts non-empty printable ASCII IDs up to maxLength characters
+func isValid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,309 @@
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// Manager runs the background job that expires old request logs
+type Manager struct {
+	db       *gorm.DB
+	cfg      config.RetentionConfig
+	mu       sync.Mutex
+	runMu    sync.Mutex
+	status   Status
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// Status reports the configuration and outcome of the retention job
+type Status struct {
+	Enabled         bool      `json:"enabled"`
+	MaxAgeDays      int       `json:"max_age_days"`
+	MaxTotal        int       `json:"max_total"`
+	Archive         bool      `json:"archive"`
+	ArchiveDir      string    `json:"archive_dir,omitempty"`
+	Interval        string    `json:"interval"`
+	Running         bool      `json:"running"`
+	LastRun         time.Time `json:"last_run,omitempty"`
+	LastDuration    int64     `json:"last_duration"` // in milliseconds
+	LastDeleted     int64     `json:"last_deleted"`
+	LastArchived    int64     `json:"last_archived"`
+	LastArchiveFile string    `json:"last_archive_file,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+	NextRun         time.Time `json:"next_run,omitempty"`
+	TotalDeleted    int64     `json:"total_deleted"`
+}
+
+// NewManager creates a retention manager
+func NewManager(db *gorm.DB, cfg config.RetentionConfig) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = "archive"
+	}
+
+	m := &Manager{
+		db:       db,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+	m.status = Status{
+		Enabled:    m.Enabled(),
+		MaxAgeDays: cfg.MaxAgeDays,
+		MaxTotal:   cfg.MaxTotal,
+		Archive:    cfg.Archive,
+		Interval:   cfg.Interval.String(),
+	}
+	if cfg.Archive {
+		m.status.ArchiveDir = cfg.ArchiveDir
+	}
+	return m
+}
+
+// Enabled reports whether any retention rule is configured
+func (m *Manager) Enabled() bool {
+	return m.cfg.MaxAgeDays > 0 || m.cfg.MaxTotal > 0
+}
+
+// Start starts the background retention job
+func (m *Manager) Start() {
+	if !m.Enabled() {
+		log.Println("Log retention disabled (no max_age_days or max_total configured)")
+		return
+	}
+	log.Printf("Log retention enabled: max_age_days=%d max_total=%d archive=%v interval=%s",
+		m.cfg.MaxAgeDays, m.cfg.MaxTotal, m.cfg.Archive, m.cfg.Interval)
+	go m.run()
+}
+
+// Stop stops the background retention job
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+	})
+}
+
+// Status returns a snapshot of the retention job status
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// run runs the retention loop
+func (m *Manager) run() {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	// Initial run
+	m.setNextRun(time.Now().Add(m.cfg.Interval))
+	m.RunOnce()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.setNextRun(time.Now().Add(m.cfg.Interval))
+			m.RunOnce()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+func (m *Manager) setNextRun(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.NextRun = t
+}
+
+// RunOnce expires logs according to the configured rules.
+// Concurrent calls are serialized so a manual run never overlaps the scheduled one.
+func (m *Manager) RunOnce() error {
+	if !m.Enabled() {
+		return fmt.Errorf("log retention is not configured")
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	m.mu.Lock()
+	m.status.Running = true
+	m.mu.Unlock()
+
+	start := time.Now()
+	deleted, archived, archiveFile, err := m.expire()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Running = false
+	m.status.LastRun = start
+	m.status.LastDuration = time.Since(start).Milliseconds()
+	m.status.LastDeleted = deleted
+	m.status.LastArchived = archived
+	m.status.LastArchiveFile = archiveFile
+	m.status.TotalDeleted += deleted
+	m.status.LastError = ""
+	if err != nil {
+		m.status.LastError = err.Error()
+		log.Printf("Log retention run failed after deleting %d logs: %v", deleted, err)
+	} else if deleted > 0 {
+		log.Printf("Log retention removed %d logs (archived %d)", deleted, archived)
+	}
+	return err
+}
+
+// expire archives and deletes expired logs in batches
+func (m *Manager) expire() (deleted, archived int64, archiveFile string, err error) {
+	query, ok, err := m.expiredQuery()
+	if err != nil || !ok {
+		return 0, 0, "", err
+	}
+
+	var archive *archiveWriter
+	defer func() {
+		if archive != nil {
+			if closeErr := archive.close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	for {
+		var batch []database.RequestLog
+		if err := query(m.db.Model(&database.RequestLog{})).Order("id ASC").Limit(m.cfg.BatchSize).Find(&batch).Error; err != nil {
+			return deleted, archived, archiveFile, err
+		}
+		if len(batch) == 0 {
+			return deleted, archived, archiveFile, nil
+		}
+
+		// Archived rows are flushed to disk before they are deleted
+		if m.cfg.Archive {
+			if archive == nil {
+				archive, err = newArchiveWriter(m.cfg.ArchiveDir)
+				if err != nil {
+					return deleted, archived, archiveFile, err
+				}
+				archiveFile = archive.path
+			}
+			if err := archive.write(batch); err != nil {
+				return deleted, archived, archiveFile, err
+			}
+			archived += int64(len(batch))
+		}
+
+		ids := make([]uint, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].ID
+		}
+		result := m.db.Where("id IN ?", ids).Delete(&database.RequestLog{})
+		if result.Error != nil {
+			return deleted, archived, archiveFile, result.Error
+		}
+		deleted += result.RowsAffected
+
+		if len(batch) < m.cfg.BatchSize {
+			return deleted, archived, archiveFile, nil
+		}
+	}
+}
+
+// expiredQuery builds the condition selecting logs past their age limit or beyond the global cap.
+// It returns false when nothing is expired.
+func (m *Manager) expiredQuery() (func(*gorm.DB) *gorm.DB, bool, error) {
+	var cutoff time.Time
+	if m.cfg.MaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -m.cfg.MaxAgeDays)
+	}
+
+	// For the global cap, find the newest id that falls outside the most recent MaxTotal rows
+	var capID uint
+	if m.cfg.MaxTotal > 0 {
+		var ids []uint
+		if err := m.db.Model(&database.RequestLog{}).Order("id DESC").Offset(m.cfg.MaxTotal).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return nil, false, err
+		}
+		if len(ids) > 0 {
+			capID = ids[0]
+		}
+	}
+
+	switch {
+	case !cutoff.IsZero() && capID > 0:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("(timestamp < ? OR id <= ?)", cutoff, capID)
+		}, true, nil
+	case !cutoff.IsZero():
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("timestamp < ?", cutoff)
+		}, true, nil
+	case capID > 0:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("id <= ?", capID)
+		}, true, nil
+	}
+	return nil, false, nil
+}
+
+// archiveWriter writes request logs to a gzip-compressed NDJSON file
+type archiveWriter struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func newArchiveWriter(dir string) (*archiveWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	// Each run gets a new file, even when runs start within the same second
+	file, err := os.CreateTemp(dir, fmt.Sprintf("request_logs-%s-*.ndjson.gz", time.Now().Format("20060102-150405")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	gz := gzip.NewWriter(file)
+	return &archiveWriter{path: file.Name(), file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// write appends a batch and syncs it to disk
+func (a *archiveWriter) write(batch []database.RequestLog) error {
+	for i := range batch {
+		if err := a.enc.Encode(&batch[i]); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	return nil
+}
+
+func (a *archiveWriter) close() error {
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,207 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "retention.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return db
+}
+
+// addLogs stores one log per age, in order, and returns their IDs
+func addLogs(t *testing.T, db *gorm.DB, ages ...time.Duration) []uint {
+	t.Helper()
+	now := time.Now()
+	ids := make([]uint, len(ages))
+	for i, age := range ages {
+		entry := &database.RequestLog{
+			CollectionID: "c1",
+			Path:         "/items",
+			Method:       "GET",
+			Status:       200,
+			Timestamp:    now.Add(-age).Round(0),
+		}
+		if err := db.Create(entry).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+func remainingIDs(t *testing.T, db *gorm.DB) []uint {
+	t.Helper()
+	var ids []uint
+	if err := db.Model(&database.RequestLog{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// archivedIDs reads the IDs of the logs in a gzip NDJSON archive
+func archivedIDs(t *testing.T, path string) []uint {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var entry database.RequestLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+const day = 24 * time.Hour
+
+func TestExpire(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.RetentionConfig
+		ages      []time.Duration
+		remaining []int // Indexes into ages of the logs that are kept
+	}{
+		{
+			name:      "age limit",
+			cfg:       config.RetentionConfig{MaxAgeDays: 7},
+			ages:      []time.Duration{10 * day, time.Hour, 8 * day, 6 * day, 0},
+			remaining: []int{1, 3, 4},
+		},
+		{
+			name:      "row cap",
+			cfg:       config.RetentionConfig{MaxTotal: 2},
+			ages:      []time.Duration{0, 0, 0, 0, 0},
+			remaining: []int{3, 4},
+		},
+		{
+			name: "age limit and row cap",
+			cfg:  config.RetentionConfig{MaxAgeDays: 7, MaxTotal: 3},
+			// The newest three rows are capped by count, and one of them is also too old
+			ages:      []time.Duration{time.Hour, time.Hour, 2 * time.Hour, 8 * day, 0},
+			remaining: []int{2, 4},
+		},
+		{
+			name:      "nothing expired",
+			cfg:       config.RetentionConfig{MaxAgeDays: 7, MaxTotal: 10},
+			ages:      []time.Duration{time.Hour, 0},
+			remaining: []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			ids := addLogs(t, db, tt.ages...)
+			var want, expired []uint
+			for i, id := range ids {
+				if slices.Contains(tt.remaining, i) {
+					want = append(want, id)
+				} else {
+					expired = append(expired, id)
+				}
+			}
+
+			// A batch size below the number of expired rows exercises batching
+			tt.cfg.BatchSize = 1
+			tt.cfg.Archive = true
+			tt.cfg.ArchiveDir = t.TempDir()
+			m := NewManager(db, tt.cfg)
+			if err := m.RunOnce(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := remainingIDs(t, db); !slices.Equal(got, want) {
+				t.Fatalf("remaining logs %v, want %v", got, want)
+			}
+			status := m.Status()
+			if status.LastDeleted != int64(len(expired)) || status.LastArchived != int64(len(expired)) {
+				t.Fatalf("deleted %d, archived %d, want %d", status.LastDeleted, status.LastArchived, len(expired))
+			}
+			if len(expired) == 0 {
+				if status.LastArchiveFile != "" {
+					t.Fatalf("archive %s created with nothing expired", status.LastArchiveFile)
+				}
+				return
+			}
+			if got := archivedIDs(t, status.LastArchiveFile); !slices.Equal(got, expired) {
+				t.Fatalf("archived logs %v, want %v", got, expired)
+			}
+		})
+	}
+}
+
+func TestExpireKeepsLogsWhenArchiveFails(t *testing.T) {
+	db := newTestDB(t)
+	ids := addLogs(t, db, 10*day, 9*day)
+	// The archive directory cannot be created below a regular file
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(db, config.RetentionConfig{MaxAgeDays: 7, Archive: true, ArchiveDir: filepath.Join(blocker, "archive")})
+	if err := m.RunOnce(); err == nil {
+		t.Fatal("run succeeded without an archive")
+	}
+	if got := remainingIDs(t, db); !slices.Equal(got, ids) {
+		t.Fatalf("remaining logs %v, want %v", got, ids)
+	}
+}
+
+func TestEachRunWritesItsOwnArchive(t *testing.T) {
+	db := newTestDB(t)
+	m := NewManager(db, config.RetentionConfig{MaxAgeDays: 7, Archive: true, ArchiveDir: t.TempDir()})
+
+	first := addLogs(t, db, 10*day)
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	firstFile := m.Status().LastArchiveFile
+	second := addLogs(t, db, 10*day)
+	if err := m.RunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	secondFile := m.Status().LastArchiveFile
+
+	// Both runs usually start within the same second
+	if firstFile == secondFile {
+		t.Fatalf("both runs archived to %s", firstFile)
+	}
+	if got := archivedIDs(t, firstFile); !slices.Equal(got, first) {
+		t.Fatalf("first archive has logs %v, want %v", got, first)
+	}
+	if got := archivedIDs(t, secondFile); !slices.Equal(got, second) {
+		t.Fatalf("second archive has logs %v, want %v", got, second)
+	}
+}
@@ -0,0 +1,337 @@
+package slo
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/midgard/gateway/internal/alert"
+	"github.com/midgard/gateway/internal/analytics"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+// SLO types
+const (
+	TypeAvailability = "availability"
+	TypeLatency      = "latency"
+)
+
+// RuleName is the alert rule name used for burn-rate alerts
+const RuleName = "slo_burn_rate"
+
+// BurnRateRule fires when both the long and the short window burn the error budget
+// fast enough to spend BudgetSpent of it within the long window. The short window
+// makes the alert reset quickly once the problem stops.
+type BurnRateRule struct {
+	Name        string
+	Severity    string
+	Long        time.Duration
+	Short       time.Duration
+	BudgetSpent float64 // Fraction of the SLO window's error budget
+}
+
+// Threshold returns the burn rate at which the rule fires for an SLO window of
+// windowDays: spending BudgetSpent of the budget in Long means burning it
+// BudgetSpent * window / Long times faster than the window allows
+func (r BurnRateRule) Threshold(windowDays int) float64 {
+	window := time.Duration(windowDays) * 24 * time.Hour
+	return r.BudgetSpent * float64(window) / float64(r.Long)
+}
+
+// MarshalJSON renders windows as e.g. "1h" instead of nanoseconds
+func (r BurnRateRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"name":         r.Name,
+		"severity":     r.Severity,
+		"long":         formatWindow(r.Long),
+		"short":        formatWindow(r.Short),
+		"budget_spent": r.BudgetSpent,
+	})
+}
+
+// BurnRateRules are the multi-window rules from the SRE workbook: 2% of the budget
+// spent in 1 hour pages, 5% spent in 6 hours raises a ticket. For a 30 day window
+// these are burn rates of 14.4 and 6.
+var BurnRateRules = []BurnRateRule{
+	{Name: "page", Severity: alert.SeverityCritical, Long: time.Hour, Short: 5 * time.Minute, BudgetSpent: 0.02},
+	{Name: "ticket", Severity: alert.SeverityWarning, Long: 6 * time.Hour, Short: 30 * time.Minute, BudgetSpent: 0.05},
+}
+
+// Status is the latest evaluation of one SLO
+type Status struct {
+	SLO                  database.SLO       `json:"slo"`
+	TotalRequests        int64              `json:"total_requests"`
+	BadRequests          float64            `json:"bad_requests"`
+	SLI                  float64            `json:"sli"` // Percentage of good requests over the SLO window
+	ErrorBudgetConsumed  float64            `json:"error_budget_consumed"`
+	ErrorBudgetRemaining float64            `json:"error_budget_remaining"`
+	BurnRates            map[string]float64 `json:"burn_rates"` // By window, e.g. "1h"
+	Thresholds           map[string]float64 `json:"thresholds"` // Burn rate at which each rule fires, by rule name
+	Firing               []string           `json:"firing"`     // Names of burn-rate rules currently firing
+	EvaluatedAt          time.Time          `json:"evaluated_at"`
+	Error                string             `json:"error,omitempty"`
+}
+
+// Evaluator periodically computes error budgets and burn rates for all enabled
+// SLOs from the analytics rollups and raises alerts through the alert manager
+type Evaluator struct {
+	db       *gorm.DB
+	alerts   *alert.Manager
+	interval time.Duration
+	mu       sync.Mutex
+	runMu    sync.Mutex
+	statuses map[uint]Status
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEvaluator creates an SLO evaluator
+func NewEvaluator(db *gorm.DB, alerts *alert.Manager, interval time.Duration) *Evaluator {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Evaluator{
+		db:       db,
+		alerts:   alerts,
+		interval: interval,
+		statuses: make(map[uint]Status),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start starts the background evaluation loop
+func (e *Evaluator) Start() {
+	go e.run()
+}
+
+// Stop stops the background evaluation loop
+func (e *Evaluator) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+	})
+}
+
+func (e *Evaluator) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	e.runLogged()
+	for {
+		select {
+		case <-ticker.C:
+			e.runLogged()
+		case <-e.stopChan:
+			return
+		}
+	}
+}
+
+func (e *Evaluator) runLogged() {
+	if err := e.RunOnce(); err != nil {
+		log.Printf("SLO evaluation failed: %v", err)
+	}
+}
+
+// RunOnce evaluates every enabled SLO and updates alerts
+func (e *Evaluator) RunOnce() error {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	var slos []database.SLO
+	if err := e.db.Where("enabled = ?", true).Find(&slos).Error; err != nil {
+		return err
+	}
+
+	statuses := make(map[uint]Status, len(slos))
+	for _, s := range slos {
+		status := e.evaluate(s)
+		statuses[s.ID] = status
+		e.updateAlerts(s, status)
+	}
+
+	// Resolve alerts of SLOs that were deleted or disabled since the last run
+	e.mu.Lock()
+	previous := e.statuses
+	e.statuses = statuses
+	e.mu.Unlock()
+	for id, status := range previous {
+		if _, ok := statuses[id]; !ok {
+			for _, rule := range BurnRateRules {
+				e.alerts.Resolve(alertKey(status.SLO.ID, rule))
+			}
+		}
+	}
+	return nil
+}
+
+// Statuses returns the latest evaluation of every enabled SLO ordered by ID
+func (e *Evaluator) Statuses() []Status {
+	e.mu.Lock()
+	statuses := make([]Status, 0, len(e.statuses))
+	for _, s := range e.statuses {
+		statuses = append(statuses, s)
+	}
+	e.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].SLO.ID < statuses[j].SLO.ID })
+	return statuses
+}
+
+// StatusOf returns the latest evaluation of one SLO
+func (e *Evaluator) StatusOf(id uint) (Status, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.statuses[id]
+	return s, ok
+}
+
+// evaluate computes the SLI, error budget and burn rates of one SLO
+func (e *Evaluator) evaluate(s database.SLO) Status {
+	now := time.Now()
+	status := Status{SLO: s, BurnRates: make(map[string]float64), Thresholds: make(map[string]float64), EvaluatedAt: now}
+	budget := 1 - s.Target/100
+
+	windowDays := s.WindowDays
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+	total, bad, err := e.events(s, now.AddDate(0, 0, -windowDays), now, analytics.Hour)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.TotalRequests = total
+	status.BadRequests = bad
+	status.SLI = 100
+	status.ErrorBudgetRemaining = 1
+	if total > 0 {
+		status.SLI = 100 * (1 - bad/float64(total))
+		status.ErrorBudgetConsumed = bad / float64(total) / budget
+		status.ErrorBudgetRemaining = 1 - status.ErrorBudgetConsumed
+	}
+
+	for _, rule := range BurnRateRules {
+		threshold := rule.Threshold(windowDays)
+		status.Thresholds[rule.Name] = threshold
+		firing := true
+		for _, window := range []time.Duration{rule.Long, rule.Short} {
+			label := formatWindow(window)
+			rate, ok := status.BurnRates[label]
+			if !ok {
+				total, bad, err := e.events(s, now.Add(-window), now, analytics.Minute)
+				if err != nil {
+					status.Error = err.Error()
+					return status
+				}
+				if total > 0 {
+					rate = bad / float64(total) / budget
+				}
+				status.BurnRates[label] = rate
+			}
+			if rate < threshold {
+				firing = false
+			}
+		}
+		if firing {
+			status.Firing = append(status.Firing, rule.Name)
+		}
+	}
+	return status
+}
+
+// events counts total and bad requests for an SLO between from and to
+func (e *Evaluator) events(s database.SLO, from, to time.Time, granularity string) (int64, float64, error) {
+	q := analytics.Query{CollectionID: s.CollectionID, From: from, To: to}
+	if s.EndpointID != nil {
+		q.EndpointID = *s.EndpointID
+	}
+	r, err := analytics.Aggregate(e.db, q, granularity)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s.Type == TypeLatency {
+		return analytics.Timed(r), analytics.SlowerThan(r, s.LatencyThreshold), nil
+	}
+	return r.RequestCount, float64(r.Status5xx), nil
+}
+
+// updateAlerts fires or resolves the burn-rate alerts of one SLO
+func (e *Evaluator) updateAlerts(s database.SLO, status Status) {
+	if status.Error != "" {
+		return
+	}
+	for _, rule := range BurnRateRules {
+		key := alertKey(s.ID, rule)
+		firing := false
+		for _, name := range status.Firing {
+			firing = firing || name == rule.Name
+		}
+		if !firing {
+			e.alerts.Resolve(key)
+			continue
+		}
+
+		rate := status.BurnRates[formatWindow(rule.Long)]
+		e.alerts.Fire(alert.Alert{
+			Key:      key,
+			Rule:     RuleName,
+			Severity: rule.Severity,
+			Summary:  fmt.Sprintf("SLO %q is burning its error budget %.1fx too fast", s.Name, rate),
+			Description: fmt.Sprintf("Burn rate over %s is %.1f and over %s is %.1f (threshold %.1f). %.1f%% of the %d day error budget remains.",
+				formatWindow(rule.Long), rate, formatWindow(rule.Short), status.BurnRates[formatWindow(rule.Short)],
+				status.Thresholds[rule.Name], 100*status.ErrorBudgetRemaining, s.WindowDays),
+			Labels: map[string]string{
+				"slo":           s.Name,
+				"slo_id":        fmt.Sprint(s.ID),
+				"collection_id": s.CollectionID,
+				"window":        rule.Name,
+			},
+			Value: rate,
+		})
+	}
+}
+
+func alertKey(id uint, rule BurnRateRule) string {
+	return fmt.Sprintf("slo:%d:%s", id, rule.Name)
+}
+
+// formatWindow renders a window as e.g. "5m" or "6h"
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// Validate checks an SLO definition
+func Validate(s *database.SLO) error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.CollectionID == "" {
+		return fmt.Errorf("collection_id is required")
+	}
+	switch s.Type {
+	case TypeAvailability:
+	case TypeLatency:
+		if s.LatencyThreshold <= 0 {
+			return fmt.Errorf("latency_threshold must be positive for latency SLOs")
+		}
+	default:
+		return fmt.Errorf("type must be %q or %q", TypeAvailability, TypeLatency)
+	}
+	if s.Target <= 0 || s.Target >= 100 {
+		return fmt.Errorf("target must be a percentage between 0 and 100, e.g. 99.9")
+	}
+	if s.WindowDays <= 0 {
+		s.WindowDays = 30
+	}
+	if s.WindowDays > 90 {
+		return fmt.Errorf("window_days must be at most 90")
+	}
+	return nil
+}
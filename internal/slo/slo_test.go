@@ -0,0 +1,118 @@
+package slo
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midgard/gateway/config"
+	"github.com/midgard/gateway/internal/analytics"
+	"github.com/midgard/gateway/internal/database"
+	"gorm.io/gorm"
+)
+
+func TestBurnRateThresholdsScaleWithWindow(t *testing.T) {
+	tests := []struct {
+		windowDays   int
+		page, ticket float64
+	}{
+		{30, 14.4, 6},
+		{7, 3.36, 1.4},
+		{90, 43.2, 18},
+	}
+	for _, tt := range tests {
+		page, ticket := BurnRateRules[0].Threshold(tt.windowDays), BurnRateRules[1].Threshold(tt.windowDays)
+		if math.Abs(page-tt.page) > 1e-9 || math.Abs(ticket-tt.ticket) > 1e-9 {
+			t.Errorf("%d days: thresholds %v and %v, want %v and %v", tt.windowDays, page, ticket, tt.page, tt.ticket)
+		}
+	}
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.InitDatabase(&config.DatabaseConfig{
+		Type: "sqlite",
+		DSN:  filepath.Join(t.TempDir(), "slo.db"),
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	return db
+}
+
+// addRollups stores matching minute and hour rollups for the current time
+func addRollups(t *testing.T, db *gorm.DB, requests, errors int64, hist []int64, maxDuration int64) {
+	t.Helper()
+	data, _ := json.Marshal(hist)
+	now := time.Now()
+	for _, g := range []struct {
+		name  string
+		start time.Time
+	}{{analytics.Minute, now.Add(-2 * time.Minute).Truncate(time.Minute)}, {analytics.Hour, now.Truncate(time.Hour)}} {
+		r := database.RequestRollup{
+			CollectionID: "c1",
+			Granularity:  g.name,
+			BucketStart:  g.start,
+			Path:         "/items",
+			Method:       "GET",
+			RequestCount: requests,
+			Status2xx:    requests - errors,
+			Status5xx:    errors,
+			DurationMax:  maxDuration,
+			Histogram:    string(data),
+		}
+		if err := db.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEvaluateAvailabilityBurnRates(t *testing.T) {
+	db := newTestDB(t)
+	hist := make([]int64, len(analytics.LatencyBounds)+1)
+	hist[0] = 1000
+	// 2% errors against a 0.1% budget burn it 20 times too fast
+	addRollups(t, db, 1000, 20, hist, 5)
+	e := NewEvaluator(db, nil, time.Minute)
+
+	status := e.evaluate(database.SLO{CollectionID: "c1", Type: TypeAvailability, Target: 99.9, WindowDays: 30})
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if math.Abs(status.SLI-98) > 1e-9 || math.Abs(status.ErrorBudgetConsumed-20) > 1e-9 {
+		t.Fatalf("SLI %v, budget consumed %v", status.SLI, status.ErrorBudgetConsumed)
+	}
+	for _, window := range []string{"1h", "5m", "6h", "30m"} {
+		if math.Abs(status.BurnRates[window]-20) > 1e-9 {
+			t.Fatalf("burn rate over %s: %v", window, status.BurnRates[window])
+		}
+	}
+	if len(status.Firing) != 2 {
+		t.Fatalf("30 day window: firing %v, want page and ticket", status.Firing)
+	}
+
+	// The same burn rate spends a smaller share of a 90 day budget, so only the ticket fires
+	status = e.evaluate(database.SLO{CollectionID: "c1", Type: TypeAvailability, Target: 99.9, WindowDays: 90})
+	if len(status.Firing) != 1 || status.Firing[0] != "ticket" || math.Abs(status.Thresholds["page"]-43.2) > 1e-9 {
+		t.Fatalf("90 day window: firing %v, thresholds %v", status.Firing, status.Thresholds)
+	}
+}
+
+func TestEvaluateLatencyBurnRates(t *testing.T) {
+	db := newTestDB(t)
+	// 100 requests between 50 and 75 ms; with a 70 ms threshold a fifth of them are slow
+	hist := make([]int64, len(analytics.LatencyBounds)+1)
+	hist[4] = 100
+	addRollups(t, db, 100, 0, hist, 75)
+	e := NewEvaluator(db, nil, time.Minute)
+
+	status := e.evaluate(database.SLO{CollectionID: "c1", Type: TypeLatency, LatencyThreshold: 70, Target: 99, WindowDays: 30})
+	if status.Error != "" {
+		t.Fatal(status.Error)
+	}
+	if math.Abs(status.BadRequests-20) > 1e-9 || math.Abs(status.BurnRates["1h"]-20) > 1e-9 {
+		t.Fatalf("bad requests %v, burn rate %v", status.BadRequests, status.BurnRates["1h"])
+	}
+}
@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/midgard/gateway/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span kinds used by the gateway
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+// W3C Trace Context headers
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const instrumentationName = "github.com/midgard/gateway/internal/tracing"
+
+var propagator = propagation.TraceContext{}
+
+// Tracer creates spans through the OpenTelemetry SDK and exports sampled spans over OTLP/HTTP
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer creates a tracer from configuration. It returns nil when tracing is disabled;
+// all tracer and span methods are safe to call on nil.
+func NewTracer(cfg *config.TracingConfig) *Tracer {
+	if !cfg.Enabled {
+		return nil
+	}
+	var exporter sdktrace.SpanExporter
+	if cfg.Endpoint != "" {
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(cfg.Endpoint)}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		// The exporter connects lazily, so creating it does not block on the collector
+		e, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			log.Printf("Failed to create trace exporter, spans will not be exported: %v", err)
+		} else {
+			exporter = e
+		}
+	}
+	return newTracer(cfg, exporter)
+}
+
+// newTracer creates a tracer that hands finished spans to exporter in batches.
+// A nil exporter still creates spans, so trace IDs are propagated and logged.
+func newTracer(cfg *config.TracingConfig, exporter sdktrace.SpanExporter) *Tracer {
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "midgard-gateway"
+	}
+	opts := []sdktrace.TracerProviderOption{
+		// New traces are sampled by ratio; incoming sampling decisions are honored
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	}
+	if exporter != nil {
+		var batchOpts []sdktrace.BatchSpanProcessorOption
+		if cfg.BatchSize > 0 {
+			batchOpts = append(batchOpts, sdktrace.WithMaxExportBatchSize(cfg.BatchSize))
+		}
+		if cfg.QueueSize > 0 {
+			batchOpts = append(batchOpts, sdktrace.WithMaxQueueSize(cfg.QueueSize))
+		}
+		if cfg.FlushInterval > 0 {
+			batchOpts = append(batchOpts, sdktrace.WithBatchTimeout(cfg.FlushInterval))
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter, batchOpts...))
+	}
+	provider := sdktrace.NewTracerProvider(opts...)
+	return &Tracer{provider: provider, tracer: provider.Tracer(instrumentationName)}
+}
+
+// Shutdown exports buffered spans and stops the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// StartRequest starts the server span for an incoming request, continuing the
+// caller's trace when a valid traceparent header is present
+func (t *Tracer) StartRequest(name string, header http.Header) *Span {
+	if t == nil {
+		return nil
+	}
+	ctx := context.Background()
+	if parent, ok := ParseTraceparent(header.Get(TraceparentHeader), header.Get(TracestateHeader)); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	return t.start(ctx, name, KindServer)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind trace.SpanKind) *Span {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return &Span{tracer: t, ctx: ctx, span: span}
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	tracer *Tracer
+	ctx    context.Context
+	span   trace.Span
+}
+
+// StartChild starts a child span
+func (s *Span) StartChild(name string, kind trace.SpanKind) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(s.ctx, name, kind)
+}
+
+// TraceID returns the trace ID as hex, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.span.SpanContext().TraceID().String()
+}
+
+// Traceparent returns the W3C traceparent header value identifying this span
+func (s *Span) Traceparent() string {
+	return s.header(TraceparentHeader)
+}
+
+// Tracestate returns the propagated tracestate header value
+func (s *Span) Tracestate() string {
+	return s.header(TracestateHeader)
+}
+
+func (s *Span) header(name string) string {
+	if s == nil {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(s.ctx, carrier)
+	return carrier.Get(name)
+}
+
+// SetName renames the span, e.g. once the route is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.span.SetName(name)
+}
+
+// SetAttribute sets a string, bool, integer or float attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case uint:
+		s.span.SetAttributes(attribute.Int64(key, int64(v)))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, message)
+}
+
+// End finishes the span and queues it for export if sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// ParseTraceparent parses W3C traceparent and tracestate header values into a
+// remote span context. It reports false when the traceparent is missing or malformed.
+func ParseTraceparent(traceparent, tracestate string) (trace.SpanContext, bool) {
+	carrier := propagation.MapCarrier{TraceparentHeader: traceparent}
+	if tracestate != "" {
+		carrier[TracestateHeader] = tracestate
+	}
+	sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+	return sc, sc.IsValid()
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/midgard/gateway/config"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// keepSpans is an in-memory exporter that keeps its spans on shutdown, so tests can
+// check that shutting down the tracer exports buffered spans
+type keepSpans struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keepSpans) Shutdown(context.Context) error { return nil }
+
+func newTestTracer(t *testing.T, ratio float64) (*Tracer, keepSpans) {
+	t.Helper()
+	exporter := keepSpans{tracetest.NewInMemoryExporter()}
+	tracer := newTracer(&config.TracingConfig{Enabled: true, SampleRatio: ratio}, exporter)
+	t.Cleanup(func() { tracer.Shutdown(context.Background()) })
+	return tracer, exporter
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"version 00 with extra field", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short trace ID", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value, "")
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID().String() != "00f067aa0ba902b7" {
+				t.Fatalf("IDs %s %s", sc.TraceID(), sc.SpanID())
+			}
+			if sc.IsSampled() != tt.sampled || !sc.IsRemote() {
+				t.Fatalf("sampled %v, remote %v", sc.IsSampled(), sc.IsRemote())
+			}
+		})
+	}
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=abc")
+	if sc.TraceState().Get("vendor") != "abc" {
+		t.Fatalf("tracestate %q", sc.TraceState())
+	}
+}
+
+func TestStartRequestContinuesIncomingTrace(t *testing.T) {
+	tracer, exporter := newTestTracer(t, 0)
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(TracestateHeader, "vendor=abc")
+
+	span := tracer.StartRequest("GET /proxy/shop", header)
+	child := span.StartChild("upstream GET", KindClient)
+	if span.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace ID %s", span.TraceID())
+	}
+	// The child is propagated upstream under the caller's trace with the same state
+	if tp := child.Traceparent(); !strings.HasPrefix(tp, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(tp, "-01") {
+		t.Fatalf("child traceparent %q", tp)
+	}
+	if child.Tracestate() != "vendor=abc" {
+		t.Fatalf("child tracestate %q", child.Tracestate())
+	}
+	child.End()
+	span.End()
+
+	// The caller sampled the trace, which wins over a ratio of 0
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want 2", len(spans))
+	}
+	server, client := spans[1], spans[0]
+	if server.SpanKind != trace.SpanKindServer || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("server span kind %v, parent %s", server.SpanKind, server.Parent.SpanID())
+	}
+	if client.SpanKind != trace.SpanKindClient || client.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Fatalf("client span kind %v, parent %s", client.SpanKind, client.Parent.SpanID())
+	}
+}
+
+func TestStartRequestWithMalformedTraceparentStartsNewTrace(t *testing.T) {
+	tracer, _ := newTestTracer(t, 1)
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+
+	span := tracer.StartRequest("GET /proxy/shop", header)
+	defer span.End()
+	if id := span.TraceID(); len(id) != 32 || id == "00000000000000000000000000000000" {
+		t.Fatalf("trace ID %q", id)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	for _, tc := range []struct {
+		ratio float64
+		want  int
+	}{{0, 0}, {1, 20}} {
+		tracer, exporter := newTestTracer(t, tc.ratio)
+		for i := 0; i < 20; i++ {
+			span := tracer.StartRequest("GET /", http.Header{})
+			// Unsampled requests still get a trace ID for their log entry
+			if span.TraceID() == "00000000000000000000000000000000" {
+				t.Fatalf("ratio %v: no trace ID", tc.ratio)
+			}
+			sampled := strings.HasSuffix(span.Traceparent(), "-01")
+			if sampled != (tc.ratio == 1) {
+				t.Fatalf("ratio %v: traceparent %q", tc.ratio, span.Traceparent())
+			}
+			span.End()
+		}
+		tracer.Shutdown(context.Background())
+		if n := len(exporter.GetSpans()); n != tc.want {
+			t.Fatalf("ratio %v: %d spans exported, want %d", tc.ratio, n, tc.want)
+		}
+	}
+
+	// An incoming unsampled flag is honored even when every new trace is sampled
+	tracer, exporter := newTestTracer(t, 1)
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tracer.StartRequest("GET /", header).End()
+	tracer.Shutdown(context.Background())
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Fatalf("%d spans exported for an unsampled caller", n)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.StartRequest("GET /", http.Header{})
+	span.SetAttribute("k", 1)
+	span.StartChild("child", KindInternal).End()
+	span.End()
+	if span.TraceID() != "" || span.Traceparent() != "" {
+		t.Fatal("nil span has IDs")
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if NewTracer(&config.TracingConfig{}) != nil {
+		t.Fatal("disabled tracing created a tracer")
+	}
+}
@@ -6,15 +6,26 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/midgard/gateway/config"
-	"github.com/redis/go-redis/v9"
+	"github.com/midgard/gateway/internal/alert"
+	"github.com/midgard/gateway/internal/analytics"
 	"github.com/midgard/gateway/internal/api"
+	"github.com/midgard/gateway/internal/cache"
 	"github.com/midgard/gateway/internal/collection"
 	"github.com/midgard/gateway/internal/database"
 	"github.com/midgard/gateway/internal/health"
+	"github.com/midgard/gateway/internal/metrics"
 	"github.com/midgard/gateway/internal/proxy"
+	"github.com/midgard/gateway/internal/redact"
+	"github.com/midgard/gateway/internal/retention"
+	"github.com/midgard/gateway/internal/slo"
+	"github.com/midgard/gateway/internal/tracing"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -30,15 +41,14 @@ func main() {
 	}
 
 	// Initialize Redis client
-	var redisClient *redis.Client
-	if cfg.Redis.Host != "" {
-		redisClient = redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
-			Password: cfg.Redis.Password,
-			DB:       cfg.Redis.DB,
-		})
-		log.Printf("Redis client initialized for %s:%d", cfg.Redis.Host, cfg.Redis.Port)
-		
+	var redisClient redis.UniversalClient
+	if cache.RedisConfigured(&cfg.Redis) {
+		redisClient, err = cache.NewRedisClient(&cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to configure Redis: %v", err)
+		}
+		log.Printf("Redis client initialized for %s", cache.RedisAddr(&cfg.Redis))
+
 		// Test connection
 		ctx := context.Background()
 		testKey := "midgard:test:connection"
@@ -56,27 +66,83 @@ func main() {
 			}
 		}
 	} else {
-		log.Println("Redis not configured (host is empty)")
+		log.Println("Redis not configured (host, sentinel and cluster are empty)")
 	}
 
 	// Initialize collection manager
 	collectionManager := collection.NewCollectionManager(db)
 
 	// Initialize health checker
-	healthChecker := health.NewHealthChecker()
+	healthChecker := health.NewHealthChecker(db, cfg.Health)
+	healthChecker.Start()
+
+	// Initialize alerting; health transitions are reported before the first checks run
+	alertManager := alert.NewManager(db, cfg.Alerting.Cooldown, alert.NewNotifiers(&cfg.Alerting)...)
+	alertMonitor := alert.NewMonitor(db, alertManager, &cfg.Alerting)
+	healthChecker.OnTransition(alertMonitor.HealthChanged)
+	alertMonitor.Start()
+	log.Printf("Alerting enabled with notifiers: %s", strings.Join(alertManager.Notifiers(), ", "))
 
 	// Start health checks for existing collections
 	collections, err := collectionManager.GetAllCollections()
 	if err == nil {
 		for _, coll := range collections {
-			if coll.HealthPath != "" {
+			if health.Enabled(&coll) {
 				healthChecker.StartHealthCheck(&coll)
 			}
 		}
 	}
 
+	// Initialize log redactor
+	redactor, err := redact.NewRedactor(&cfg.Log.Redact)
+	if err != nil {
+		log.Fatalf("Failed to initialize log redaction: %v", err)
+	}
+
+	// Initialize metrics
+	gatewayMetrics := metrics.NewGateway()
+
+	// Initialize tracing
+	tracer := tracing.NewTracer(&cfg.Tracing)
+	if cfg.Tracing.Enabled {
+		log.Printf("Tracing enabled, exporting spans to %q", cfg.Tracing.Endpoint)
+	}
+
+	// Initialize the response cache backend
+	cacheBackend, cacheBackendName := cache.NewBackend(cfg.Cache, redisClient)
+	log.Printf("Response cache backend: %s", cacheBackendName)
+
 	// Initialize proxy manager
-	proxyManager := proxy.NewProxyManager(collectionManager, healthChecker, redisClient, db)
+	proxyManager := proxy.NewProxyManager(collectionManager, healthChecker, cacheBackend, cfg.Cache, cfg.Proxy, db, redactor, gatewayMetrics, tracer, alertMonitor)
+
+	// Export collection health and database pool state on every scrape
+	gatewayMetrics.RegisterCollectionHealth(func() map[string]bool {
+		states := make(map[string]bool)
+		statuses := healthChecker.Statuses()
+		if collections, err := collectionManager.GetAllCollections(); err == nil {
+			for _, coll := range collections {
+				if healthy, ok := statuses[coll.ID]; ok {
+					states[coll.Prefix] = healthy
+				}
+			}
+		}
+		return states
+	})
+	if sqlDB, err := db.DB(); err == nil {
+		gatewayMetrics.RegisterDB(sqlDB)
+	}
+
+	// Start log retention job
+	retentionManager := retention.NewManager(db, cfg.Log.Retention)
+	retentionManager.Start()
+
+	// Start analytics rollup job
+	analyticsManager := analytics.NewManager(db, cfg.Analytics)
+	analyticsManager.Start()
+
+	// Start SLO evaluation
+	sloEvaluator := slo.NewEvaluator(db, alertManager, cfg.SLO.EvaluationInterval)
+	sloEvaluator.Start()
 
 	// Check if frontend is enabled (from environment variable or config)
 	enableFrontend := cfg.EnableFrontend
@@ -85,8 +151,8 @@ func main() {
 	}
 
 	// Initialize API server
-	apiServer := api.NewAPIServer(collectionManager, proxyManager, healthChecker, db, enableFrontend)
-	
+	apiServer := api.NewAPIServer(collectionManager, proxyManager, healthChecker, retentionManager, gatewayMetrics, sloEvaluator, alertManager, db, enableFrontend)
+
 	if enableFrontend {
 		log.Println("Frontend is enabled")
 	} else {
@@ -103,9 +169,36 @@ func main() {
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: apiServer.RegisterRoutes(),
 	}
+	if cfg.Server.H2C {
+		// gRPC clients connect with HTTP/2 prior knowledge when TLS is terminated elsewhere
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
 	log.Printf("Midgard Gateway started on :%d", port)
-	if err := server.ListenAndServe(); err != nil {
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Failed to start server: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Let in-flight requests finish, then flush spans that are still buffered
+	log.Println("Shutting down Midgard Gateway...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to flush trace spans: %v", err)
 	}
 }